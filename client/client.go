@@ -0,0 +1,166 @@
+// Package client is a Go client of the server. Commands of every family have
+// typed methods returning commands with their replies:
+//
+//	c := client.NewClient(&client.Options{Addr: "localhost:8000"})
+//	defer c.Close()
+//	err := c.Set(ctx, "user:1", "moose", time.Hour).Err()
+//	value, err := c.Get(ctx, "user:1").Result()
+//
+// Commands and replies use the length prefixed protocol, so keys and values
+// may hold any bytes including new lines, and error replies are told apart
+// from values by their kind rather than their text.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
+const (
+	DefaultPoolSize    = 10
+	DefaultDialTimeout = 5 * time.Second
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+type Options struct {
+	// tcp by default or unix
+	Network string
+	// host:port or the unix socket path
+	Addr string
+	// connections use TLS when it is set
+	TLSConfig *tls.Config
+
+	// connections authenticate as the user, the default one when Username is
+	// empty, and authenticate again when the server asks for it
+	Username string
+	Password string
+	// database selected by every connection
+	DB int
+
+	// maximum number of connections
+	PoolSize int
+	// time to connect, read the greeting and authenticate
+	DialTimeout time.Duration
+	// time of a single command or a pipeline unless the context has an
+	// earlier deadline, 0 leaves it to the context
+	Timeout time.Duration
+	// idle connections are closed after it, keep it below the server timeout
+	IdleTimeout time.Duration
+}
+
+func (opt *Options) init() {
+	if opt.Network == "" {
+		opt.Network = "tcp"
+	}
+	if opt.PoolSize <= 0 {
+		opt.PoolSize = DefaultPoolSize
+	}
+	if opt.DialTimeout == 0 {
+		opt.DialTimeout = DefaultDialTimeout
+	}
+	if opt.IdleTimeout == 0 {
+		opt.IdleTimeout = DefaultIdleTimeout
+	}
+}
+
+// Client is safe for concurrent use, every command takes a connection of the
+// pool for its time
+type Client struct {
+	cmdable
+	opt  *Options
+	pool *pool
+}
+
+// NewClient creates a client, connections are dialed once needed
+func NewClient(opt *Options) *Client {
+	options := *opt
+	options.init()
+
+	c := &Client{opt: &options, pool: newPool(&options)}
+	c.cmdable = c.process
+	return c
+}
+
+func (c *Client) Options() Options {
+	return *c.opt
+}
+
+func (c *Client) PoolStats() PoolStats {
+	return c.pool.stats()
+}
+
+// Close closes the connections, commands fail with ErrClosed afterwards
+func (c *Client) Close() error {
+	return c.pool.close()
+}
+
+func (c *Client) process(ctx context.Context, cmd Cmder) error {
+	return c.processCmds(ctx, []Cmder{cmd})
+}
+
+// processCmds executes commands on a single connection sending them at once,
+// it returns the first error
+func (c *Client) processCmds(ctx context.Context, cmds []Cmder) error {
+	if len(cmds) != 0 {
+		cn, err := c.pool.get(ctx)
+		if err == nil {
+			err = cn.withContext(ctx, c.opt.Timeout, func() error {
+				if err := cn.writeCmds(cmds...); err != nil {
+					return err
+				}
+				if err := cn.readReplies(cmds...); err != nil {
+					return err
+				}
+				return c.reauth(cn, cmds)
+			})
+			c.pool.put(cn)
+		}
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.setErr(err)
+			}
+		}
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reauth authenticates again and repeats commands refused for the lack of
+// authentication, the server refuses them when the user of the connection
+// has been deleted or changed
+func (c *Client) reauth(cn *conn, cmds []Cmder) error {
+	if c.opt.Password == "" {
+		return nil
+	}
+
+	refused := make([]Cmder, 0)
+	for _, cmd := range cmds {
+		if cmd.Err() == ErrAuthRequired && cmd.Args()[0] != "AUTH" {
+			refused = append(refused, cmd)
+		}
+	}
+	if len(refused) == 0 {
+		return nil
+	}
+
+	if err := cn.auth(c.opt.Username, c.opt.Password); err != nil {
+		if cn.broken {
+			return err
+		}
+		// a refused password leaves the commands with their replies
+		return nil
+	}
+	for _, cmd := range refused {
+		cmd.setErr(nil)
+	}
+	if err := cn.writeCmds(refused...); err != nil {
+		return err
+	}
+	return cn.readReplies(refused...)
+}
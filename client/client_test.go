@@ -0,0 +1,390 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"redis_like_in_memory_db/internal/server"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startServer serves an in-process server on a random port
+func startServer(t *testing.T) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go server.NewServer("", false, false, "", 4, 4, "").Serve(listener)
+
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestClient_Keys(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address})
+	defer c.Close()
+	ctx := context.Background()
+
+	{
+		t.Log("Values with spaces and quotes should be stored as they are")
+		assert.NoError(t, c.Set(ctx, "user:1", `moose "the elk"`, time.Hour).Err())
+		value, err := c.Get(ctx, "user:1").Result()
+		assert.NoError(t, err)
+		assert.Equal(t, `moose "the elk"`, value)
+
+		_, err = c.Get(ctx, "user:2").Result()
+		assert.Equal(t, Nil, err)
+	}
+
+	{
+		t.Log("Binary values and empty arguments should be stored as they are")
+		values := []string{"line\r\nnext", "nul\x00\xff", "", "a, b"}
+		for i, value := range values {
+			key := "bin:" + strconv.Itoa(i)
+			assert.NoError(t, c.Set(ctx, key, value, time.Hour).Err())
+			assert.Equal(t, value, c.Get(ctx, key).Val())
+			assert.NoError(t, c.ListSet(ctx, "bin:list", value, time.Hour).Err())
+		}
+		assert.Equal(t, values, c.ListValues(ctx, "bin:list").Val())
+		assert.EqualValues(t, 5, c.Del(ctx, "bin:0", "bin:1", "bin:2", "bin:3", "bin:list").Val())
+	}
+
+	{
+		c.Set(ctx, "user:2", "elk", time.Hour)
+		assert.EqualValues(t, 2, c.Exists(ctx, "user:1", "user:2", "user:3").Val())
+		assert.EqualValues(t, 2, c.DBSize(ctx).Val())
+		assert.ElementsMatch(t, []string{"user:1", "user:2"}, c.Keys(ctx, "user:*").Val())
+		assert.Equal(t, "string", c.Type(ctx, "user:1").Val())
+
+		assert.NoError(t, c.Rename(ctx, "user:2", "user:3").Err())
+		assert.False(t, c.RenameNX(ctx, "user:3", "user:1").Val())
+		assert.True(t, c.Copy(ctx, "user:3", "user:4", false).Val())
+		assert.EqualValues(t, 2, c.Del(ctx, "user:3", "user:4", "user:5").Val())
+
+		keys, cursor, err := c.Scan(ctx, 0, "", 100, "").Result()
+		assert.NoError(t, err)
+		assert.EqualValues(t, 0, cursor)
+		assert.Equal(t, []string{"user:1"}, keys)
+
+		assert.NoError(t, c.Rem(ctx, "user:1").Err())
+		assert.Equal(t, ErrKeyNotExists, c.Rem(ctx, "user:1").Err())
+	}
+}
+
+func TestClient_ListsAndDicts(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address, DB: 2})
+	defer c.Close()
+	ctx := context.Background()
+
+	{
+		assert.NoError(t, c.ListSet(ctx, "queue", "first", time.Hour).Err())
+		assert.NoError(t, c.ListSet(ctx, "queue", "second", time.Hour).Err())
+		assert.Equal(t, "second", c.ListGet(ctx, "queue", 1).Val())
+		assert.Equal(t, Nil, c.ListGet(ctx, "queue", 5).Err())
+		assert.Equal(t, []string{"first", "second"}, c.ListValues(ctx, "queue").Val())
+		assert.EqualValues(t, 2, c.ListLen(ctx, "queue").Val())
+		assert.Equal(t, ErrIndexOutOfRange, c.ListRem(ctx, "queue", 5).Err())
+	}
+
+	{
+		assert.NoError(t, c.DictSet(ctx, "user:1", "name", "moose", time.Hour).Err())
+		assert.Equal(t, "moose", c.DictGet(ctx, "user:1", "name").Val())
+		assert.Equal(t, Nil, c.DictGet(ctx, "user:1", "age").Err())
+		assert.Equal(t, []string{"name"}, c.DictKeys(ctx, "user:1").Val())
+		page, _, err := c.DictScan(ctx, "user:1", 0, "", 0).Result()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"name", "moose"}, page)
+		assert.NoError(t, c.DictRem(ctx, "user:1", "name").Err())
+	}
+
+	{
+		t.Log("Commands should go to the selected database")
+		assert.EqualValues(t, 1, c.DBSize(ctx).Val())
+		other := NewClient(&Options{Addr: address})
+		defer other.Close()
+		assert.EqualValues(t, 0, other.DBSize(ctx).Val())
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address})
+	defer c.Close()
+	ctx := context.Background()
+
+	c.Set(ctx, "user:1", "moose", time.Hour)
+	assert.Equal(t, ErrWrongType, c.ListSet(ctx, "user:1", "elk", time.Hour).Err())
+	assert.Equal(t, ErrWrongType, c.DictGet(ctx, "user:1", "name").Err())
+	assert.Equal(t, ErrUnknownCommand, c.Do(ctx, "FETCH", "user:1").Err())
+	assert.Equal(t, ErrSyntax, c.Do(ctx, "COPY", "user:1", "user:2", "NOW").Err())
+
+	reply, err := c.Do(ctx, "TYPE", "user:1").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "string", reply)
+
+	{
+		t.Log("Items of array replies should be kept as they are")
+		cmd := c.Do(ctx, "CONFIG", "GET", "databases")
+		assert.Equal(t, []string{"databases", "4"}, cmd.Items())
+		assert.Nil(t, c.Do(ctx, "TYPE", "user:1").Items())
+	}
+
+	{
+		t.Log("Errors without a dedicated value should keep their code")
+		err := c.Do(ctx, "EVAL", `return redis.error_reply("BUSY try later")`, "0").Err()
+		assert.Equal(t, &ReplyError{Code: "BUSY", Message: "try later"}, err)
+	}
+
+	{
+		t.Log("Values looking like errors or nil should be returned as they are")
+		c.Set(ctx, "user:2", "-ERR fake", time.Hour)
+		c.Set(ctx, "user:3", "(nil)", time.Hour)
+		assert.Equal(t, "-ERR fake", c.Get(ctx, "user:2").Val())
+		assert.Equal(t, "(nil)", c.Get(ctx, "user:3").Val())
+		assert.Equal(t, Nil, c.Do(ctx, "GET", "user:4").Err())
+	}
+}
+
+func TestClient_Pipeline(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address})
+	defer c.Close()
+	ctx := context.Background()
+
+	var get *StringCmd
+	cmds, err := c.Pipelined(ctx, func(pipe *Pipeline) error {
+		pipe.Set(ctx, "user:1", "moose", time.Hour)
+		pipe.ListSet(ctx, "user:2", "elk", time.Hour)
+		pipe.DictSet(ctx, "user:2", "name", "elk", time.Hour)
+		get = pipe.Get(ctx, "user:1")
+		return nil
+	})
+	assert.Equal(t, ErrWrongType, err)
+	assert.Len(t, cmds, 4)
+	assert.NoError(t, cmds[0].Err())
+	assert.Equal(t, ErrWrongType, cmds[2].Err())
+	assert.Equal(t, "moose", get.Val())
+	assert.Equal(t, 1, c.PoolStats().TotalConns)
+}
+
+func TestClient_MultiKey(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address})
+	defer c.Close()
+	ctx := context.Background()
+
+	{
+		t.Log("Given several keys it should set and get them in one round trip")
+		assert.NoError(t, c.MSet(ctx, map[string]string{"a": "1", "b": "\r\n"}, time.Hour).Err())
+		assert.Equal(t, []interface{}{"1", nil, "\r\n"}, c.MGet(ctx, "a", "missing", "b").Val())
+		assert.False(t, c.MSetNX(ctx, map[string]string{"a": "2", "c": "3"}, time.Hour).Val())
+		assert.True(t, c.MSetNX(ctx, map[string]string{"c": "3", "d": "4"}, time.Hour).Val())
+	}
+
+	{
+		t.Log("Given fields of a dictionary it should set and get them in one round trip")
+		assert.NoError(t, c.DictMSet(ctx, "user:1", map[string]string{"name": "moose", "city": "oslo"}, time.Hour).Err())
+		assert.Equal(t, []interface{}{"moose", nil}, c.DictMGet(ctx, "user:1", "name", "age").Val())
+		assert.Equal(t, map[string]string{"name": "moose", "city": "oslo"}, c.DictGetAll(ctx, "user:1").Val())
+		assert.Equal(t, map[string]string{}, c.DictGetAll(ctx, "user:2").Val())
+		assert.Equal(t, ErrWrongType, c.DictGetAll(ctx, "a").Err())
+	}
+
+	{
+		t.Log("Nil items should survive transactions")
+		var values *SliceCmd
+		_, err := c.TxPipelined(ctx, func(tx *Tx) error {
+			tx.MSet(ctx, map[string]string{"e": "5"}, time.Hour)
+			values = tx.MGet(ctx, "e", "missing")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"5", nil}, values.Val())
+	}
+}
+
+func TestClient_Tx(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address})
+	defer c.Close()
+	ctx := context.Background()
+
+	{
+		var get, missing, escaped *StringCmd
+		var exists *IntCmd
+		_, err := c.TxPipelined(ctx, func(tx *Tx) error {
+			tx.Set(ctx, "user:1", "moose with \"quotes\"", time.Hour)
+			tx.DictSet(ctx, "user:2", "name", "elk", time.Hour)
+			get = tx.Get(ctx, "user:1")
+			exists = tx.Exists(ctx, "user:1", "user:2")
+			missing = tx.Get(ctx, "user:3")
+			tx.Set(ctx, "user:4", "-ERR fake\r\n\x00", time.Hour)
+			escaped = tx.Get(ctx, "user:4")
+			return nil
+		})
+		assert.Equal(t, Nil, err)
+		assert.Equal(t, "moose with \"quotes\"", get.Val())
+		assert.EqualValues(t, 2, exists.Val())
+		assert.Equal(t, Nil, missing.Err())
+		assert.Equal(t, "-ERR fake\r\n\x00", escaped.Val())
+	}
+
+	{
+		t.Log("Commands without keys can not be declared")
+		tx := c.TxPipeline()
+		tx.Set(ctx, "user:1", "moose", time.Hour)
+		tx.DBSize(ctx)
+		_, err := tx.Exec(ctx)
+		assert.Equal(t, ErrNoKeys, err)
+	}
+
+	{
+		t.Log("A failing command should not hide replies of others")
+		tx := c.TxPipeline()
+		set := tx.ListSet(ctx, "user:1", "elk", time.Hour)
+		length := tx.DictLen(ctx, "user:2")
+		_, err := tx.Exec(ctx)
+		assert.Equal(t, ErrWrongType, err)
+		assert.Equal(t, ErrWrongType, set.Err())
+		assert.EqualValues(t, 1, length.Val())
+	}
+}
+
+func TestClient_Context(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address})
+	defer c.Close()
+	admin := NewClient(&Options{Addr: address})
+	defer admin.Close()
+
+	assert.NoError(t, admin.Do(context.Background(), "CLIENT", "PAUSE", "10000", "WRITE").Err())
+
+	{
+		t.Log("A command blocked past the deadline should return and drop its connection")
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := c.Set(ctx, "user:1", "moose", time.Hour).Err()
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Equal(t, PoolStats{}, c.PoolStats())
+	}
+
+	{
+		t.Log("Cancelling should interrupt a command without a deadline")
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+		assert.Equal(t, context.Canceled, c.Set(ctx, "user:1", "moose", time.Hour).Err())
+	}
+
+	admin.Do(context.Background(), "CLIENT", "UNPAUSE")
+	assert.NoError(t, c.Set(context.Background(), "user:1", "moose", time.Hour).Err())
+}
+
+func TestClient_Auth(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	ctx := context.Background()
+	admin := NewClient(&Options{Addr: address})
+	defer admin.Close()
+	assert.NoError(t, admin.Do(ctx, "ACL", "SETUSER", "default", "resetpass", ">secret").Err())
+
+	{
+		c := NewClient(&Options{Addr: address})
+		defer c.Close()
+		assert.Equal(t, ErrAuthRequired, c.Get(ctx, "user:1").Err())
+
+		wrong := NewClient(&Options{Addr: address, Password: "guess"})
+		defer wrong.Close()
+		assert.Equal(t, ErrWrongPassword, wrong.Get(ctx, "user:1").Err())
+
+		right := NewClient(&Options{Addr: address, Password: "secret"})
+		defer right.Close()
+		assert.Equal(t, Nil, right.Get(ctx, "user:1").Err())
+	}
+
+	{
+		t.Log("Connections should authenticate again once the server asks for it")
+		assert.NoError(t, admin.Do(ctx, "ACL", "SETUSER", "app", "on", ">app", "~*", "+@all").Err())
+		c := NewClient(&Options{Addr: address, Username: "app", Password: "app"})
+		defer c.Close()
+		assert.NoError(t, c.Set(ctx, "user:1", "moose", time.Hour).Err())
+
+		admin.Do(ctx, "ACL", "DELUSER", "app")
+		admin.Do(ctx, "ACL", "SETUSER", "app", "on", ">app", "~user:*", "+@all")
+		assert.Equal(t, "moose", c.Get(ctx, "user:1").Val())
+
+		_, err := c.Get(ctx, "session:1").Result()
+		assert.IsType(t, &PermissionError{}, err)
+		assert.Equal(t, 1, c.PoolStats().TotalConns)
+	}
+}
+
+func TestClient_Pool(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address, PoolSize: 2})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.Set(ctx, "user:1", "moose", time.Hour).Err())
+		}()
+	}
+	wg.Wait()
+
+	stats := c.PoolStats()
+	assert.True(t, stats.TotalConns <= 2)
+	assert.Equal(t, stats.TotalConns, stats.IdleConns)
+
+	assert.NoError(t, c.Close())
+	assert.Equal(t, ErrClosed, c.Get(ctx, "user:1").Err())
+	assert.Equal(t, PoolStats{}, c.PoolStats())
+}
+
+func TestClient_Monitor(t *testing.T) {
+	address, stop := startServer(t)
+	defer stop()
+	c := NewClient(&Options{Addr: address})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Monitor(ctx, func(line string) { lines <- line })
+	}()
+
+	{
+		t.Log("Commands of other connections should be streamed")
+		// the monitor may not be registered yet, so the command is repeated
+		var line string
+		for line == "" {
+			c.Set(context.Background(), "key", "value", time.Hour)
+			select {
+			case line = <-lines:
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		assert.Contains(t, line, "SET")
+	}
+
+	{
+		t.Log("Cancelling the context should stop monitoring")
+		cancel()
+		assert.Equal(t, context.Canceled, <-done)
+	}
+}
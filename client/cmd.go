@@ -0,0 +1,324 @@
+package client
+
+import (
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+)
+
+const (
+	successReply = "Success"
+	// Cmd joins items of array replies with it
+	listSeparator = ", "
+)
+
+// Cmder is a command with its reply, commands of pipelines and transactions
+// get their replies once they are executed
+type Cmder interface {
+	Args() []string
+	Err() error
+
+	// keys are declared for transactions
+	keys() []string
+	setReply(r reply.Reply)
+	setErr(err error)
+}
+
+type baseCmd struct {
+	args []string
+	// positions of key arguments
+	keyArgs []int
+	err     error
+}
+
+func (cmd *baseCmd) Args() []string {
+	return cmd.args
+}
+
+func (cmd *baseCmd) Err() error {
+	return cmd.err
+}
+
+func (cmd *baseCmd) keys() []string {
+	keys := make([]string, 0, len(cmd.keyArgs))
+	for _, i := range cmd.keyArgs {
+		keys = append(keys, cmd.args[i])
+	}
+
+	return keys
+}
+
+func (cmd *baseCmd) setErr(err error) {
+	cmd.err = err
+}
+
+// keyRange returns positions from first to the last argument
+func keyRange(first, count int) []int {
+	positions := make([]int, 0, count)
+	for i := first; i < first+count; i++ {
+		positions = append(positions, i)
+	}
+
+	return positions
+}
+
+// pairKeys returns positions of keys of count key, value pairs following the
+// command name
+func pairKeys(count int) []int {
+	positions := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		positions = append(positions, 1+2*i)
+	}
+
+	return positions
+}
+
+// Cmd is a command of any kind, its reply is returned as is unless it is an
+// error or nil, items of arrays are joined with ", " and kept by Items
+type Cmd struct {
+	baseCmd
+	val   string
+	items []string
+}
+
+func (cmd *Cmd) setReply(r reply.Reply) {
+	switch r.Kind {
+	case reply.ErrorKind:
+		cmd.err = replyError(r)
+	case reply.NilKind:
+		cmd.err = Nil
+	case reply.ArrayKind:
+		cmd.items = r.Strings()
+		cmd.val = strings.Join(cmd.items, listSeparator)
+	default:
+		cmd.val = r.Value
+	}
+}
+
+func (cmd *Cmd) Val() string {
+	return cmd.val
+}
+
+// Items returns items of an array reply, it is nil for other replies
+func (cmd *Cmd) Items() []string {
+	return cmd.items
+}
+
+func (cmd *Cmd) Result() (string, error) {
+	return cmd.val, cmd.err
+}
+
+// StatusCmd is a command replying "Success"
+type StatusCmd struct {
+	baseCmd
+}
+
+func (cmd *StatusCmd) setReply(r reply.Reply) {
+	switch {
+	case r.IsError():
+		cmd.err = replyError(r)
+	case r.Value != successReply:
+		cmd.err = ErrUnexpectedReply
+	}
+}
+
+// StringCmd is a command returning a single value, Nil is returned when the
+// value does not exist
+type StringCmd struct {
+	baseCmd
+	val string
+}
+
+func (cmd *StringCmd) setReply(r reply.Reply) {
+	switch r.Kind {
+	case reply.ErrorKind:
+		cmd.err = replyError(r)
+	case reply.NilKind:
+		cmd.err = Nil
+	default:
+		cmd.val = r.Value
+	}
+}
+
+func (cmd *StringCmd) Val() string {
+	return cmd.val
+}
+
+func (cmd *StringCmd) Result() (string, error) {
+	return cmd.val, cmd.err
+}
+
+// IntCmd is a command returning a number
+type IntCmd struct {
+	baseCmd
+	val int64
+}
+
+func (cmd *IntCmd) setReply(r reply.Reply) {
+	if r.IsError() {
+		cmd.err = replyError(r)
+		return
+	}
+	val, err := strconv.ParseInt(r.Value, 10, 64)
+	if err != nil {
+		cmd.err = ErrUnexpectedReply
+		return
+	}
+	cmd.val = val
+}
+
+func (cmd *IntCmd) Val() int64 {
+	return cmd.val
+}
+
+func (cmd *IntCmd) Result() (int64, error) {
+	return cmd.val, cmd.err
+}
+
+// BoolCmd is a command replying 1 or 0
+type BoolCmd struct {
+	baseCmd
+	val bool
+}
+
+func (cmd *BoolCmd) setReply(r reply.Reply) {
+	switch {
+	case r.IsError():
+		cmd.err = replyError(r)
+	case r.Value == "1":
+		cmd.val = true
+	case r.Value != "0":
+		cmd.err = ErrUnexpectedReply
+	}
+}
+
+func (cmd *BoolCmd) Val() bool {
+	return cmd.val
+}
+
+func (cmd *BoolCmd) Result() (bool, error) {
+	return cmd.val, cmd.err
+}
+
+// StringSliceCmd is a command returning an array of values
+type StringSliceCmd struct {
+	baseCmd
+	val []string
+}
+
+func (cmd *StringSliceCmd) setReply(r reply.Reply) {
+	if r.IsError() {
+		cmd.err = replyError(r)
+		return
+	}
+	cmd.val = r.Strings()
+}
+
+func (cmd *StringSliceCmd) Val() []string {
+	return cmd.val
+}
+
+func (cmd *StringSliceCmd) Result() ([]string, error) {
+	return cmd.val, cmd.err
+}
+
+// SliceCmd is a command returning an array of values which may be missing,
+// items are strings or nil
+type SliceCmd struct {
+	baseCmd
+	val []interface{}
+}
+
+func (cmd *SliceCmd) setReply(r reply.Reply) {
+	if r.IsError() {
+		cmd.err = replyError(r)
+		return
+	}
+	if r.Kind != reply.ArrayKind {
+		cmd.err = ErrUnexpectedReply
+		return
+	}
+
+	cmd.val = make([]interface{}, 0, len(r.Items))
+	for _, item := range r.Items {
+		if item.Kind == reply.NilKind {
+			cmd.val = append(cmd.val, nil)
+			continue
+		}
+		cmd.val = append(cmd.val, item.Value)
+	}
+}
+
+func (cmd *SliceCmd) Val() []interface{} {
+	return cmd.val
+}
+
+func (cmd *SliceCmd) Result() ([]interface{}, error) {
+	return cmd.val, cmd.err
+}
+
+// StringStringMapCmd is a command returning field, value pairs
+type StringStringMapCmd struct {
+	baseCmd
+	val map[string]string
+}
+
+func (cmd *StringStringMapCmd) setReply(r reply.Reply) {
+	if r.IsError() {
+		cmd.err = replyError(r)
+		return
+	}
+
+	items := r.Strings()
+	if len(items)%2 != 0 {
+		cmd.err = ErrUnexpectedReply
+		return
+	}
+	cmd.val = make(map[string]string, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		cmd.val[items[i]] = items[i+1]
+	}
+}
+
+func (cmd *StringStringMapCmd) Val() map[string]string {
+	return cmd.val
+}
+
+func (cmd *StringStringMapCmd) Result() (map[string]string, error) {
+	return cmd.val, cmd.err
+}
+
+// ScanCmd is a page of SCAN, DSCAN or ZSCAN with the cursor of the next one,
+// iteration is over when the cursor is 0
+type ScanCmd struct {
+	baseCmd
+	page   []string
+	cursor uint64
+}
+
+func (cmd *ScanCmd) setReply(r reply.Reply) {
+	if r.IsError() {
+		cmd.err = replyError(r)
+		return
+	}
+
+	items := r.Strings()
+	if len(items) == 0 {
+		cmd.err = ErrUnexpectedReply
+		return
+	}
+	cursor, err := strconv.ParseUint(items[0], 10, 64)
+	if err != nil {
+		cmd.err = ErrUnexpectedReply
+		return
+	}
+	cmd.page, cmd.cursor = items[1:], cursor
+}
+
+func (cmd *ScanCmd) Val() ([]string, uint64) {
+	return cmd.page, cmd.cursor
+}
+
+func (cmd *ScanCmd) Result() ([]string, uint64, error) {
+	return cmd.page, cmd.cursor, cmd.err
+}
@@ -0,0 +1,343 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// cmdable executes commands of the client right away and queues them in
+// pipelines and transactions
+type cmdable func(ctx context.Context, cmd Cmder) error
+
+// positions of key arguments of the most common commands
+var (
+	noKeys   []int
+	firstKey = []int{1}
+)
+
+func newCmd(keyArgs []int, args ...string) *Cmd {
+	return &Cmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newStatusCmd(keyArgs []int, args ...string) *StatusCmd {
+	return &StatusCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newStringCmd(keyArgs []int, args ...string) *StringCmd {
+	return &StringCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newIntCmd(keyArgs []int, args ...string) *IntCmd {
+	return &IntCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newBoolCmd(keyArgs []int, args ...string) *BoolCmd {
+	return &BoolCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newStringSliceCmd(keyArgs []int, args ...string) *StringSliceCmd {
+	return &StringSliceCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newSliceCmd(keyArgs []int, args ...string) *SliceCmd {
+	return &SliceCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newStringStringMapCmd(keyArgs []int, args ...string) *StringStringMapCmd {
+	return &StringStringMapCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+func newScanCmd(keyArgs []int, args ...string) *ScanCmd {
+	return &ScanCmd{baseCmd: baseCmd{args: args, keyArgs: keyArgs}}
+}
+
+// pairArgs appends key, value pairs of values
+func pairArgs(args []string, values map[string]string) []string {
+	for key, value := range values {
+		args = append(args, key, value)
+	}
+
+	return args
+}
+
+// scanArgs appends [MATCH pattern] [COUNT count], empty pattern and zero
+// count are left to the server defaults
+func scanArgs(args []string, match string, count int) []string {
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(count))
+	}
+
+	return args
+}
+
+// Do executes any command, in transactions its first argument is taken for
+// the key
+func (c cmdable) Do(ctx context.Context, args ...string) *Cmd {
+	keyArgs := noKeys
+	if len(args) > 1 {
+		keyArgs = firstKey
+	}
+	cmd := newCmd(keyArgs, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Get returns the value of the key or Nil
+func (c cmdable) Get(ctx context.Context, key string) *StringCmd {
+	cmd := newStringCmd(firstKey, "GET", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Set stores the value for ttl, every key has to expire
+func (c cmdable) Set(ctx context.Context, key, value string, ttl time.Duration) *StatusCmd {
+	cmd := newStatusCmd(firstKey, "SET", key, value, ttl.String())
+	c(ctx, cmd)
+	return cmd
+}
+
+// MGet returns values of the keys, missing ones and keys of other families
+// are nil
+func (c cmdable) MGet(ctx context.Context, keys ...string) *SliceCmd {
+	cmd := newSliceCmd(keyRange(1, len(keys)), append([]string{"MGET"}, keys...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// MSet stores the values for ttl at once, nothing is stored when a key holds
+// another family
+func (c cmdable) MSet(ctx context.Context, values map[string]string, ttl time.Duration) *StatusCmd {
+	args := append(pairArgs([]string{"MSET"}, values), ttl.String())
+	cmd := newStatusCmd(pairKeys(len(values)), args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// MSetNX stores the values for ttl only when none of the keys exists
+func (c cmdable) MSetNX(ctx context.Context, values map[string]string, ttl time.Duration) *BoolCmd {
+	args := append(pairArgs([]string{"MSETNX"}, values), ttl.String())
+	cmd := newBoolCmd(pairKeys(len(values)), args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Rem removes the key, ErrKeyNotExists is returned when there is none
+func (c cmdable) Rem(ctx context.Context, key string) *StatusCmd {
+	cmd := newStatusCmd(firstKey, "REM", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Len returns the number of plain keys
+func (c cmdable) Len(ctx context.Context) *IntCmd {
+	cmd := newIntCmd(noKeys, "LEN")
+	c(ctx, cmd)
+	return cmd
+}
+
+// Keys returns keys of every family matching the glob pattern, an empty
+// pattern matches all of them
+func (c cmdable) Keys(ctx context.Context, pattern string) *StringSliceCmd {
+	args := []string{"KEYS"}
+	if pattern != "" {
+		args = append(args, pattern)
+	}
+	cmd := newStringSliceCmd(noKeys, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Scan returns a page of keys starting at the cursor, typeName limits keys to
+// a family unless it is empty
+func (c cmdable) Scan(ctx context.Context, cursor uint64, match string, count int, typeName string) *ScanCmd {
+	args := scanArgs([]string{"SCAN", strconv.FormatUint(cursor, 10)}, match, count)
+	if typeName != "" {
+		args = append(args, "TYPE", typeName)
+	}
+	cmd := newScanCmd(noKeys, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Del removes keys of any family and returns the number of removed ones
+func (c cmdable) Del(ctx context.Context, keys ...string) *IntCmd {
+	cmd := newIntCmd(keyRange(1, len(keys)), append([]string{"DEL"}, keys...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Unlink(ctx context.Context, keys ...string) *IntCmd {
+	cmd := newIntCmd(keyRange(1, len(keys)), append([]string{"UNLINK"}, keys...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Exists returns the number of existing keys
+func (c cmdable) Exists(ctx context.Context, keys ...string) *IntCmd {
+	cmd := newIntCmd(keyRange(1, len(keys)), append([]string{"EXISTS"}, keys...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Type returns string, list, dict, json or none
+func (c cmdable) Type(ctx context.Context, key string) *StringCmd {
+	cmd := newStringCmd(firstKey, "TYPE", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Rename(ctx context.Context, key, newKey string) *StatusCmd {
+	cmd := newStatusCmd(keyRange(1, 2), "RENAME", key, newKey)
+	c(ctx, cmd)
+	return cmd
+}
+
+// RenameNX renames the key unless newKey exists
+func (c cmdable) RenameNX(ctx context.Context, key, newKey string) *BoolCmd {
+	cmd := newBoolCmd(keyRange(1, 2), "RENAMENX", key, newKey)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Copy copies the key with its ttl, an existing destination is overwritten
+// only with replace
+func (c cmdable) Copy(ctx context.Context, key, newKey string, replace bool) *BoolCmd {
+	args := []string{"COPY", key, newKey}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	cmd := newBoolCmd(keyRange(1, 2), args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// RandomKey returns a random key, the value is empty when there are no keys
+func (c cmdable) RandomKey(ctx context.Context) *StringCmd {
+	cmd := newStringCmd(noKeys, "RANDOMKEY")
+	c(ctx, cmd)
+	return cmd
+}
+
+// DBSize returns the number of keys of every family
+func (c cmdable) DBSize(ctx context.Context) *IntCmd {
+	cmd := newIntCmd(noKeys, "DBSIZE")
+	c(ctx, cmd)
+	return cmd
+}
+
+// FlushDB removes every key of the selected database
+func (c cmdable) FlushDB(ctx context.Context) *StatusCmd {
+	cmd := newStatusCmd(noKeys, "FLUSHDB")
+	c(ctx, cmd)
+	return cmd
+}
+
+// ListSet appends the value to the list or updates its ttl if it is there
+func (c cmdable) ListSet(ctx context.Context, key, value string, ttl time.Duration) *StatusCmd {
+	cmd := newStatusCmd(firstKey, "ZSET", key, value, ttl.String())
+	c(ctx, cmd)
+	return cmd
+}
+
+// ListGet returns the value at the index or Nil
+func (c cmdable) ListGet(ctx context.Context, key string, index int) *StringCmd {
+	cmd := newStringCmd(firstKey, "ZGET", key, strconv.Itoa(index))
+	c(ctx, cmd)
+	return cmd
+}
+
+// ListValues returns values of the list
+func (c cmdable) ListValues(ctx context.Context, key string) *StringSliceCmd {
+	cmd := newStringSliceCmd(firstKey, "ZKEYS", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ListLen returns the length of the list, -1 when it does not exist
+func (c cmdable) ListLen(ctx context.Context, key string) *IntCmd {
+	cmd := newIntCmd(firstKey, "ZLEN", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ListRem removes the value at the index
+func (c cmdable) ListRem(ctx context.Context, key string, index int) *StatusCmd {
+	cmd := newStatusCmd(firstKey, "ZREM", key, strconv.Itoa(index))
+	c(ctx, cmd)
+	return cmd
+}
+
+// ListScan returns a page of values of the list
+func (c cmdable) ListScan(ctx context.Context, key string, cursor uint64, match string, count int) *ScanCmd {
+	cmd := newScanCmd(firstKey, scanArgs([]string{"ZSCAN", key, strconv.FormatUint(cursor, 10)}, match, count)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictSet stores the value of the field in the dictionary for ttl
+func (c cmdable) DictSet(ctx context.Context, key, field, value string, ttl time.Duration) *StatusCmd {
+	cmd := newStatusCmd(firstKey, "DSET", key, field, value, ttl.String())
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictGet returns the value of the field or Nil
+func (c cmdable) DictGet(ctx context.Context, key, field string) *StringCmd {
+	cmd := newStringCmd(firstKey, "DGET", key, field)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictMGet returns values of the fields, missing and expired ones are nil
+func (c cmdable) DictMGet(ctx context.Context, key string, fields ...string) *SliceCmd {
+	cmd := newSliceCmd(firstKey, append([]string{"HMGET", key}, fields...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictMSet stores the fields in the dictionary with the same ttl
+func (c cmdable) DictMSet(ctx context.Context, key string, fields map[string]string, ttl time.Duration) *StatusCmd {
+	args := append(pairArgs([]string{"HMSET", key}, fields), ttl.String())
+	cmd := newStatusCmd(firstKey, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictGetAll returns fields of the dictionary with their values
+func (c cmdable) DictGetAll(ctx context.Context, key string) *StringStringMapCmd {
+	cmd := newStringStringMapCmd(firstKey, "HGETALL", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictKeys returns fields of the dictionary
+func (c cmdable) DictKeys(ctx context.Context, key string) *StringSliceCmd {
+	cmd := newStringSliceCmd(firstKey, "DKEYS", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictLen returns the number of fields, -1 when the dictionary does not exist
+func (c cmdable) DictLen(ctx context.Context, key string) *IntCmd {
+	cmd := newIntCmd(firstKey, "DLEN", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictRem removes the field
+func (c cmdable) DictRem(ctx context.Context, key, field string) *StatusCmd {
+	cmd := newStatusCmd(firstKey, "DREM", key, field)
+	c(ctx, cmd)
+	return cmd
+}
+
+// DictScan returns a page of the dictionary as field, value pairs
+func (c cmdable) DictScan(ctx context.Context, key string, cursor uint64, match string, count int) *ScanCmd {
+	cmd := newScanCmd(firstKey, scanArgs([]string{"DSCAN", key, strconv.FormatUint(cursor, 10)}, match, count)...)
+	c(ctx, cmd)
+	return cmd
+}
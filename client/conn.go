@@ -0,0 +1,239 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	greeting   = "SSuccessful connection"
+	authPrompt = "Authorize to proceed with AUTH [username] password"
+)
+
+// conn is a single connection of the pool
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	// the server prompts for a password after the greeting, the prompt is
+	// skipped when it comes before the first reply
+	prompted bool
+	// the stream is out of sync after a network error or a timeout
+	broken bool
+	usedAt time.Time
+}
+
+func dial(ctx context.Context, opt *Options) (*conn, error) {
+	dialer := &net.Dialer{Timeout: opt.DialTimeout}
+	netConn, err := dialer.DialContext(ctx, opt.Network, opt.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if opt.TLSConfig != nil {
+		netConn = tls.Client(netConn, opt.TLSConfig)
+	}
+
+	cn := &conn{
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+		writer:  bufio.NewWriter(netConn),
+		usedAt:  time.Now(),
+	}
+	if err := cn.init(ctx, opt); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// init reads the greeting, authenticates and selects the database
+func (cn *conn) init(ctx context.Context, opt *Options) error {
+	return cn.withContext(ctx, opt.DialTimeout, func() error {
+		line, err := cn.readLine()
+		if err != nil {
+			return err
+		}
+		if line != greeting {
+			// connections above maxclients get the error instead
+			if r := reply.Parse(line); r.IsError() {
+				return replyError(r)
+			}
+			return errUnexpectedGreeting
+		}
+
+		if opt.Password != "" {
+			if err := cn.auth(opt.Username, opt.Password); err != nil {
+				return err
+			}
+		}
+		if opt.DB != 0 {
+			cmd := newStatusCmd(nil, "SELECT", strconv.Itoa(opt.DB))
+			if err := cn.roundTrip(cmd); err != nil {
+				return err
+			}
+			return cmd.Err()
+		}
+
+		return nil
+	})
+}
+
+func (cn *conn) auth(username, password string) error {
+	cmd := newStatusCmd(nil, "AUTH", password)
+	if username != "" {
+		cmd = newStatusCmd(nil, "AUTH", username, password)
+	}
+	if err := cn.roundTrip(cmd); err != nil {
+		return err
+	}
+
+	return cmd.Err()
+}
+
+// withContext runs fn with the connection deadline set by the context and
+// the timeout, a cancelled context interrupts blocked reads and writes
+func (cn *conn) withContext(ctx context.Context, timeout time.Duration, fn func() error) error {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	ctxDeadline, ok := ctx.Deadline()
+	if ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	cn.netConn.SetDeadline(deadline)
+
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		interrupted := make(chan struct{})
+		go func() {
+			defer close(interrupted)
+			select {
+			case <-ctx.Done():
+				cn.netConn.SetDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-interrupted
+		}()
+	}
+
+	err := fn()
+	if err != nil && ctx.Err() != nil {
+		// the reply of an interrupted command may still arrive
+		cn.broken = true
+		err = ctx.Err()
+	}
+	// the connection deadline may pass before the context notices it
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && deadline.Equal(ctxDeadline) {
+		err = context.DeadlineExceeded
+	}
+	cn.usedAt = time.Now()
+	return err
+}
+
+// roundTrip writes the command and reads its reply
+func (cn *conn) roundTrip(cmd Cmder) error {
+	if err := cn.writeCmds(cmd); err != nil {
+		return err
+	}
+
+	return cn.readReplies(cmd)
+}
+
+// writeCmds writes commands as arrays of length prefixed values, so
+// arguments may hold any bytes
+func (cn *conn) writeCmds(cmds ...Cmder) error {
+	for _, cmd := range cmds {
+		reply.Write(cn.writer, reply.Values(cmd.Args()))
+	}
+	if err := cn.writer.Flush(); err != nil {
+		cn.broken = true
+		return err
+	}
+
+	return nil
+}
+
+func (cn *conn) readReplies(cmds ...Cmder) error {
+	for _, cmd := range cmds {
+		if !cn.prompted {
+			cn.prompted = true
+			if err := cn.skipPrompt(); err != nil {
+				cn.broken = true
+				return err
+			}
+		}
+		r, err := reply.Read(cn.reader)
+		if err != nil {
+			cn.broken = true
+			return err
+		}
+		cmd.setReply(r)
+	}
+
+	return nil
+}
+
+// skipPrompt reads the password prompt if it comes next, replies start with
+// one of "+-:$*" and the prompt does not
+func (cn *conn) skipPrompt() error {
+	first, err := cn.reader.Peek(1)
+	if err != nil {
+		return err
+	}
+	if strings.IndexByte("+-:$*", first[0]) != -1 {
+		return nil
+	}
+
+	line, err := cn.readLine()
+	if err != nil {
+		return err
+	}
+	if line != authPrompt {
+		return ErrUnexpectedReply
+	}
+	return nil
+}
+
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// healthy checks that the server has not closed the idle connection, it
+// sends nothing unless asked, so any readable data means the stream is broken
+func (cn *conn) healthy() bool {
+	// the password prompt may not have been read yet
+	if !cn.prompted {
+		return true
+	}
+	if cn.reader.Buffered() != 0 {
+		return false
+	}
+
+	cn.netConn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	_, err := cn.reader.Peek(1)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+func (cn *conn) close() error {
+	return cn.netConn.Close()
+}
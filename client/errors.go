@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"redis_like_in_memory_db/internal/reply"
+)
+
+// Nil is returned by commands reading a single value when it does not exist
+// or has expired
+var Nil = errors.New("value does not exist")
+
+// Errors matching error replies of the server, compare them with ==. They are
+// the values the server replies with, so code and message are defined once
+var (
+	ErrAuthRequired    error = reply.ErrAuthRequired
+	ErrWrongPassword   error = reply.ErrWrongPassword
+	ErrWrongType       error = reply.ErrWrongType
+	ErrNoSuchKey       error = reply.ErrNoSuchKey
+	ErrSameKeys        error = reply.ErrSameKeys
+	ErrSyntax          error = reply.ErrSyntax
+	ErrWrongArgsNumber error = reply.ErrWrongArgsNumber
+	ErrUnknownCommand  error = reply.ErrUnknownCommand
+	ErrOutOfMemory     error = reply.ErrOutOfMemory
+	ErrShuttingDown    error = reply.ErrShuttingDown
+	ErrMaxClients      error = reply.ErrMaxClients
+	ErrRequestTooLarge error = reply.ErrRequestTooLarge
+	ErrInvalidDBIndex  error = reply.ErrInvalidDBIndex
+	ErrDBOutOfRange    error = reply.ErrDBOutOfRange
+	ErrInvalidCursor   error = reply.ErrInvalidCursor
+	ErrKeyNotExists    error = reply.ErrKeyNotExists
+	ErrListNotExists   error = reply.ErrListNotExists
+	ErrIndexOutOfRange error = reply.ErrIndexOutOfRange
+	ErrDictNotExists   error = reply.ErrDictNotExists
+	ErrDictKeyNotFound error = reply.ErrDictKeyNotFound
+	ErrDictKeyExpired  error = reply.ErrDictKeyExpired
+	ErrNoScript        error = reply.ErrNoScript
+	ErrScriptKilled    error = reply.ErrScriptKilled
+	ErrScriptTimedOut  error = reply.ErrScriptTimedOut
+	ErrNoSnapshotFile  error = reply.ErrNoSnapshotFile
+	ErrTXLogDisabled   error = reply.ErrTXLogDisabled
+	ErrUnexpectedReply       = errors.New("unexpected reply")
+	ErrClosed                = errors.New("client is closed")
+	// transactions run as scripts, which may only touch declared keys
+	ErrNoKeys             = errors.New("commands without keys can not be executed in a transaction")
+	errUnexpectedGreeting = errors.New("unexpected greeting of the server")
+)
+
+// ReplyError is an error reply which has no dedicated value
+type ReplyError struct {
+	// first word of the reply, like ERR or WRONGTYPE
+	Code    string
+	Message string
+}
+
+func (err *ReplyError) Error() string {
+	return err.Message
+}
+
+// PermissionError is returned when the ACL user may not run the command or
+// access one of its keys
+type PermissionError struct {
+	Message string
+}
+
+func (err *PermissionError) Error() string {
+	return err.Message
+}
+
+// replyError returns the error of an error reply, known messages are
+// returned as their errors
+func replyError(r reply.Reply) error {
+	if err, ok := reply.KnownError(r); ok {
+		return err
+	}
+	if r.Code == reply.CodeNoPerm {
+		return &PermissionError{Message: r.Value}
+	}
+
+	return &ReplyError{Code: r.Code, Message: r.Value}
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"redis_like_in_memory_db/internal/reply"
+)
+
+// Monitor streams commands executed by the server to fn until the context is
+// done or the connection fails. It uses a connection of its own which is
+// closed afterwards, the context error is returned once it is cancelled
+func (c *Client) Monitor(ctx context.Context, fn func(line string)) error {
+	cn, err := dial(ctx, c.opt)
+	if err != nil {
+		return err
+	}
+	defer cn.close()
+
+	cmd := newStatusCmd(noKeys, "MONITOR")
+	if err := cn.withContext(ctx, c.opt.Timeout, func() error { return cn.roundTrip(cmd) }); err != nil {
+		return err
+	}
+	if err := cmd.Err(); err != nil {
+		return err
+	}
+
+	return cn.withContext(ctx, 0, func() error {
+		for {
+			line, err := reply.Read(cn.reader)
+			if err != nil {
+				return err
+			}
+			fn(line.Value)
+		}
+	})
+}
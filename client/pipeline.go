@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+)
+
+// txScript executes commands packed as ARGV = count, args..., count, args...
+// and returns their replies encoded by the length prefixed protocol, a
+// permission error stops it
+const txScript = `local function encode(reply)
+	if reply == false then
+		return "$-1\r\n"
+	elseif type(reply) ~= "table" then
+		return "$" .. #reply .. "\r\n" .. reply .. "\r\n"
+	elseif reply.err then
+		return "-" .. string.gsub(reply.err, "[\r\n]", " ") .. "\r\n"
+	end
+	local items = {"*" .. #reply .. "\r\n"}
+	for _, item in ipairs(reply) do
+		items[#items + 1] = encode(item)
+	end
+	return table.concat(items)
+end
+
+local replies, i = {}, 1
+while i <= #ARGV do
+	local n = tonumber(ARGV[i])
+	local reply = redis.pcall(unpack(ARGV, i + 1, i + n))
+	if type(reply) == "table" and reply.err and string.sub(reply.err, 1, 7) == "NOPERM " then
+		return reply
+	end
+	replies[#replies + 1] = encode(reply)
+	i = i + n + 1
+end
+return table.concat(replies)`
+
+// Pipeline queues commands and sends them at once on Exec, the server
+// answers them in order without waiting for the client
+type Pipeline struct {
+	cmdable
+	client *Client
+	cmds   []Cmder
+}
+
+func (c *Client) Pipeline() *Pipeline {
+	pipe := &Pipeline{client: c, cmds: make([]Cmder, 0)}
+	pipe.cmdable = pipe.queue
+	return pipe
+}
+
+// Pipelined queues commands of fn and executes them
+func (c *Client) Pipelined(ctx context.Context, fn func(*Pipeline) error) ([]Cmder, error) {
+	pipe := c.Pipeline()
+	if err := fn(pipe); err != nil {
+		return nil, err
+	}
+
+	return pipe.Exec(ctx)
+}
+
+func (pipe *Pipeline) queue(ctx context.Context, cmd Cmder) error {
+	pipe.cmds = append(pipe.cmds, cmd)
+	return nil
+}
+
+// Len returns the number of queued commands
+func (pipe *Pipeline) Len() int {
+	return len(pipe.cmds)
+}
+
+// Exec executes queued commands and returns them with the first error, the
+// pipeline is empty afterwards
+func (pipe *Pipeline) Exec(ctx context.Context) ([]Cmder, error) {
+	cmds := pipe.cmds
+	pipe.cmds = make([]Cmder, 0)
+	if len(cmds) == 0 {
+		return cmds, nil
+	}
+
+	return cmds, pipe.client.processCmds(ctx, cmds)
+}
+
+// Tx queues commands and executes them atomically on Exec: no command of
+// other clients runs in between. They are executed by a script, so like in
+// scripts a command failing ACL checks stops the rest while the previous
+// ones stay applied, and every command has to name its keys
+type Tx struct {
+	cmdable
+	client *Client
+	cmds   []Cmder
+}
+
+func (c *Client) TxPipeline() *Tx {
+	tx := &Tx{client: c, cmds: make([]Cmder, 0)}
+	tx.cmdable = tx.queue
+	return tx
+}
+
+// TxPipelined queues commands of fn and executes them atomically
+func (c *Client) TxPipelined(ctx context.Context, fn func(*Tx) error) ([]Cmder, error) {
+	tx := c.TxPipeline()
+	if err := fn(tx); err != nil {
+		return nil, err
+	}
+
+	return tx.Exec(ctx)
+}
+
+func (tx *Tx) queue(ctx context.Context, cmd Cmder) error {
+	tx.cmds = append(tx.cmds, cmd)
+	return nil
+}
+
+func (tx *Tx) Len() int {
+	return len(tx.cmds)
+}
+
+// Exec executes queued commands and returns them with the first error, the
+// transaction is empty afterwards
+func (tx *Tx) Exec(ctx context.Context) ([]Cmder, error) {
+	cmds := tx.cmds
+	tx.cmds = make([]Cmder, 0)
+	if len(cmds) == 0 {
+		return cmds, nil
+	}
+
+	keys := make([]string, 0)
+	declared := make(map[string]bool)
+	argv := make([]string, 0)
+	for _, cmd := range cmds {
+		cmdKeys := cmd.keys()
+		if len(cmdKeys) == 0 {
+			return cmds, setErr(cmds, ErrNoKeys)
+		}
+		for _, key := range cmdKeys {
+			if !declared[key] {
+				declared[key] = true
+				keys = append(keys, key)
+			}
+		}
+		argv = append(argv, strconv.Itoa(len(cmd.Args())))
+		argv = append(argv, cmd.Args()...)
+	}
+
+	args := append([]string{"EVAL", txScript, strconv.Itoa(len(keys))}, keys...)
+	eval := newCmd(noKeys, append(args, argv...)...)
+	// the script fails on permission errors
+	if err := tx.client.process(ctx, eval); err != nil {
+		return cmds, setErr(cmds, err)
+	}
+
+	replies := bufio.NewReader(strings.NewReader(eval.Val()))
+	for _, cmd := range cmds {
+		r, err := reply.Read(replies)
+		if err != nil {
+			return cmds, setErr(cmds, ErrUnexpectedReply)
+		}
+		cmd.setReply(r)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return cmds, err
+		}
+	}
+	return cmds, nil
+}
+
+func setErr(cmds []Cmder, err error) error {
+	for _, cmd := range cmds {
+		cmd.setErr(err)
+	}
+
+	return err
+}
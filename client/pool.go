@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// idle connections are checked before reuse if they waited longer than it
+const healthCheckAge = time.Second
+
+// PoolStats describes connections of the pool
+type PoolStats struct {
+	TotalConns int
+	IdleConns  int
+}
+
+// pool keeps up to size connections, callers wait for a free one once all of
+// them are taken
+type pool struct {
+	opt *Options
+	// a token is taken for every connection in use or being dialed
+	tokens chan struct{}
+
+	mu     sync.Mutex
+	idle   []*conn
+	total  int
+	closed bool
+}
+
+func newPool(opt *Options) *pool {
+	return &pool{opt: opt, tokens: make(chan struct{}, opt.PoolSize), idle: make([]*conn, 0)}
+}
+
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	select {
+	case p.tokens <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			<-p.tokens
+			return nil, ErrClosed
+		}
+		if len(p.idle) == 0 {
+			p.total++
+			p.mu.Unlock()
+			break
+		}
+		cn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		age := time.Since(cn.usedAt)
+		if p.opt.IdleTimeout > 0 && age > p.opt.IdleTimeout || age > healthCheckAge && !cn.healthy() {
+			p.remove(cn)
+			continue
+		}
+		return cn, nil
+	}
+
+	cn, err := dial(ctx, p.opt)
+	if err != nil {
+		p.mu.Lock()
+		p.total--
+		p.mu.Unlock()
+		<-p.tokens
+		return nil, err
+	}
+	return cn, nil
+}
+
+// put returns the connection, broken ones are closed
+func (p *pool) put(cn *conn) {
+	p.mu.Lock()
+	if cn.broken || p.closed {
+		p.total--
+		p.mu.Unlock()
+		cn.close()
+	} else {
+		p.idle = append(p.idle, cn)
+		p.mu.Unlock()
+	}
+	<-p.tokens
+}
+
+// remove closes an idle connection taken out of the list
+func (p *pool) remove(cn *conn) {
+	p.mu.Lock()
+	p.total--
+	p.mu.Unlock()
+	cn.close()
+}
+
+func (p *pool) stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolStats{TotalConns: p.total, IdleConns: len(p.idle)}
+}
+
+// close closes idle connections, connections in use are closed once returned
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	p.closed = true
+
+	var firstErr error
+	for _, cn := range p.idle {
+		if err := cn.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.total -= len(p.idle)
+	p.idle = nil
+	return firstErr
+}
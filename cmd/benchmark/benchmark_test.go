@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net"
+	"redis_like_in_memory_db/client"
+	"redis_like_in_memory_db/internal/global_cache"
+	"redis_like_in_memory_db/internal/server"
+	"testing"
+	"time"
+)
+
+func TestWorkload(t *testing.T) {
+	{
+		t.Log("Mix and sizes should be parsed and validated")
+		commands, err := parseMix("get:3, SET")
+		assert.NoError(t, err)
+		assert.Equal(t, []weightedCommand{{name: "GET", weight: 3}, {name: "SET", weight: 1}}, commands)
+		_, err = parseMix("GET:0")
+		assert.Equal(t, invalidMix, err)
+		_, err = parseMix("DEL:1")
+		assert.Error(t, err)
+
+		minSize, maxSize, err := parseSize("16-1024")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{16, 1024}, []int{minSize, maxSize})
+		_, _, err = parseSize("64-16")
+		assert.Equal(t, invalidSize, err)
+	}
+
+	{
+		t.Log("Commands should stay within the key space and value sizes")
+		w, err := newWorkload("SET:1,DSET:1", "4-8", 10, 2, "1h")
+		assert.NoError(t, err)
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 100; i++ {
+			args := w.next(r)
+			value := args[len(args)-2]
+			assert.True(t, len(value) >= 4 && len(value) <= 8)
+			assert.Contains(t, []string{"SET", "DSET"}, args[0])
+		}
+		// reads are not in the mix, but writes are filled anyway
+		assert.Len(t, w.prefill(r), 10+10*2)
+	}
+
+	{
+		t.Log("Percentiles should be estimated within 5% and errors counted by commands")
+		res := newResults()
+		for i := 1; i <= 1000; i++ {
+			res.add("GET", time.Duration(i)*time.Millisecond, false)
+			res.add("SET", time.Millisecond, i%10 == 0)
+		}
+		summaries := res.summaries()
+		get, set := summaries[0], summaries[1]
+		assert.InEpsilon(t, float64(500*time.Millisecond), float64(get.p50), 0.05)
+		assert.InEpsilon(t, float64(990*time.Millisecond), float64(get.p99), 0.05)
+		assert.Equal(t, time.Second, get.max)
+		assert.True(t, get.p999 <= get.max)
+		assert.Equal(t, 0, get.errors)
+		assert.Equal(t, 100, set.errors)
+		assert.Equal(t, 2000, summaries[2].requests)
+	}
+}
+
+func TestBenchmark_Run(t *testing.T) {
+	w, err := newWorkload("GET:1,SET:1,ZSET:1,DGET:1", "16", 100, 4, "1h")
+	assert.NoError(t, err)
+
+	{
+		t.Log("All requests should be executed in process, the last pipeline may be shorter")
+		cache := global_cache.NewCache(4, false)
+		b := &benchmark{workload: w, executor: &inProcessExecutor{cache: cache}, clients: 3, pipeline: 7, requests: 1000}
+		res, err := b.run(context.Background())
+		assert.NoError(t, err)
+		summaries := res.summaries()
+		all := summaries[len(summaries)-1]
+		assert.Equal(t, "ALL", all.name)
+		assert.Equal(t, 1000, all.requests)
+		assert.Equal(t, 0, all.errors)
+		assert.True(t, all.p50 <= all.p99 && all.p99 <= all.p999 && all.p999 <= all.max)
+	}
+
+	{
+		t.Log("Requests should be sent over the network within the duration")
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+		go server.NewServer("", false, false, "", 4, 4, "").Serve(listener)
+		c := client.NewClient(&client.Options{Addr: listener.Addr().String(), PoolSize: 2})
+		defer c.Close()
+
+		exec := &networkExecutor{client: c}
+		assert.NoError(t, fill(context.Background(), exec, w))
+		assert.Equal(t, "4", c.Do(context.Background(), "DLEN", "bench:dict:99").Val())
+
+		b := &benchmark{workload: w, executor: exec, clients: 2, pipeline: 4, requests: 1, duration: 200 * time.Millisecond}
+		res, err := b.run(context.Background())
+		assert.NoError(t, err)
+		summaries := res.summaries()
+		assert.Len(t, summaries, 5)
+		assert.True(t, summaries[len(summaries)-1].requests > 1)
+		assert.Equal(t, 0, summaries[len(summaries)-1].errors)
+	}
+}
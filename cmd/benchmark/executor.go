@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"redis_like_in_memory_db/client"
+	"redis_like_in_memory_db/internal/global_cache"
+)
+
+// executor runs a batch of commands and reports which of them got error
+// replies, an error means the benchmark can not go on
+type executor interface {
+	execute(ctx context.Context, batch [][]string) ([]bool, error)
+}
+
+// networkExecutor pipelines batches to a running server
+type networkExecutor struct {
+	client *client.Client
+}
+
+func (e *networkExecutor) execute(ctx context.Context, batch [][]string) ([]bool, error) {
+	pipe := e.client.Pipeline()
+	for _, args := range batch {
+		pipe.Do(ctx, args...)
+	}
+	cmds, _ := pipe.Exec(ctx)
+
+	failed := make([]bool, len(batch))
+	for i, cmd := range cmds {
+		err := cmd.Err()
+		if err == nil || err == client.Nil {
+			continue
+		}
+		var netErr net.Error
+		if err == io.EOF || err == client.ErrClosed || errors.As(err, &netErr) || errors.Is(err, context.Canceled) {
+			return failed, err
+		}
+		failed[i] = true
+	}
+
+	return failed, nil
+}
+
+// inProcessExecutor calls the cache directly, it has no network and parsing
+// overhead, so it is the one to profile the cache with
+type inProcessExecutor struct {
+	cache *global_cache.GlobalCache
+}
+
+func (e *inProcessExecutor) execute(ctx context.Context, batch [][]string) ([]bool, error) {
+	failed := make([]bool, len(batch))
+	session := &global_cache.Session{}
+	for i, args := range batch {
+		failed[i] = e.cache.Execute(session, args).IsError()
+	}
+
+	return failed, nil
+}
@@ -0,0 +1,205 @@
+// benchmark measures throughput and latencies of the server. It drives a
+// running server over the network or, with -inprocess, the cache directly,
+// which is the mode to profile the cache with.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"redis_like_in_memory_db/client"
+	"redis_like_in_memory_db/internal/global_cache"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// commands sent at once while filling the key space
+const prefillBatchSize = 1000
+
+// options of a run set by flags
+type options struct {
+	host, port, socket string
+	user, password     string
+	clients            int
+	requests           int64
+	duration           time.Duration
+	pipeline           int
+	keyspace, fields   int
+	size, mix, ttl     string
+	prefill            bool
+	inProcess          bool
+	numBuckets         int
+	cpuProfile         string
+	memProfile         string
+}
+
+func main() {
+	opt := options{}
+	flag.StringVar(&opt.host, "host", "127.0.0.1", "Server host")
+	flag.StringVar(&opt.port, "port", "8000", "Server port")
+	flag.StringVar(&opt.socket, "socket", "", "Unix socket path, overrides host and port")
+	flag.StringVar(&opt.user, "user", "", "ACL user, the default one when empty")
+	flag.StringVar(&opt.password, "a", "", "Password to authenticate with")
+	flag.IntVar(&opt.clients, "c", 50, "Number of parallel clients")
+	flag.Int64Var(&opt.requests, "n", 100000, "Total number of requests")
+	flag.DurationVar(&opt.duration, "d", 0, "Run for the duration instead of -n requests")
+	flag.IntVar(&opt.pipeline, "P", 1, "Number of requests sent at once by a client")
+	flag.IntVar(&opt.keyspace, "r", 10000, "Number of keys of every family")
+	flag.IntVar(&opt.fields, "fields", 10, "Number of dictionary fields and list values read by DGET and ZGET")
+	flag.StringVar(&opt.size, "size", "16", "Value size in bytes or a range like 16-1024")
+	flag.StringVar(&opt.mix, "mix", "GET:50,SET:30,ZSET:10,DSET:10", "Weighted commands of GET, SET, ZGET, ZSET, DGET, DSET")
+	flag.StringVar(&opt.ttl, "ttl", "1h", "TTL of written values")
+	flag.BoolVar(&opt.prefill, "prefill", false, "Write every key of the key space before the run, so reads hit")
+	flag.BoolVar(&opt.inProcess, "inprocess", false, "Benchmark the cache in this process instead of a server")
+	flag.IntVar(&opt.numBuckets, "num_buckets", 32, "Number of buckets for each type of bucket with -inprocess")
+	flag.StringVar(&opt.cpuProfile, "cpuprofile", "", "Write the CPU profile of the run to the file")
+	flag.StringVar(&opt.memProfile, "memprofile", "", "Write the heap profile after the run to the file")
+	flag.Parse()
+
+	if err := run(&opt); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(opt *options) error {
+	if opt.clients < 1 || opt.pipeline < 1 || opt.requests < 1 {
+		return errors.New("clients, pipeline and requests should be positive")
+	}
+	w, err := newWorkload(opt.mix, opt.size, opt.keyspace, opt.fields, opt.ttl)
+	if err != nil {
+		return err
+	}
+
+	var exec executor
+	target := ""
+	if opt.inProcess {
+		exec = &inProcessExecutor{cache: global_cache.NewCache(opt.numBuckets, false)}
+		target = fmt.Sprintf("in-process cache with %d buckets", opt.numBuckets)
+	} else {
+		clientOpt := &client.Options{
+			Addr:     net.JoinHostPort(opt.host, opt.port),
+			Username: opt.user,
+			Password: opt.password,
+			PoolSize: opt.clients,
+		}
+		if opt.socket != "" {
+			clientOpt.Network, clientOpt.Addr = "unix", opt.socket
+		}
+		c := client.NewClient(clientOpt)
+		defer c.Close()
+		exec = &networkExecutor{client: c}
+		target = clientOpt.Addr
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if opt.prefill {
+		if err := fill(ctx, exec, w); err != nil {
+			return err
+		}
+	}
+
+	if opt.cpuProfile != "" {
+		file, err := os.Create(opt.cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := pprof.StartCPUProfile(file); err != nil {
+			return err
+		}
+	}
+	b := &benchmark{
+		workload: w,
+		executor: exec,
+		clients:  opt.clients,
+		pipeline: opt.pipeline,
+		requests: opt.requests,
+		duration: opt.duration,
+	}
+	res, err := b.run(ctx)
+	if opt.cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s, %d clients, pipeline %d, %d keys, values of %s bytes, %s\n",
+		target, opt.clients, opt.pipeline, opt.keyspace, opt.size, res.elapsed.Round(time.Millisecond))
+	printSummaries(res.summaries())
+	if opt.inProcess {
+		printMemory()
+	}
+
+	if opt.memProfile != "" {
+		file, err := os.Create(opt.memProfile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		runtime.GC()
+		return pprof.WriteHeapProfile(file)
+	}
+	return nil
+}
+
+// fill writes keys read by the mix in pipelined batches
+func fill(ctx context.Context, exec executor, w *workload) error {
+	commands := w.prefill(rand.New(rand.NewSource(time.Now().UnixNano())))
+	for start := 0; start < len(commands); start += prefillBatchSize {
+		end := start + prefillBatchSize
+		if end > len(commands) {
+			end = len(commands)
+		}
+		failed, err := exec.execute(ctx, commands[start:end])
+		if err != nil {
+			return err
+		}
+		for i, ok := range failed {
+			if ok {
+				return fmt.Errorf("%s failed while filling the key space", commands[start+i][0])
+			}
+		}
+	}
+
+	return nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func printSummaries(summaries []summary) {
+	fmt.Printf("%-8s %10s %8s %12s %9s %9s %9s %9s %9s\n",
+		"command", "requests", "errors", "rps", "avg ms", "p50 ms", "p99 ms", "p999 ms", "max ms")
+	for _, s := range summaries {
+		fmt.Printf("%-8s %10d %8d %12.2f %9.3f %9.3f %9.3f %9.3f %9.3f\n", s.name, s.requests, s.errors, s.throughput,
+			milliseconds(s.avg), milliseconds(s.p50), milliseconds(s.p99), milliseconds(s.p999), milliseconds(s.max))
+	}
+}
+
+func printMemory() {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	fmt.Printf("heap alloc: %d, heap in use: %d, sys: %d, total alloc: %d, gc runs: %d\n",
+		memStats.HeapAlloc, memStats.HeapInuse, memStats.Sys, memStats.TotalAlloc, memStats.NumGC)
+}
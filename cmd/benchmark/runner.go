@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"redis_like_in_memory_db/internal/metrics"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are bounds of latency histograms in seconds, from a
+// microsecond to minutes, each 5% above the previous one
+var latencyBuckets = metrics.ExponentialBuckets(.000001, 1.05, 400)
+
+// latencies and error replies of a command
+type commandStats struct {
+	latency *metrics.Histogram
+	max     time.Duration
+	errors  int
+}
+
+func newCommandStats() *commandStats {
+	return &commandStats{latency: metrics.NewHistogram(latencyBuckets)}
+}
+
+func (stats *commandStats) merge(other *commandStats) {
+	stats.latency.Merge(other.latency)
+	if other.max > stats.max {
+		stats.max = other.max
+	}
+	stats.errors += other.errors
+}
+
+// results of a run by command names
+type results struct {
+	commands map[string]*commandStats
+	elapsed  time.Duration
+}
+
+func newResults() *results {
+	return &results{commands: make(map[string]*commandStats)}
+}
+
+func (r *results) stats(name string) *commandStats {
+	stats, ok := r.commands[name]
+	if !ok {
+		stats = newCommandStats()
+		r.commands[name] = stats
+	}
+
+	return stats
+}
+
+func (r *results) add(name string, latency time.Duration, failed bool) {
+	stats := r.stats(name)
+	stats.latency.Observe(latency)
+	if latency > stats.max {
+		stats.max = latency
+	}
+	if failed {
+		stats.errors++
+	}
+}
+
+func (r *results) merge(other *results) {
+	for name, stats := range other.commands {
+		r.stats(name).merge(stats)
+	}
+}
+
+// benchmark describes a run: clients send pipelines of the given depth
+// until requests are sent or the duration is over
+type benchmark struct {
+	workload *workload
+	executor executor
+	clients  int
+	pipeline int
+	requests int64
+	duration time.Duration
+}
+
+// run executes the benchmark until it is over or the context is cancelled, a
+// command of a pipeline is given the latency of the whole pipeline
+func (b *benchmark) run(ctx context.Context) (*results, error) {
+	if b.duration > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, b.duration)
+		defer cancel()
+	}
+
+	var (
+		issued int64
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		total  = newResults()
+		failed error
+	)
+	start := time.Now()
+	for i := 0; i < b.clients; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			worker := newResults()
+			err := b.work(ctx, r, &issued, worker)
+
+			mu.Lock()
+			total.merge(worker)
+			if err != nil && failed == nil {
+				failed = err
+			}
+			mu.Unlock()
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	total.elapsed = time.Since(start)
+
+	return total, failed
+}
+
+func (b *benchmark) work(ctx context.Context, r *rand.Rand, issued *int64, worker *results) error {
+	batch := make([][]string, 0, b.pipeline)
+	for ctx.Err() == nil {
+		size := int64(b.pipeline)
+		if b.duration <= 0 {
+			// requests are claimed by pipelines, the last one may be shorter
+			claimed := atomic.AddInt64(issued, size)
+			if claimed-size >= b.requests {
+				return nil
+			}
+			if claimed > b.requests {
+				size -= claimed - b.requests
+			}
+		}
+
+		batch = batch[:0]
+		for i := int64(0); i < size; i++ {
+			batch = append(batch, b.workload.next(r))
+		}
+		start := time.Now()
+		failed, err := b.executor.execute(ctx, batch)
+		if err != nil {
+			// the connection deadline may pass before the context notices it
+			if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+		latency := time.Since(start)
+		for i, args := range batch {
+			worker.add(args[0], latency, failed[i])
+		}
+	}
+
+	return nil
+}
+
+// summary holds statistics of a command computed from its latencies
+type summary struct {
+	name                string
+	requests, errors    int
+	throughput          float64
+	avg, p50, p99, p999 time.Duration
+	max                 time.Duration
+}
+
+// summarize estimates percentiles from the latency histogram, they are kept
+// within the largest latency
+func summarize(name string, stats *commandStats, elapsed time.Duration) summary {
+	requests := int(stats.latency.Count())
+	s := summary{name: name, requests: requests, errors: stats.errors, max: stats.max}
+	if requests == 0 {
+		return s
+	}
+	s.avg = stats.latency.Sum() / time.Duration(requests)
+	s.p50 = s.percentile(stats.latency, 0.5)
+	s.p99 = s.percentile(stats.latency, 0.99)
+	s.p999 = s.percentile(stats.latency, 0.999)
+	if elapsed > 0 {
+		s.throughput = float64(requests) / elapsed.Seconds()
+	}
+
+	return s
+}
+
+func (s summary) percentile(latency *metrics.Histogram, p float64) time.Duration {
+	if value := latency.Quantile(p); value < s.max {
+		return value
+	}
+	return s.max
+}
+
+// summaries returns statistics of every command sorted by names and of all
+// of them together
+func (r *results) summaries() []summary {
+	names := make([]string, 0, len(r.commands))
+	all := newCommandStats()
+	for name, stats := range r.commands {
+		names = append(names, name)
+		all.merge(stats)
+	}
+	sort.Strings(names)
+
+	result := make([]summary, 0, len(names)+1)
+	for _, name := range names {
+		result = append(result, summarize(name, r.commands[name], r.elapsed))
+	}
+	return append(result, summarize("ALL", all, r.elapsed))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	invalidMix  = errors.New("mix should look like GET:50,SET:50 with positive weights")
+	invalidSize = errors.New("size should be a number of bytes or a range like 16-1024")
+)
+
+// benchmarked commands, the name is the family of keys they touch
+var commandFamilies = map[string]string{
+	"GET":  "string",
+	"SET":  "string",
+	"ZGET": "list",
+	"ZSET": "list",
+	"DGET": "dict",
+	"DSET": "dict",
+}
+
+// writers fill keys of a family before reads of it are benchmarked
+var familyWriters = map[string]string{
+	"string": "SET",
+	"list":   "ZSET",
+	"dict":   "DSET",
+}
+
+type weightedCommand struct {
+	name   string
+	weight int
+}
+
+// workload generates commands of the mix against keys of the key space
+type workload struct {
+	commands    []weightedCommand
+	totalWeight int
+	keyspace    int
+	// fields of every dictionary and values of every list
+	fields           int
+	minSize, maxSize int
+	ttl              string
+	// random letters values are cut from
+	letters string
+}
+
+func newWorkload(mix, size string, keyspace, fields int, ttl string) (*workload, error) {
+	commands, err := parseMix(mix)
+	if err != nil {
+		return nil, err
+	}
+	minSize, maxSize, err := parseSize(size)
+	if err != nil {
+		return nil, err
+	}
+	if keyspace < 1 || fields < 1 {
+		return nil, errors.New("key space and fields should be positive")
+	}
+
+	w := &workload{commands: commands, keyspace: keyspace, fields: fields, minSize: minSize, maxSize: maxSize, ttl: ttl}
+	for _, command := range commands {
+		w.totalWeight += command.weight
+	}
+	letters := make([]byte, 2*maxSize)
+	for i := range letters {
+		letters[i] = byte('a' + rand.Intn(26))
+	}
+	w.letters = string(letters)
+
+	return w, nil
+}
+
+// parseMix parses weights like GET:50,SET:50, a command without a weight
+// weighs 1
+func parseMix(mix string) ([]weightedCommand, error) {
+	commands := make([]weightedCommand, 0)
+	for _, part := range strings.Split(mix, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weight := part, 1
+		if separator := strings.Index(part, ":"); separator != -1 {
+			name = part[:separator]
+			value, err := strconv.Atoi(part[separator+1:])
+			if err != nil || value < 1 {
+				return nil, invalidMix
+			}
+			weight = value
+		}
+		name = strings.ToUpper(name)
+		if _, ok := commandFamilies[name]; !ok {
+			return nil, fmt.Errorf("command %s is not supported, use one of %s", name, supportedCommands())
+		}
+		commands = append(commands, weightedCommand{name: name, weight: weight})
+	}
+	if len(commands) == 0 {
+		return nil, invalidMix
+	}
+
+	return commands, nil
+}
+
+func supportedCommands() string {
+	names := make([]string, 0, len(commandFamilies))
+	for name := range commandFamilies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// parseSize parses a size in bytes or a range of sizes like 16-1024
+func parseSize(size string) (int, int, error) {
+	bounds := strings.SplitN(size, "-", 2)
+	minSize, err := strconv.Atoi(bounds[0])
+	if err != nil || minSize < 1 {
+		return 0, 0, invalidSize
+	}
+	maxSize := minSize
+	if len(bounds) == 2 {
+		if maxSize, err = strconv.Atoi(bounds[1]); err != nil || maxSize < minSize {
+			return 0, 0, invalidSize
+		}
+	}
+
+	return minSize, maxSize, nil
+}
+
+// next returns a random command of the mix
+func (w *workload) next(r *rand.Rand) []string {
+	choice := r.Intn(w.totalWeight)
+	for _, command := range w.commands {
+		if choice < command.weight {
+			return w.command(r, command.name, r.Intn(w.keyspace))
+		}
+		choice -= command.weight
+	}
+
+	return nil
+}
+
+// command returns arguments of the command against the key
+func (w *workload) command(r *rand.Rand, name string, key int) []string {
+	switch name {
+	case "GET":
+		return []string{name, w.key("string", key)}
+	case "SET":
+		return []string{name, w.key("string", key), w.value(r), w.ttl}
+	case "ZGET":
+		return []string{name, w.key("list", key), strconv.Itoa(r.Intn(w.fields))}
+	case "ZSET":
+		return []string{name, w.key("list", key), w.value(r), w.ttl}
+	case "DGET":
+		return []string{name, w.key("dict", key), w.field(r)}
+	case "DSET":
+		return []string{name, w.key("dict", key), w.field(r), w.value(r), w.ttl}
+	}
+
+	return nil
+}
+
+func (w *workload) key(family string, key int) string {
+	return fmt.Sprintf("bench:%s:%d", family, key)
+}
+
+func (w *workload) field(r *rand.Rand) string {
+	return "field:" + strconv.Itoa(r.Intn(w.fields))
+}
+
+func (w *workload) value(r *rand.Rand) string {
+	size := w.minSize
+	if w.maxSize > w.minSize {
+		size += r.Intn(w.maxSize - w.minSize + 1)
+	}
+	start := r.Intn(len(w.letters) - size + 1)
+
+	return w.letters[start : start+size]
+}
+
+// prefill returns commands writing every key read by the mix, lists get
+// fields values and dictionaries fields keys, so reads find them
+func (w *workload) prefill(r *rand.Rand) [][]string {
+	families := make(map[string]bool)
+	for _, command := range w.commands {
+		families[commandFamilies[command.name]] = true
+	}
+
+	commands := make([][]string, 0)
+	for _, family := range []string{"string", "list", "dict"} {
+		if !families[family] {
+			continue
+		}
+		writer := familyWriters[family]
+		for key := 0; key < w.keyspace; key++ {
+			switch family {
+			case "string":
+				commands = append(commands, w.command(r, writer, key))
+			case "list":
+				for i := 0; i < w.fields; i++ {
+					commands = append(commands, w.command(r, writer, key))
+				}
+			case "dict":
+				for i := 0; i < w.fields; i++ {
+					commands = append(commands, []string{writer, w.key(family, key), "field:" + strconv.Itoa(i), w.value(r), w.ttl})
+				}
+			}
+		}
+	}
+
+	return commands
+}
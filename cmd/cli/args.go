@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var invalidArguments = errors.New("Invalid argument(s)")
+
+// commands with subcommands, the subcommand is upper cased as well
+var containerCommands = map[string]bool{
+	"ACL":      true,
+	"CLIENT":   true,
+	"CONFIG":   true,
+	"FUNCTION": true,
+	"LATENCY":  true,
+	"SCRIPT":   true,
+	"SLOWLOG":  true,
+}
+
+// splitArgs splits a line into arguments. Arguments in double quotes may
+// contain spaces and escapes like \n, \" or \x00, in single quotes only \'
+// is an escape
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var arg strings.Builder
+		quote := rune(0)
+	scan:
+		for ; i < len(runes); i++ {
+			r := runes[i]
+			switch {
+			case quote == 0 && unicode.IsSpace(r):
+				break scan
+			case quote == 0 && (r == '"' || r == '\''):
+				quote = r
+			case quote == 0:
+				arg.WriteRune(r)
+
+			case r == quote:
+				quote = 0
+				// a closing quote has to end the argument
+				if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+					return nil, invalidArguments
+				}
+			case r == '\\' && i+1 < len(runes) && quote == '\'':
+				if runes[i+1] == '\'' {
+					i++
+				}
+				arg.WriteRune(runes[i])
+			case r == '\\' && i+1 < len(runes):
+				i++
+				escaped, size, ok := unescape(runes[i:])
+				if !ok {
+					return nil, invalidArguments
+				}
+				arg.WriteString(escaped)
+				i += size - 1
+			default:
+				arg.WriteRune(r)
+			}
+		}
+		if quote != 0 {
+			return nil, invalidArguments
+		}
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// unescape decodes an escape sequence following a backslash and returns the
+// number of runes it takes
+func unescape(runes []rune) (string, int, bool) {
+	switch runes[0] {
+	case 'n':
+		return "\n", 1, true
+	case 'r':
+		return "\r", 1, true
+	case 't':
+		return "\t", 1, true
+	case 'a':
+		return "\a", 1, true
+	case 'b':
+		return "\b", 1, true
+	case 'x':
+		if len(runes) < 3 {
+			return "", 0, false
+		}
+		value, err := strconv.ParseUint(string(runes[1:3]), 16, 8)
+		if err != nil {
+			return "", 0, false
+		}
+		return string([]byte{byte(value)}), 3, true
+	}
+
+	return string(runes[0]), 1, true
+}
+
+// normalizeArgs upper cases the command and the subcommand, the server only
+// knows them in upper case
+func normalizeArgs(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+
+	normalized := append([]string{}, args...)
+	normalized[0] = strings.ToUpper(normalized[0])
+	if containerCommands[normalized[0]] && len(normalized) > 1 {
+		normalized[1] = strings.ToUpper(normalized[1])
+	}
+
+	return normalized
+}
+
+// hasSecret reports whether the command carries a password, such commands are
+// kept out of the history file
+func hasSecret(args []string) bool {
+	args = normalizeArgs(args)
+	switch {
+	case args[0] == "AUTH":
+		return true
+	case args[0] == "ACL" && len(args) > 1 && args[1] == "SETUSER":
+		return true
+	case args[0] == "CONFIG" && len(args) > 1 && args[1] == "SET":
+		for i := 2; i < len(args); i += 2 {
+			if strings.ToLower(args[i]) == "requirepass" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"redis_like_in_memory_db/client"
+	"strings"
+)
+
+// commands sent to the server at once while loading
+const bulkBatchSize = 1000
+
+// bulkLine is a command of the input with its line number for error messages
+type bulkLine struct {
+	number int
+	args   []string
+}
+
+// bulk executes commands of the file, or stdin for "-", a command per line.
+// Empty lines and lines starting with # are skipped. Commands are pipelined
+// in batches, with summary set only errors and totals are printed
+func (cli *cli) bulk(path string, summary bool) error {
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	batch := make([]bulkLine, 0, bulkBatchSize)
+	total, failed, number := 0, 0, 0
+	flush := func() error {
+		executed, errors, err := cli.executeBatch(ctx, batch, summary)
+		total, failed = total+executed, failed+errors
+		batch = batch[:0]
+		return err
+	}
+
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", number, err)
+			failed++
+			continue
+		}
+		batch = append(batch, bulkLine{number: number, args: normalizeArgs(args)})
+		if len(batch) == bulkBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if summary {
+		fmt.Printf("commands: %d, errors: %d\n", total, failed)
+	}
+	return nil
+}
+
+// executeBatch pipelines commands and prints their replies, errors are
+// printed to stderr with line numbers
+func (cli *cli) executeBatch(ctx context.Context, batch []bulkLine, summary bool) (int, int, error) {
+	if len(batch) == 0 {
+		return 0, 0, nil
+	}
+
+	pipe := cli.client.Pipeline()
+	for _, line := range batch {
+		pipe.Do(ctx, line.args...)
+	}
+	cmds, _ := pipe.Exec(ctx)
+
+	failed := 0
+	for i, cmder := range cmds {
+		cmd := cmder.(*client.Cmd)
+		reply, err := cmd.Result()
+		if err := connectionError(err); err != nil {
+			return i, failed, err
+		}
+		if err != nil && err != client.Nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", batch[i].number, err)
+			continue
+		}
+		if !summary {
+			fmt.Println(cli.format(batch[i].args, reply, cmd.Items(), err))
+		}
+	}
+
+	return len(cmds), failed, nil
+}
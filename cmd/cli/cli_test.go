@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"redis_like_in_memory_db/client"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	{
+		t.Log("Quoted arguments should keep spaces and decode escapes")
+		args, err := splitArgs(`SET  key "hello \"world\"\n" 'it\'s' "\x41"`)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"SET", "key", "hello \"world\"\n", "it's", "A"}, args)
+	}
+
+	{
+		t.Log("Unbalanced quotes and text after a closing quote should be refused")
+		_, err := splitArgs(`SET key "value`)
+		assert.Equal(t, invalidArguments, err)
+		_, err = splitArgs(`SET key "value"x`)
+		assert.Equal(t, invalidArguments, err)
+		_, err = splitArgs(`SET key "\xZZ"`)
+		assert.Equal(t, invalidArguments, err)
+	}
+
+	{
+		t.Log("Commands and subcommands should be upper cased")
+		assert.Equal(t, []string{"CONFIG", "GET", "maxmemory"}, normalizeArgs([]string{"config", "get", "maxmemory"}))
+		assert.Equal(t, []string{"GET", "key"}, normalizeArgs([]string{"get", "key"}))
+	}
+
+	{
+		t.Log("Commands with passwords should be recognized")
+		assert.True(t, hasSecret([]string{"auth", "secret"}))
+		assert.True(t, hasSecret([]string{"acl", "setuser", "alice", ">secret"}))
+		assert.True(t, hasSecret([]string{"config", "set", "maxclients", "10", "REQUIREPASS", "secret"}))
+		assert.False(t, hasSecret([]string{"config", "set", "maxclients", "requirepass"}))
+		assert.False(t, hasSecret([]string{"GET", "auth"}))
+	}
+}
+
+func TestFormatReply(t *testing.T) {
+	{
+		t.Log("Strings should be quoted and errors marked")
+		assert.Equal(t, `"moose"`, formatReply([]string{"GET", "k"}, "moose", nil, nil))
+		assert.Equal(t, "OK", formatReply([]string{"SET", "k", "v", "1h"}, "Success", nil, nil))
+		assert.Equal(t, "(nil)", formatReply([]string{"GET", "k"}, "", nil, client.Nil))
+		assert.Equal(t, "(error) no such key", formatReply([]string{"RENAME", "a", "b"}, "", nil, client.ErrNoSuchKey))
+		assert.Equal(t, "(error) NOPERM denied", formatReply([]string{"GET", "k"}, "", nil, &client.ReplyError{Code: "NOPERM", Message: "denied"}))
+		assert.Equal(t, "(integer) 3", formatReply([]string{"DBSIZE"}, "3", nil, nil))
+	}
+
+	{
+		t.Log("Arrays should be numbered and scans split into the cursor and the page")
+		assert.Equal(t, "1) \"a\"\n2) \"b\"", formatReply([]string{"KEYS", "*"}, "a, b", []string{"a", "b"}, nil))
+		assert.Equal(t, "(empty array)", formatReply([]string{"KEYS", "*"}, "", []string{}, nil))
+		assert.Equal(t, "1) \"7\"\n2) 1) \"a\"\n   2) \"b\"", formatReply([]string{"SCAN", "0"}, "7, a, b", []string{"7", "a", "b"}, nil))
+		assert.Equal(t, "1) \"maxclients\"\n2) \"10\"", formatReply([]string{"CONFIG", "GET", "max*"}, "maxclients, 10", []string{"maxclients", "10"}, nil))
+		assert.Equal(t, "1) \"lib v1: a, b\"", formatReply([]string{"FUNCTION", "LIST"}, "lib v1: a, b", []string{"lib v1: a, b"}, nil))
+	}
+
+	{
+		t.Log("Raw replies should be printed as they are")
+		assert.Equal(t, "a, b", formatRaw("a, b", nil, nil))
+		assert.Equal(t, "a\nb", formatRaw("a, b", []string{"a", "b"}, nil))
+		assert.Equal(t, "", formatRaw("", nil, client.Nil))
+		assert.Equal(t, "ERR no such key", formatRaw("", nil, client.ErrNoSuchKey))
+		assert.Equal(t, "BUSY try later", formatRaw("", nil, &client.ReplyError{Code: "BUSY", Message: "try later"}))
+	}
+}
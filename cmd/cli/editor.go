@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const maxHistoryLen = 1000
+
+// errInterrupted is returned when the line is cancelled with Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// editor reads lines from the terminal with cursor movement and history,
+// it falls back to plain reading when the input is not a terminal
+type editor struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int
+	raw bool
+
+	history     []string
+	historyFile string
+}
+
+func newEditor(historyFile string) *editor {
+	e := &editor{
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stdout,
+		fd:          int(os.Stdin.Fd()),
+		history:     make([]string, 0),
+		historyFile: historyFile,
+	}
+	e.raw = isTerminal(e.fd) && isTerminal(int(os.Stdout.Fd()))
+	e.loadHistory()
+
+	return e
+}
+
+func (e *editor) loadHistory() {
+	if e.historyFile == "" {
+		return
+	}
+	content, err := ioutil.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistoryLen {
+		e.history = e.history[len(e.history)-maxHistoryLen:]
+	}
+}
+
+// addHistory appends the line skipping repeats and saves the history
+func (e *editor) addHistory(line string) {
+	if line == "" || len(e.history) != 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistoryLen {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile != "" {
+		ioutil.WriteFile(e.historyFile, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+	}
+}
+
+// readLine returns the next line without the new line, io.EOF once the input
+// is over or Ctrl-D is pressed on an empty line
+func (e *editor) readLine(prompt string) (string, error) {
+	if !e.raw {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	line := newLineState(prompt, e.history)
+	e.refresh(line)
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter:
+			fmt.Fprint(e.out, "\r\n")
+			return string(line.buffer), nil
+		case keyInterrupt:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyEOF:
+			if len(line.buffer) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			line.delete()
+		default:
+			line.edit(key)
+		}
+		e.refresh(line)
+	}
+}
+
+// refresh redraws the prompt and the line moving the cursor in place
+func (e *editor) refresh(line *lineState) {
+	text := line.prompt + string(line.buffer)
+	fmt.Fprintf(e.out, "\r%s\x1b[K", text)
+	if back := len(line.buffer) - line.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// keys which are not inserted as they are
+const (
+	keyEnter rune = -1 - iota
+	keyInterrupt
+	keyEOF
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyKillLine
+	keyKillWord
+	keyUnknown
+)
+
+// readKey decodes a key, escape sequences of arrows and home/end included
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return keyEnter, nil
+	case 3:
+		return keyInterrupt, nil
+	case 4:
+		return keyEOF, nil
+	case 127, 8:
+		return keyBackspace, nil
+	case 1:
+		return keyHome, nil
+	case 5:
+		return keyEnd, nil
+	case 2:
+		return keyLeft, nil
+	case 6:
+		return keyRight, nil
+	case 16:
+		return keyUp, nil
+	case 14:
+		return keyDown, nil
+	case 21:
+		return keyKillLine, nil
+	case 23:
+		return keyKillWord, nil
+	case 27:
+		return e.readEscape()
+	}
+	if r < 32 {
+		return keyUnknown, nil
+	}
+
+	return r, nil
+}
+
+func (e *editor) readEscape() (rune, error) {
+	prefix, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if prefix != '[' && prefix != 'O' {
+		return keyUnknown, nil
+	}
+
+	code, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch code {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	}
+
+	// sequences like ESC [ 3 ~ end with a tilde
+	for code >= '0' && code <= '9' {
+		digit := code
+		if code, _, err = e.in.ReadRune(); err != nil {
+			return 0, err
+		}
+		if code == '~' {
+			switch digit {
+			case '3':
+				return keyDelete, nil
+			case '1', '7':
+				return keyHome, nil
+			case '4', '8':
+				return keyEnd, nil
+			}
+		}
+	}
+
+	return keyUnknown, nil
+}
+
+// lineState is the line being edited
+type lineState struct {
+	prompt string
+	buffer []rune
+	cursor int
+
+	history []string
+	// position in the history, len(history) for the new line
+	historyIndex int
+	// the new line is kept while browsing the history
+	saved []rune
+}
+
+func newLineState(prompt string, history []string) *lineState {
+	return &lineState{prompt: prompt, buffer: make([]rune, 0), history: history, historyIndex: len(history)}
+}
+
+func (line *lineState) edit(key rune) {
+	switch key {
+	case keyBackspace:
+		if line.cursor > 0 {
+			line.buffer = append(line.buffer[:line.cursor-1], line.buffer[line.cursor:]...)
+			line.cursor--
+		}
+	case keyDelete:
+		line.delete()
+	case keyLeft:
+		if line.cursor > 0 {
+			line.cursor--
+		}
+	case keyRight:
+		if line.cursor < len(line.buffer) {
+			line.cursor++
+		}
+	case keyHome:
+		line.cursor = 0
+	case keyEnd:
+		line.cursor = len(line.buffer)
+	case keyKillLine:
+		line.buffer = append([]rune{}, line.buffer[line.cursor:]...)
+		line.cursor = 0
+	case keyKillWord:
+		start := line.cursor
+		for start > 0 && line.buffer[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && line.buffer[start-1] != ' ' {
+			start--
+		}
+		line.buffer = append(line.buffer[:start], line.buffer[line.cursor:]...)
+		line.cursor = start
+	case keyUp:
+		line.browse(-1)
+	case keyDown:
+		line.browse(1)
+	case keyUnknown:
+	default:
+		line.buffer = append(line.buffer[:line.cursor], append([]rune{key}, line.buffer[line.cursor:]...)...)
+		line.cursor++
+	}
+}
+
+func (line *lineState) delete() {
+	if line.cursor < len(line.buffer) {
+		line.buffer = append(line.buffer[:line.cursor], line.buffer[line.cursor+1:]...)
+	}
+}
+
+// browse replaces the line with an older or a newer entry of the history
+func (line *lineState) browse(step int) {
+	index := line.historyIndex + step
+	if index < 0 || index > len(line.history) {
+		return
+	}
+	if line.historyIndex == len(line.history) {
+		line.saved = line.buffer
+	}
+
+	line.historyIndex = index
+	if index == len(line.history) {
+		line.buffer = line.saved
+	} else {
+		line.buffer = []rune(line.history[index])
+	}
+	line.cursor = len(line.buffer)
+}
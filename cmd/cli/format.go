@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"redis_like_in_memory_db/client"
+	"strconv"
+	"strings"
+)
+
+// replyKind tells how a reply is printed, arrays are numbered lists unless
+// the kind says otherwise
+type replyKind int
+
+const (
+	stringReply replyKind = iota
+	integerReply
+	// cursor followed by keys, values or field, value pairs
+	scanReply
+	infoReply
+)
+
+var replyKinds = map[string]replyKind{
+	"SCAN":   scanReply,
+	"ZSCAN":  scanReply,
+	"DSCAN":  scanReply,
+	"INFO":   infoReply,
+	"DBSIZE": integerReply,
+	"LEN":    integerReply,
+	"ZLEN":   integerReply,
+	"DLEN":   integerReply,
+	"DEL":    integerReply,
+	"UNLINK": integerReply,
+	"EXISTS": integerReply,
+
+	"MSETNX":         integerReply,
+	"RENAMENX":       integerReply,
+	"COPY":           integerReply,
+	"JSON.ARRAPPEND": integerReply,
+
+	"CLIENT KILL": integerReply,
+	"SLOWLOG LEN": integerReply,
+	"ACL DELUSER": integerReply,
+}
+
+func kindOf(args []string) replyKind {
+	if len(args) > 1 {
+		if kind, ok := replyKinds[args[0]+" "+args[1]]; ok {
+			return kind
+		}
+	}
+
+	return replyKinds[args[0]]
+}
+
+// formatReply renders a reply for a terminal the way redis-cli does: strings
+// are quoted, arrays are numbered and errors are marked. Items are set for
+// array replies only
+func formatReply(args []string, reply string, items []string, err error) string {
+	if err == client.Nil {
+		return "(nil)"
+	}
+	if err != nil {
+		return "(error) " + errorText(err)
+	}
+
+	if items != nil {
+		if kindOf(args) == scanReply && len(items) != 0 {
+			page := strings.TrimPrefix(formatList(items[1:], "   "), "   ")
+			return fmt.Sprintf("1) %s\n2) %s", strconv.Quote(items[0]), page)
+		}
+		return formatList(items, "")
+	}
+
+	switch kindOf(args) {
+	case integerReply:
+		if _, err := strconv.ParseInt(reply, 10, 64); err == nil {
+			return "(integer) " + reply
+		}
+	case infoReply:
+		return formatInfo(reply)
+	}
+
+	if reply == "Success" {
+		return "OK"
+	}
+	return strconv.Quote(reply)
+}
+
+func split(reply, separator string) []string {
+	if reply == "" {
+		return []string{}
+	}
+
+	return strings.Split(reply, separator)
+}
+
+// formatList numbers items, lines after the first one are indented
+func formatList(items []string, indent string) string {
+	if len(items) == 0 {
+		return "(empty array)"
+	}
+
+	width := len(strconv.Itoa(len(items)))
+	lines := make([]string, 0, len(items))
+	for i, item := range items {
+		lines = append(lines, fmt.Sprintf("%s%*d) %s", indent, width, i+1, strconv.Quote(item)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatInfo prints sections of INFO a field per line
+func formatInfo(reply string) string {
+	lines := make([]string, 0)
+	for i, section := range split(reply, "; ") {
+		if i != 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, strings.Split(section, ", ")...)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatRaw renders a reply for scripts: the value as it is, items of arrays
+// a line each and errors prefixed with their code
+func formatRaw(reply string, items []string, err error) string {
+	var replyErr *client.ReplyError
+	switch {
+	case err == client.Nil:
+		return ""
+	case errors.As(err, &replyErr):
+		return errorText(err)
+	case err != nil:
+		return "ERR " + err.Error()
+	case items != nil:
+		return strings.Join(items, "\n")
+	}
+
+	return reply
+}
+
+// errorText prefixes errors replied without a dedicated value with their code
+func errorText(err error) string {
+	var replyErr *client.ReplyError
+	if errors.As(err, &replyErr) {
+		return replyErr.Code + " " + replyErr.Message
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,285 @@
+// cli is a command line client of the server. It runs commands given as
+// arguments, read from a file or stdin, or typed in an interactive prompt
+// with line editing and history.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"redis_like_in_memory_db/client"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const historyFileName = ".redis_like_cli_history"
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "Server host")
+	port := flag.String("port", "8000", "Server port")
+	socket := flag.String("socket", "", "Unix socket path, overrides host and port")
+	user := flag.String("user", "", "ACL user, the default one when empty")
+	password := flag.String("a", "", "Password to authenticate with")
+	db := flag.Int("n", 0, "Database number")
+	useTLS := flag.Bool("tls", false, "Connect over TLS")
+	caFile := flag.String("cacert", "", "CA certificate verifying the server, system roots when empty")
+	certFile := flag.String("cert", "", "Client certificate in PEM format")
+	keyFile := flag.String("key", "", "Client private key in PEM format")
+	raw := flag.Bool("raw", false, "Print replies as they are, default when the output is not a terminal")
+	file := flag.String("file", "", "Execute commands of the file, - for stdin")
+	pipe := flag.Bool("pipe", false, "With -file or stdin print a summary instead of every reply")
+	stat := flag.Bool("stat", false, "Print keys, memory, clients and requests every interval")
+	latency := flag.Bool("latency", false, "Measure round trip latency until interrupted")
+	interval := flag.Duration("i", time.Second, "Interval of -stat and -latency reports")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [command [arg ...]]\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	opt := &client.Options{
+		Addr:     net.JoinHostPort(*host, *port),
+		Username: *user,
+		Password: *password,
+		DB:       *db,
+		PoolSize: 1,
+	}
+	if *socket != "" {
+		opt.Network, opt.Addr = "unix", *socket
+	}
+	if *useTLS {
+		config, err := tlsConfig(*host, *caFile, *certFile, *keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opt.TLSConfig = config
+	}
+
+	cli := newCLI(opt, *raw || !isTerminal(int(os.Stdout.Fd())))
+	defer cli.close()
+
+	var err error
+	switch {
+	case *stat:
+		err = cli.stat(*interval)
+	case *latency:
+		err = cli.latency(*interval)
+	case *file != "":
+		err = cli.bulk(*file, *pipe)
+	case flag.NArg() > 0:
+		err = cli.oneShot(flag.Args())
+	case !isTerminal(int(os.Stdin.Fd())):
+		err = cli.bulk("-", *pipe)
+	default:
+		cli.interactive()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		cli.close()
+		os.Exit(1)
+	}
+}
+
+func tlsConfig(host, caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// cli keeps the connection and the state changed by SELECT and AUTH
+type cli struct {
+	opt    client.Options
+	client *client.Client
+	// replies are printed as they are
+	raw bool
+}
+
+func newCLI(opt *client.Options, raw bool) *cli {
+	return &cli{opt: *opt, client: client.NewClient(opt), raw: raw}
+}
+
+func (cli *cli) close() {
+	cli.client.Close()
+}
+
+// interruptible returns a context cancelled by Ctrl-C
+func interruptible() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(interrupts)
+		cancel()
+	}
+}
+
+// execute runs the command and returns its printable reply, connection
+// errors are returned as errors
+func (cli *cli) execute(ctx context.Context, args []string) (string, error) {
+	args = normalizeArgs(args)
+	switch args[0] {
+	case "SELECT", "AUTH":
+		// connections of the pool select the database and authenticate
+		// themselves, so the client is replaced
+		opt := cli.opt
+		if args[0] == "SELECT" && len(args) == 2 {
+			db, err := strconv.Atoi(args[1])
+			if err != nil {
+				return cli.format(args, "", nil, client.ErrInvalidDBIndex), nil
+			}
+			opt.DB = db
+		}
+		if args[0] == "AUTH" && len(args) == 2 {
+			opt.Username, opt.Password = "", args[1]
+		}
+		if args[0] == "AUTH" && len(args) == 3 {
+			opt.Username, opt.Password = args[1], args[2]
+		}
+
+		next := client.NewClient(&opt)
+		cmd := next.Do(ctx, args...)
+		if err := cmd.Err(); err != nil {
+			next.Close()
+			return cli.format(args, "", nil, err), connectionError(err)
+		}
+		cli.client.Close()
+		cli.client, cli.opt = next, opt
+		return cli.format(args, cmd.Val(), cmd.Items(), nil), nil
+
+	case "MONITOR":
+		err := cli.client.Monitor(ctx, func(line string) {
+			fmt.Println(line)
+		})
+		if err == context.Canceled {
+			return "", nil
+		}
+		return cli.format(args, "", nil, err), connectionError(err)
+	}
+
+	cmd := cli.client.Do(ctx, args...)
+	return cli.format(args, cmd.Val(), cmd.Items(), cmd.Err()), connectionError(cmd.Err())
+}
+
+// format renders the reply, items are set for array replies only
+func (cli *cli) format(args []string, reply string, items []string, err error) string {
+	if cli.raw {
+		return formatRaw(reply, items, err)
+	}
+
+	return formatReply(args, reply, items, err)
+}
+
+// connectionError filters out error replies of the server, what is left
+// means the connection has failed or the command was interrupted
+func connectionError(err error) error {
+	var netErr net.Error
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == client.ErrClosed || errors.As(err, &netErr) ||
+		errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+func (cli *cli) oneShot(args []string) error {
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	reply, err := cli.execute(ctx, args)
+	if err != nil {
+		return fmt.Errorf("Could not connect to %s: %s", cli.opt.Addr, err)
+	}
+	fmt.Println(reply)
+	return nil
+}
+
+func (cli *cli) prompt() string {
+	prompt := cli.opt.Addr
+	if cli.opt.DB != 0 {
+		prompt += fmt.Sprintf("[%d]", cli.opt.DB)
+	}
+
+	return prompt + "> "
+}
+
+func (cli *cli) interactive() {
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, historyFileName)
+	}
+	editor := newEditor(historyFile)
+
+	for {
+		line, err := editor.readLine(cli.prompt())
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !hasSecret(args) {
+			editor.addHistory(strings.TrimSpace(line))
+		}
+		switch strings.ToUpper(args[0]) {
+		case "QUIT", "EXIT":
+			return
+		case "CLEAR":
+			fmt.Print("\x1b[H\x1b[2J")
+			continue
+		}
+
+		ctx, cancel := interruptible()
+		reply, err := cli.execute(ctx, args)
+		cancel()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Printf("Could not connect to %s: %s\n", cli.opt.Addr, err)
+			continue
+		}
+		fmt.Println(reply)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rows of -stat between repeated headers
+const statHeaderEvery = 20
+
+// parseInfo returns fields of an INFO reply by their names
+func parseInfo(reply string) map[string]string {
+	fields := make(map[string]string)
+	for _, section := range split(reply, "; ") {
+		for _, line := range strings.Split(section, ", ") {
+			separator := strings.Index(line, ":")
+			if separator == -1 {
+				continue
+			}
+			fields[line[:separator]] = line[separator+1:]
+		}
+	}
+
+	return fields
+}
+
+// keysCount sums keys of databases listed in the keyspace section
+func keysCount(fields map[string]string) int64 {
+	count := int64(0)
+	for name, value := range fields {
+		if !strings.HasPrefix(name, "db") {
+			continue
+		}
+		for _, counter := range strings.Fields(value) {
+			if strings.HasPrefix(counter, "keys=") {
+				keys, _ := strconv.ParseInt(strings.TrimPrefix(counter, "keys="), 10, 64)
+				count += keys
+			}
+		}
+	}
+
+	return count
+}
+
+// humanBytes formats a size like 1.50M
+func humanBytes(size int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	value, unit := float64(size), 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", size, units[unit])
+	}
+
+	return fmt.Sprintf("%.2f%s", value, units[unit])
+}
+
+// stat prints keys, memory, clients and processed commands every interval
+// until interrupted
+func (cli *cli) stat(interval time.Duration) error {
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	previous := int64(-1)
+	for row := 0; ; row++ {
+		reply, err := cli.client.Do(ctx, "INFO", "memory", "clients", "stats", "keyspace").Result()
+		// INFO replies start with a section header, anything else is an error
+		if err == nil && !strings.HasPrefix(reply, "# ") {
+			err = errors.New(reply)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if row%statHeaderEvery == 0 {
+			fmt.Printf("%-11s %-9s %-8s %s\n", "keys", "mem", "clients", "requests")
+		}
+		fields := parseInfo(reply)
+		memory, _ := strconv.ParseInt(fields["used_memory"], 10, 64)
+		commands, _ := strconv.ParseInt(fields["total_commands_processed"], 10, 64)
+		requests := strconv.FormatInt(commands, 10)
+		if previous != -1 {
+			requests += fmt.Sprintf(" (+%d)", commands-previous)
+		}
+		previous = commands
+		fmt.Printf("%-11d %-9s %-8s %s\n", keysCount(fields), humanBytes(memory), fields["connected_clients"], requests)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// latencyStats accumulates round trip times in milliseconds
+type latencyStats struct {
+	min, max, sum float64
+	samples       int
+}
+
+func (stats *latencyStats) add(latency time.Duration) {
+	ms := float64(latency) / float64(time.Millisecond)
+	if stats.samples == 0 || ms < stats.min {
+		stats.min = ms
+	}
+	stats.max = math.Max(stats.max, ms)
+	stats.sum += ms
+	stats.samples++
+}
+
+func (stats *latencyStats) String() string {
+	avg := 0.0
+	if stats.samples != 0 {
+		avg = stats.sum / float64(stats.samples)
+	}
+
+	return fmt.Sprintf("min: %.2f, max: %.2f, avg: %.2f (%d samples)", stats.min, stats.max, avg, stats.samples)
+}
+
+// sleep between latency samples, so the server is not flooded
+const latencySampleInterval = 10 * time.Millisecond
+
+// latency measures round trips of DBSIZE until interrupted, statistics are
+// updated in place on a terminal and printed every interval otherwise
+func (cli *cli) latency(interval time.Duration) error {
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	terminal := isTerminal(int(os.Stdout.Fd()))
+	stats := &latencyStats{}
+	reported := time.Now()
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := cli.client.Do(ctx, "DBSIZE").Err()
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		stats.add(time.Since(start))
+
+		if terminal {
+			fmt.Printf("\r%s\x1b[K", stats)
+		} else if time.Since(reported) >= interval {
+			fmt.Println(stats)
+			reported = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(latencySampleInterval):
+		}
+	}
+
+	if terminal {
+		fmt.Println()
+	} else {
+		fmt.Println(stats)
+	}
+	return nil
+}
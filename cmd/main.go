@@ -2,19 +2,145 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"redis_like_in_memory_db/internal/config"
+	"redis_like_in_memory_db/internal/global_cache"
 	"redis_like_in_memory_db/internal/server"
+	"redis_like_in_memory_db/internal/tx_logger"
 	"runtime"
 )
 
+// loadConfig sets flags from the config file, flags given on the command line
+// take precedence over the file
+func loadConfig(path string) error {
+	file, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	params, err := file.Params()
+	if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for _, param := range params {
+		f := flag.Lookup(param.Name)
+		if f == nil || param.Name == "config" {
+			return fmt.Errorf("%s:%d: unknown parameter %s", path, param.Line, param.Name)
+		}
+		if explicit[param.Name] {
+			continue
+		}
+		value := param.Value
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if _, isBool := getter.Get().(bool); isBool {
+				switch value {
+				case "yes":
+					value = "true"
+				case "no":
+					value = "false"
+				}
+			}
+		}
+		if err := flag.Set(param.Name, value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value of %s: %s", path, param.Line, param.Name, err)
+		}
+	}
+
+	return nil
+}
+
 func main() {
+	configFile := flag.String("config", "", "Path to the config file, flags override its parameters")
 	auth := flag.Bool("auth", false, "Wether to require password on session beginning")
+	requirePass := flag.String("requirepass", "", "Password of the default user, enables auth")
 	numBuckets := flag.Int("num_buckets", 32, "Number of buckets for each type of bucket")
-	port := flag.String("port", ":8000", "Port number with suffix colon")
+	numDatabases := flag.Int("databases", 16, "Number of logical databases")
+	aclFile := flag.String("aclfile", "", "Path to the file with ACL users")
+	port := flag.String("port", ":8000", "Port number with suffix colon, empty to disable TCP")
+	unixSocket := flag.String("unixsocket", "", "Path of the unix socket to listen on, disabled by default")
+	unixSocketPerm := flag.Uint("unixsocketperm", 0700, "Permissions of the unix socket in octal")
 	enableLogging := flag.Bool("logging", true, "enable commands logging")
+	txLog := flag.String("tx_log", tx_logger.DefaultPath, "Path of the transaction log")
+	txLogFsync := flag.String("tx_log_fsync", tx_logger.FsyncNo, "When the transaction log is synced to disk: always, everysec or no")
+	tlsPort := flag.String("tls_port", "", "Port number for TLS connections with suffix colon, disabled by default")
+	tlsCert := flag.String("tls_cert", "", "Server certificate file in PEM format")
+	tlsKey := flag.String("tls_key", "", "Server private key file in PEM format")
+	tlsCA := flag.String("tls_ca", "", "CA certificate file verifying client certificates")
+	tlsAuthClients := flag.Bool("tls_auth_clients", false, "Require a client certificate signed by tls_ca")
+	maxRequestSize := flag.Int("max_request_size", server.DefaultMaxRequestSize, "Maximum size of a single request in bytes")
+	protoMaxBulkLen := flag.Int("proto_max_bulk_len", server.DefaultProtoMaxBulkLen, "Maximum size of a single value of a request in bytes")
+	snapshotFile := flag.String("snapshot", "", "Snapshot file loaded at startup and written on shutdown, disabled by default")
+	saveInterval := flag.Duration("save_interval", 0, "Write the snapshot periodically, 0 to save on shutdown only")
+	saveMinChanges := flag.Int64("save_min_changes", 1, "Number of writes required for a periodic snapshot")
+	maxMemory := flag.String("maxmemory", "0", "Memory limit like 100mb, the eviction policy applies above it, 0 for no limit")
+	maxMemoryPolicy := flag.String("maxmemory_policy", "noeviction",
+		"What happens to writes above maxmemory: noeviction refuses them, allkeys-random evicts random keys")
+	shutdownTimeout := flag.Duration("shutdown_timeout", server.DefaultShutdownTimeout, "Time given to in-flight commands on shutdown")
+	maxClients := flag.Int("maxclients", server.DefaultMaxClients, "Maximum number of connected clients, 0 for no limit")
+	idleTimeout := flag.Duration("timeout", 0, "Close connections idle for longer than it, 0 to keep them open")
+	slowlogThreshold := flag.Duration("slowlog_log_slower_than", global_cache.DefaultSlowlogThreshold, "Log commands slower than it in SLOWLOG, negative to disable")
+	slowlogMaxLen := flag.Int("slowlog_max_len", global_cache.DefaultSlowlogMaxLen, "Number of entries kept in SLOWLOG")
+	latencyThreshold := flag.Duration("latency_monitor_threshold", 0, "Record internal operations slower than it for LATENCY, 0 to disable")
+	metricsAddr := flag.String("metrics_addr", "", "Address of the HTTP /metrics endpoint for Prometheus, disabled by default")
 	flag.Parse()
 
+	if *configFile != "" {
+		if err := loadConfig(*configFile); err != nil {
+			fmt.Println("Can not load config: ", err)
+			os.Exit(server.ExitStartupFailed)
+		}
+	}
+	maxMemoryBytes, err := config.ParseMemory(*maxMemory)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(server.ExitStartupFailed)
+	}
+	if *auth && *requirePass == "" {
+		fmt.Println("auth requires a password, set it with requirepass")
+		os.Exit(server.ExitStartupFailed)
+	}
+	if *requirePass != "" {
+		*auth = true
+	}
+
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	server := server.NewServer(*port, *auth, *enableLogging, "password", *numBuckets)
-	server.Run()
+	tlsOptions := server.TLSOptions{
+		Port:        *tlsPort,
+		CertFile:    *tlsCert,
+		KeyFile:     *tlsKey,
+		CAFile:      *tlsCA,
+		AuthClients: *tlsAuthClients,
+	}
+
+	server := server.NewServer(*port, *auth, *enableLogging, *requirePass, *numBuckets, *numDatabases, *aclFile)
+	server.TLS = tlsOptions
+	server.UnixSocket = *unixSocket
+	server.UnixSocketPerm = os.FileMode(*unixSocketPerm)
+	server.MaxRequestSize = *maxRequestSize
+	server.ProtoMaxBulkLen = *protoMaxBulkLen
+	server.SnapshotFile = *snapshotFile
+	server.ShutdownTimeout = *shutdownTimeout
+	server.MaxClients = *maxClients
+	server.IdleTimeout = *idleTimeout
+	server.MetricsAddr = *metricsAddr
+	server.SlowlogThreshold = *slowlogThreshold
+	server.SlowlogMaxLen = *slowlogMaxLen
+	server.LatencyThreshold = *latencyThreshold
+	if *enableLogging {
+		server.TXLog = *txLog
+	}
+	server.TXLogFsync = *txLogFsync
+	server.SaveInterval = *saveInterval
+	server.SaveMinChanges = *saveMinChanges
+	server.MaxMemory = maxMemoryBytes
+	server.MaxMemoryPolicy = *maxMemoryPolicy
+	server.ConfigFile = *configFile
+	os.Exit(server.Run())
 }
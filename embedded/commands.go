@@ -0,0 +1,305 @@
+package embedded
+
+import (
+	"context"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// status executes a command replying "Success"
+func (db *DB) status(ctx context.Context, args ...string) error {
+	r, err := db.process(ctx, args...)
+	if err != nil {
+		return err
+	}
+	if r.Kind != reply.StatusKind || r.Value != reply.OK.Value {
+		return &ReplyError{Code: reply.CodeErr, Message: r.Value}
+	}
+
+	return nil
+}
+
+// value executes a command returning a single value, found is false when it
+// does not exist or has expired
+func (db *DB) value(ctx context.Context, args ...string) (string, bool, error) {
+	r, err := db.process(ctx, args...)
+	if err != nil || r.Kind == reply.NilKind {
+		return "", false, err
+	}
+
+	return r.Value, true, nil
+}
+
+// integer executes a command returning a number
+func (db *DB) integer(ctx context.Context, args ...string) (int64, error) {
+	r, err := db.process(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseInt(r.Value, 10, 64)
+	if err != nil {
+		return 0, &ReplyError{Code: reply.CodeErr, Message: r.Value}
+	}
+
+	return value, nil
+}
+
+// list executes a command returning an array of values
+func (db *DB) list(ctx context.Context, args ...string) ([]string, error) {
+	r, err := db.process(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Strings(), nil
+}
+
+// values executes a command returning an array of values which may be
+// missing, requested are names of the values in the order of the array and
+// missing ones are left out of the result
+func (db *DB) values(ctx context.Context, requested []string, args ...string) (map[string]string, error) {
+	r, err := db.process(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	if r.Kind != reply.ArrayKind || len(r.Items) != len(requested) {
+		return nil, &ReplyError{Code: reply.CodeErr, Message: r.Value}
+	}
+
+	values := make(map[string]string, len(requested))
+	for i, item := range r.Items {
+		if item.Kind != reply.NilKind {
+			values[requested[i]] = item.Value
+		}
+	}
+
+	return values, nil
+}
+
+// pairs appends key, value pairs of values to args
+func pairs(args []string, values map[string]string) []string {
+	for key, value := range values {
+		args = append(args, key, value)
+	}
+
+	return args
+}
+
+// Do executes any command and returns its reply, error replies are returned
+// as errors, nil as Nil and items of arrays are joined with ", "
+func (db *DB) Do(ctx context.Context, args ...string) (string, error) {
+	r, err := db.process(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	switch r.Kind {
+	case reply.NilKind:
+		return "", Nil
+	case reply.ArrayKind:
+		return strings.Join(r.Strings(), ", "), nil
+	}
+
+	return r.Value, nil
+}
+
+// Get returns the value of the key, found is false when there is none
+func (db *DB) Get(ctx context.Context, key string) (string, bool, error) {
+	return db.value(ctx, "GET", key)
+}
+
+// Set stores the value for ttl, every key has to expire so ErrInvalidTTL is
+// returned when ttl is not positive
+func (db *DB) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.status(ctx, "SET", key, value, ttl.String())
+}
+
+// MGet returns values of the keys which exist, missing keys and keys of
+// other families are left out
+func (db *DB) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	return db.values(ctx, keys, append([]string{"MGET"}, keys...)...)
+}
+
+// MSet stores the values for ttl at once, nothing is stored when a key holds
+// another family
+func (db *DB) MSet(ctx context.Context, values map[string]string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.status(ctx, append(pairs([]string{"MSET"}, values), ttl.String())...)
+}
+
+// MSetNX stores the values for ttl only when none of the keys exists and
+// reports whether they were stored
+func (db *DB) MSetNX(ctx context.Context, values map[string]string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, ErrInvalidTTL
+	}
+	stored, err := db.integer(ctx, append(pairs([]string{"MSETNX"}, values), ttl.String())...)
+	return stored == 1, err
+}
+
+// Rem removes the key, ErrKeyNotExists is returned when there is none
+func (db *DB) Rem(ctx context.Context, key string) error {
+	return db.status(ctx, "REM", key)
+}
+
+// Len returns the number of plain keys
+func (db *DB) Len(ctx context.Context) (int64, error) {
+	return db.integer(ctx, "LEN")
+}
+
+// Keys returns keys of every family matching the glob pattern, an empty
+// pattern matches all of them
+func (db *DB) Keys(ctx context.Context, pattern string) ([]string, error) {
+	if pattern == "" {
+		return db.list(ctx, "KEYS")
+	}
+
+	return db.list(ctx, "KEYS", pattern)
+}
+
+// Scan returns a page of keys starting at the cursor and the cursor of the
+// next page, iteration is over when it is 0
+func (db *DB) Scan(ctx context.Context, cursor uint64, match string, count int) ([]string, uint64, error) {
+	args := []string{"SCAN", strconv.FormatUint(cursor, 10)}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(count))
+	}
+
+	r, err := db.process(ctx, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := r.Strings()
+	if len(items) == 0 {
+		return nil, 0, &ReplyError{Code: reply.CodeErr, Message: r.Value}
+	}
+	next, err := strconv.ParseUint(items[0], 10, 64)
+	if err != nil {
+		return nil, 0, &ReplyError{Code: reply.CodeErr, Message: r.Value}
+	}
+
+	return items[1:], next, nil
+}
+
+// Del removes keys of any family and returns the number of removed ones
+func (db *DB) Del(ctx context.Context, keys ...string) (int64, error) {
+	return db.integer(ctx, append([]string{"DEL"}, keys...)...)
+}
+
+// Exists returns the number of existing keys
+func (db *DB) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return db.integer(ctx, append([]string{"EXISTS"}, keys...)...)
+}
+
+// Type returns string, list, dict, json or none
+func (db *DB) Type(ctx context.Context, key string) (string, error) {
+	value, _, err := db.value(ctx, "TYPE", key)
+	return value, err
+}
+
+func (db *DB) Rename(ctx context.Context, key, newKey string) error {
+	return db.status(ctx, "RENAME", key, newKey)
+}
+
+// DBSize returns the number of keys of every family
+func (db *DB) DBSize(ctx context.Context) (int64, error) {
+	return db.integer(ctx, "DBSIZE")
+}
+
+// FlushDB removes every key of the database
+func (db *DB) FlushDB(ctx context.Context) error {
+	return db.status(ctx, "FLUSHDB")
+}
+
+// ListSet appends the value to the list or updates its ttl if it is there
+func (db *DB) ListSet(ctx context.Context, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.status(ctx, "ZSET", key, value, ttl.String())
+}
+
+// ListGet returns the value at the index, found is false when there is none
+func (db *DB) ListGet(ctx context.Context, key string, index int) (string, bool, error) {
+	return db.value(ctx, "ZGET", key, strconv.Itoa(index))
+}
+
+// ListValues returns values of the list
+func (db *DB) ListValues(ctx context.Context, key string) ([]string, error) {
+	return db.list(ctx, "ZKEYS", key)
+}
+
+// ListLen returns the length of the list, -1 when it does not exist
+func (db *DB) ListLen(ctx context.Context, key string) (int64, error) {
+	return db.integer(ctx, "ZLEN", key)
+}
+
+// ListRem removes the value at the index
+func (db *DB) ListRem(ctx context.Context, key string, index int) error {
+	return db.status(ctx, "ZREM", key, strconv.Itoa(index))
+}
+
+// DictSet stores the value of the field in the dictionary for ttl
+func (db *DB) DictSet(ctx context.Context, key, field, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.status(ctx, "DSET", key, field, value, ttl.String())
+}
+
+// DictGet returns the value of the field, found is false when there is none
+func (db *DB) DictGet(ctx context.Context, key, field string) (string, bool, error) {
+	return db.value(ctx, "DGET", key, field)
+}
+
+// DictMGet returns values of the fields which exist and have not expired
+func (db *DB) DictMGet(ctx context.Context, key string, fields ...string) (map[string]string, error) {
+	return db.values(ctx, fields, append([]string{"HMGET", key}, fields...)...)
+}
+
+// DictMSet stores the fields in the dictionary with the same ttl
+func (db *DB) DictMSet(ctx context.Context, key string, fields map[string]string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.status(ctx, append(pairs([]string{"HMSET", key}, fields), ttl.String())...)
+}
+
+// DictGetAll returns fields of the dictionary with their values
+func (db *DB) DictGetAll(ctx context.Context, key string) (map[string]string, error) {
+	items, err := db.list(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		fields[items[i]] = items[i+1]
+	}
+
+	return fields, nil
+}
+
+// DictKeys returns fields of the dictionary
+func (db *DB) DictKeys(ctx context.Context, key string) ([]string, error) {
+	return db.list(ctx, "DKEYS", key)
+}
+
+// DictLen returns the number of fields, -1 when the dictionary does not exist
+func (db *DB) DictLen(ctx context.Context, key string) (int64, error) {
+	return db.integer(ctx, "DLEN", key)
+}
+
+// DictRem removes the field
+func (db *DB) DictRem(ctx context.Context, key, field string) error {
+	return db.status(ctx, "DREM", key, field)
+}
@@ -0,0 +1,227 @@
+// Package embedded runs the store inside a Go program without a server. The
+// data lives in the process, commands are executed directly and have typed
+// methods:
+//
+//	db, err := embedded.Open(&embedded.Options{SnapshotFile: "cache.snapshot", SaveInterval: time.Minute})
+//	defer db.Close()
+//
+//	err = db.Set(ctx, "user:1", "moose", time.Hour)
+//	value, found, err := db.Get(ctx, "user:1")
+//
+// Keys and values are stored as they are, any bytes and empty strings
+// included.
+package embedded
+
+import (
+	"context"
+	"os"
+	"redis_like_in_memory_db/internal/global_cache"
+	"redis_like_in_memory_db/internal/reply"
+	"redis_like_in_memory_db/internal/tx_logger"
+	"sync"
+	"time"
+)
+
+// DefaultNumBuckets is the number of shards of every key family
+const DefaultNumBuckets = 32
+
+// eviction policies applied to writes once the heap exceeds MaxMemory
+const (
+	// writes are refused with ErrOutOfMemory
+	NoEviction = global_cache.NoEviction
+	// random keys of any family are removed to make room
+	AllKeysRandom = global_cache.AllKeysRandom
+)
+
+// fsync policies of the transaction log
+const (
+	FsyncNo       = tx_logger.FsyncNo
+	FsyncAlways   = tx_logger.FsyncAlways
+	FsyncEverySec = tx_logger.FsyncEverySec
+)
+
+// periodic saves are checked this often
+const saveCheckInterval = time.Second
+
+type Options struct {
+	// shards of every key family, DefaultNumBuckets when 0
+	NumBuckets int
+	// logical databases, 16 when 0. The handle returned by Open uses the
+	// database 0, others are reached with WithDB
+	Databases int
+
+	// SnapshotFile is loaded by Open when it exists and written by Save and
+	// Close, persistence is disabled while it is empty
+	SnapshotFile string
+	// the snapshot is written every SaveInterval when there were at least
+	// SaveMinChanges writes, 0 interval saves on Close only
+	SaveInterval   time.Duration
+	SaveMinChanges int64
+	// OnSaveError is called with errors of periodic saves, they are retried
+	// after the interval
+	OnSaveError func(err error)
+	// TXLog is the file every write is appended to, disabled while empty
+	TXLog      string
+	TXLogFsync string
+
+	// MaxMemory is the heap size above which EvictionPolicy applies to
+	// writes, 0 disables the limit
+	MaxMemory      int64
+	EvictionPolicy string
+}
+
+// store is the cache shared by handles of its databases
+type store struct {
+	cache *global_cache.GlobalCache
+	opt   Options
+
+	closeOnce  sync.Once
+	closeErr   error
+	stopSaving chan struct{}
+	savingDone chan struct{}
+}
+
+// DB is a handle of a database of the store, it is safe for concurrent use
+type DB struct {
+	store *store
+	index int
+}
+
+// Open creates the store, loads the snapshot and starts periodic saves
+func Open(opt *Options) (*DB, error) {
+	s := &store{opt: *opt, stopSaving: make(chan struct{}), savingDone: make(chan struct{})}
+	if s.opt.NumBuckets == 0 {
+		s.opt.NumBuckets = DefaultNumBuckets
+	}
+	if s.opt.Databases == 0 {
+		s.opt.Databases = global_cache.DefaultDatabases
+	}
+	if s.opt.EvictionPolicy == "" {
+		s.opt.EvictionPolicy = NoEviction
+	}
+	if s.opt.TXLogFsync == "" {
+		s.opt.TXLogFsync = FsyncNo
+	}
+
+	s.cache = global_cache.NewCacheWithDatabases(s.opt.NumBuckets, s.opt.Databases, false)
+	if err := s.cache.SetEvictionPolicy(s.opt.EvictionPolicy); err != nil {
+		return nil, err
+	}
+	s.cache.SetMaxMemory(s.opt.MaxMemory)
+	if s.opt.SnapshotFile != "" {
+		s.cache.SetSnapshotFile(s.opt.SnapshotFile)
+		if _, err := os.Stat(s.opt.SnapshotFile); err == nil {
+			if err := s.cache.LoadSnapshot(s.opt.SnapshotFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.opt.TXLog != "" {
+		s.cache.EnableTXLog(s.opt.TXLog)
+		if err := s.cache.SetTXLogFsync(s.opt.TXLogFsync); err != nil {
+			s.cache.Close()
+			return nil, err
+		}
+	}
+	go s.autoSave()
+
+	return &DB{store: s}, nil
+}
+
+// Options returns options of the store with defaults applied
+func (db *DB) Options() Options {
+	return db.store.opt
+}
+
+// WithDB returns a handle of another database of the same store
+func (db *DB) WithDB(index int) (*DB, error) {
+	if index < 0 || index >= db.store.opt.Databases {
+		return nil, ErrDBOutOfRange
+	}
+
+	return &DB{store: db.store, index: index}, nil
+}
+
+// Close refuses further commands, flushes the transaction log and writes the
+// snapshot when it is configured. Every handle of the store is closed
+func (db *DB) Close() error {
+	s := db.store
+	s.closeOnce.Do(func() {
+		close(s.stopSaving)
+		<-s.savingDone
+
+		s.closeErr = s.cache.Close()
+		if s.opt.SnapshotFile != "" {
+			if err := s.cache.Save(); err != nil && s.closeErr == nil {
+				s.closeErr = err
+			}
+		}
+	})
+
+	return s.closeErr
+}
+
+// Save writes the snapshot, ErrNoSnapshotFile is returned without SnapshotFile
+func (db *DB) Save() error {
+	return db.store.cache.Save()
+}
+
+// SetMaxMemory changes MaxMemory of the store
+func (db *DB) SetMaxMemory(bytes int64) {
+	db.store.cache.SetMaxMemory(bytes)
+}
+
+// EvictedKeys returns the number of keys removed to keep under MaxMemory
+func (db *DB) EvictedKeys() int64 {
+	return db.store.cache.EvictedKeys()
+}
+
+// autoSave writes the snapshot every SaveInterval when there were enough
+// writes, it returns once saving is stopped
+func (s *store) autoSave() {
+	defer close(s.savingDone)
+	if s.opt.SaveInterval <= 0 || s.opt.SnapshotFile == "" {
+		<-s.stopSaving
+		return
+	}
+
+	ticker := time.NewTicker(saveCheckInterval)
+	defer ticker.Stop()
+	// a failed save is retried after the interval rather than every tick
+	lastAttempt := time.Now()
+	for {
+		select {
+		case <-s.stopSaving:
+			return
+		case <-ticker.C:
+		}
+
+		if lastSave := s.cache.LastSave(); lastSave.After(lastAttempt) {
+			lastAttempt = lastSave
+		}
+		changes := s.cache.ChangesSinceSave()
+		if time.Since(lastAttempt) < s.opt.SaveInterval || changes == 0 || changes < s.opt.SaveMinChanges {
+			continue
+		}
+		lastAttempt = time.Now()
+		if err := s.cache.Save(); err != nil && s.opt.OnSaveError != nil {
+			s.opt.OnSaveError(err)
+		}
+	}
+}
+
+// process executes the command against the database of the handle, the
+// context is checked before since commands do not block. Error replies are
+// returned as errors
+func (db *DB) process(ctx context.Context, args ...string) (reply.Reply, error) {
+	if err := ctx.Err(); err != nil {
+		return reply.Reply{}, err
+	}
+	session := &global_cache.Session{DB: db.index}
+	r := db.store.cache.Execute(session, args)
+	if r.IsError() {
+		return reply.Reply{}, replyError(r)
+	}
+
+	return r, nil
+}
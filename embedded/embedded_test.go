@@ -0,0 +1,268 @@
+package embedded
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"redis_like_in_memory_db/internal/tx_logger"
+	"testing"
+	"time"
+)
+
+func TestDB_Keys(t *testing.T) {
+	db, err := Open(&Options{NumBuckets: 4})
+	assert.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	{
+		t.Log("Values should be stored as they are and missing ones reported by found")
+		assert.NoError(t, db.Set(ctx, "user:1", "moose \"the elk\"\nsecond line", time.Hour))
+		value, found, err := db.Get(ctx, "user:1")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "moose \"the elk\"\nsecond line", value)
+
+		assert.NoError(t, db.Set(ctx, "empty", "", time.Hour))
+		value, found, err = db.Get(ctx, "empty")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "", value)
+
+		_, found, err = db.Get(ctx, "user:2")
+		assert.NoError(t, err)
+		assert.False(t, found)
+	}
+
+	{
+		t.Log("Keys of every family should be listed and removed")
+		assert.NoError(t, db.DictSet(ctx, "user:2", "name", "elk", time.Hour))
+		keys, err := db.Keys(ctx, "user:*")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"user:1", "user:2"}, keys)
+		typeName, err := db.Type(ctx, "user:2")
+		assert.NoError(t, err)
+		assert.Equal(t, "dict", typeName)
+
+		count, err := db.Exists(ctx, "user:1", "user:2", "user:3")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, count)
+		assert.NoError(t, db.Rename(ctx, "user:1", "user:3"))
+		count, err = db.Del(ctx, "user:2", "user:3")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, count)
+		size, err := db.DBSize(ctx)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, size)
+	}
+
+	{
+		t.Log("Error replies should be returned as error values")
+		assert.Equal(t, ErrKeyNotExists, db.Rem(ctx, "user:1"))
+		assert.Equal(t, ErrNoSuchKey, db.Rename(ctx, "user:1", "user:4"))
+		assert.NoError(t, db.ListSet(ctx, "list", "a", time.Hour))
+		_, _, err := db.Get(ctx, "list")
+		assert.Equal(t, ErrWrongType, err)
+		_, err = db.Do(ctx, "NOPE")
+		assert.Equal(t, ErrUnknownCommand, err)
+		_, err = db.Do(ctx, "GET", "user:4")
+		assert.Equal(t, Nil, err)
+		_, err = db.Do(ctx, "EVAL", `return redis.error_reply("BUSY try later")`, "0")
+		assert.Equal(t, &ReplyError{Code: "BUSY", Message: "try later"}, err)
+	}
+
+	{
+		t.Log("Keys should not be stored without a positive ttl")
+		assert.Equal(t, ErrInvalidTTL, db.Set(ctx, "user:6", "value", 0))
+		assert.Equal(t, ErrInvalidTTL, db.DictMSet(ctx, "dict", map[string]string{"a": "b"}, -time.Second))
+		_, found, err := db.Get(ctx, "user:6")
+		assert.NoError(t, err)
+		assert.False(t, found)
+	}
+
+	{
+		t.Log("Values looking like errors should be returned as values")
+		assert.NoError(t, db.Set(ctx, "user:5", ErrKeyNotExists.Error(), time.Hour))
+		value, found, err := db.Get(ctx, "user:5")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, ErrKeyNotExists.Error(), value)
+	}
+
+	{
+		t.Log("Binary values and values with separators should be kept")
+		assert.NoError(t, db.ListSet(ctx, "bin", "a, b", time.Hour))
+		assert.NoError(t, db.ListSet(ctx, "bin", "\x00\r\n", time.Hour))
+		values, err := db.ListValues(ctx, "bin")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a, b", "\x00\r\n"}, values)
+	}
+}
+
+func TestDB_ListsAndDicts(t *testing.T) {
+	db, err := Open(&Options{NumBuckets: 4})
+	assert.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	{
+		t.Log("Lists")
+		assert.NoError(t, db.ListSet(ctx, "list", "a", time.Hour))
+		assert.NoError(t, db.ListSet(ctx, "list", "b", time.Hour))
+		value, found, err := db.ListGet(ctx, "list", 1)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "b", value)
+		values, err := db.ListValues(ctx, "list")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, values)
+		length, err := db.ListLen(ctx, "list")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, length)
+		assert.Equal(t, ErrIndexOutOfRange, db.ListRem(ctx, "list", 5))
+	}
+
+	{
+		t.Log("Dictionaries")
+		assert.NoError(t, db.DictSet(ctx, "dict", "name", "moose", time.Hour))
+		value, found, err := db.DictGet(ctx, "dict", "name")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "moose", value)
+		_, found, err = db.DictGet(ctx, "dict", "age")
+		assert.NoError(t, err)
+		assert.False(t, found)
+		fields, err := db.DictKeys(ctx, "dict")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"name"}, fields)
+		assert.NoError(t, db.DictRem(ctx, "dict", "name"))
+		// the dictionary is removed with its last field
+		length, err := db.DictLen(ctx, "dict")
+		assert.NoError(t, err)
+		assert.EqualValues(t, -1, length)
+	}
+
+	{
+		t.Log("Databases should be separate and the context checked")
+		other, err := db.WithDB(1)
+		assert.NoError(t, err)
+		size, err := other.DBSize(ctx)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 0, size)
+		_, err = db.WithDB(16)
+		assert.Equal(t, ErrDBOutOfRange, err)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.Equal(t, context.Canceled, db.Set(cancelled, "key", "value", time.Hour))
+	}
+}
+
+func TestDB_MultiKey(t *testing.T) {
+	db, err := Open(&Options{NumBuckets: 4})
+	assert.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	{
+		t.Log("Plain keys")
+		assert.NoError(t, db.MSet(ctx, map[string]string{"a": "1", "b": ""}, time.Hour))
+		values, err := db.MGet(ctx, "a", "missing", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "b": ""}, values)
+		stored, err := db.MSetNX(ctx, map[string]string{"a": "2", "c": "3"}, time.Hour)
+		assert.NoError(t, err)
+		assert.False(t, stored)
+		stored, err = db.MSetNX(ctx, map[string]string{"c": "3"}, time.Hour)
+		assert.NoError(t, err)
+		assert.True(t, stored)
+	}
+
+	{
+		t.Log("Dictionary fields")
+		assert.NoError(t, db.DictMSet(ctx, "dict", map[string]string{"name": "moose", "city": "oslo"}, time.Hour))
+		assert.NoError(t, db.DictMSet(ctx, "dict", map[string]string{"token": "t"}, time.Millisecond))
+		<-time.After(5 * time.Millisecond)
+		fields, err := db.DictMGet(ctx, "dict", "name", "token", "age")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"name": "moose"}, fields)
+		fields, err = db.DictGetAll(ctx, "dict")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"name": "moose", "city": "oslo"}, fields)
+		_, err = db.DictGetAll(ctx, "a")
+		assert.Equal(t, ErrWrongType, err)
+	}
+}
+
+func TestDB_Persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "embedded")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	opt := &Options{NumBuckets: 4, SnapshotFile: filepath.Join(dir, "snapshot"), TXLog: filepath.Join(dir, "tx_log")}
+	ctx := context.Background()
+
+	{
+		t.Log("The snapshot should be written on Close and loaded by Open")
+		db, err := Open(opt)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Set(ctx, "key", "value", time.Hour))
+		assert.NoError(t, db.Close())
+		assert.Equal(t, ErrClosed, db.Set(ctx, "key", "value", time.Hour))
+
+		file, err := os.Open(opt.TXLog)
+		assert.NoError(t, err)
+		entry, err := tx_logger.NewReader(file).Next()
+		file.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"SET", "key", "value", "1h0m0s"}, entry.Args)
+
+		db, err = Open(opt)
+		assert.NoError(t, err)
+		defer db.Close()
+		value, found, err := db.Get(ctx, "key")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "value", value)
+	}
+
+	{
+		t.Log("Save should fail without the snapshot file")
+		db, err := Open(&Options{})
+		assert.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, ErrNoSnapshotFile, db.Save())
+	}
+}
+
+func TestDB_Eviction(t *testing.T) {
+	ctx := context.Background()
+	_, err := Open(&Options{EvictionPolicy: "allkeys-lru"})
+	assert.Error(t, err)
+
+	{
+		t.Log("Writes over the limit should be refused without eviction")
+		db, err := Open(&Options{NumBuckets: 4, MaxMemory: 1})
+		assert.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, ErrOutOfMemory, db.Set(ctx, "key", "value", time.Hour))
+	}
+
+	{
+		t.Log("Writes over the limit should evict random keys until none is left")
+		db, err := Open(&Options{NumBuckets: 4, EvictionPolicy: AllKeysRandom})
+		assert.NoError(t, err)
+		defer db.Close()
+		for _, key := range []string{"a", "b", "c", "d", "e"} {
+			assert.NoError(t, db.Set(ctx, key, "value", time.Hour))
+		}
+
+		db.SetMaxMemory(1)
+		assert.NoError(t, db.Set(ctx, "f", "value", time.Hour))
+		size, err := db.DBSize(ctx)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, size)
+		assert.EqualValues(t, 5, db.EvictedKeys())
+	}
+}
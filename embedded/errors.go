@@ -0,0 +1,59 @@
+package embedded
+
+import (
+	"errors"
+	"redis_like_in_memory_db/internal/reply"
+)
+
+// Nil is returned by Do when the reply is nil
+var Nil = errors.New("value does not exist")
+
+// Errors returned instead of error replies of commands, compare them with ==
+var (
+	ErrWrongType       error = reply.ErrWrongType
+	ErrNoSuchKey       error = reply.ErrNoSuchKey
+	ErrSameKeys        error = reply.ErrSameKeys
+	ErrSyntax          error = reply.ErrSyntax
+	ErrWrongArgsNumber error = reply.ErrWrongArgsNumber
+	ErrUnknownCommand  error = reply.ErrUnknownCommand
+	ErrOutOfMemory     error = reply.ErrOutOfMemory
+	ErrInvalidDBIndex  error = reply.ErrInvalidDBIndex
+	ErrDBOutOfRange    error = reply.ErrDBOutOfRange
+	ErrInvalidCursor   error = reply.ErrInvalidCursor
+	ErrKeyNotExists    error = reply.ErrKeyNotExists
+	ErrListNotExists   error = reply.ErrListNotExists
+	ErrIndexOutOfRange error = reply.ErrIndexOutOfRange
+	ErrDictNotExists   error = reply.ErrDictNotExists
+	ErrDictKeyNotFound error = reply.ErrDictKeyNotFound
+	ErrDictKeyExpired  error = reply.ErrDictKeyExpired
+	ErrNoScript        error = reply.ErrNoScript
+	ErrScriptKilled    error = reply.ErrScriptKilled
+	ErrScriptTimedOut  error = reply.ErrScriptTimedOut
+	ErrNoSnapshotFile  error = reply.ErrNoSnapshotFile
+	ErrTXLogDisabled   error = reply.ErrTXLogDisabled
+	// keys are stored with a positive ttl only
+	ErrInvalidTTL = errors.New("ttl should be positive")
+	// commands are refused once the store is closed
+	ErrClosed error = reply.ErrShuttingDown
+)
+
+// ReplyError is an error reply which has no dedicated value
+type ReplyError struct {
+	// first word of the reply, like ERR or WRONGTYPE
+	Code    string
+	Message string
+}
+
+func (err *ReplyError) Error() string {
+	return err.Message
+}
+
+// replyError returns the error of an error reply, known messages are
+// returned as their errors
+func replyError(r reply.Reply) error {
+	if err, ok := reply.KnownError(r); ok {
+		return err
+	}
+
+	return &ReplyError{Code: r.Code, Message: r.Value}
+}
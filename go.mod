@@ -7,4 +7,5 @@ require (
 	github.com/spf13/cast v1.3.0
 	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/stretchr/testify v1.3.0
+	github.com/yuin/gopher-lua v1.1.1
 )
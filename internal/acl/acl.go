@@ -0,0 +1,239 @@
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUser = "default"
+	maxLogLen   = 128
+)
+
+// reasons of denied attempts
+const (
+	ReasonAuth    = "auth"
+	ReasonCommand = "command"
+	ReasonKey     = "key"
+)
+
+var (
+	userNotExists     = errors.New("user does not exist")
+	defaultNotRemoved = errors.New("the default user can not be removed")
+)
+
+// LogEntry describes repeated denied attempts of a user
+type LogEntry struct {
+	Count    int
+	Reason   string
+	Object   string
+	Username string
+	Created  time.Time
+	Updated  time.Time
+}
+
+func (entry LogEntry) String() string {
+	return fmt.Sprintf("count=%d reason=%s object=%s username=%s age=%s",
+		entry.Count, entry.Reason, entry.Object, entry.Username, time.Since(entry.Created).Round(time.Millisecond))
+}
+
+// ACL keeps users and the log of denied attempts
+type ACL struct {
+	mu    sync.RWMutex
+	users map[string]*User
+	// newest entries first
+	log []*LogEntry
+}
+
+// NewACL creates the default user allowed to do everything without a password
+func NewACL() *ACL {
+	acl := &ACL{users: make(map[string]*User)}
+	acl.users[DefaultUser] = defaultUser()
+
+	return acl
+}
+
+func defaultUser() *User {
+	user := newUser(DefaultUser)
+	user.setRules("on", "nopass", "allkeys", "allcommands")
+	return user
+}
+
+// User returns the current version of the user
+func (acl *ACL) User(name string) (*User, bool) {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	user, ok := acl.users[name]
+	return user, ok
+}
+
+// SetUser creates or modifies the user, nothing changes when a rule is invalid
+func (acl *ACL) SetUser(name string, rules ...string) error {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	return acl.setUserWithoutLock(acl.users, name, rules...)
+}
+
+func (acl *ACL) setUserWithoutLock(users map[string]*User, name string, rules ...string) error {
+	user, ok := users[name]
+	if ok {
+		user = user.clone()
+	} else {
+		user = newUser(name)
+	}
+
+	if err := user.setRules(rules...); err != nil {
+		return err
+	}
+	users[name] = user
+
+	return nil
+}
+
+// DeleteUsers removes users and returns the number of removed ones
+func (acl *ACL) DeleteUsers(names ...string) (int, error) {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, defaultNotRemoved
+		}
+	}
+
+	count := 0
+	for _, name := range names {
+		if _, ok := acl.users[name]; ok {
+			delete(acl.users, name)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Users returns users sorted by name
+func (acl *ACL) Users() []*User {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	users := make([]*User, 0, len(acl.users))
+	for _, user := range acl.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+
+	return users
+}
+
+// Authenticate returns the user when it is enabled and accepts the password
+func (acl *ACL) Authenticate(name, password string) (*User, bool) {
+	user, ok := acl.User(name)
+	if !ok || !user.CheckPassword(password) {
+		acl.LogDenied(ReasonAuth, "AUTH", name)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// LogDenied records a denied attempt, repeated attempts share an entry
+func (acl *ACL) LogDenied(reason, object, username string) {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	now := time.Now()
+	for i, entry := range acl.log {
+		if entry.Reason == reason && entry.Object == object && entry.Username == username {
+			entry.Count++
+			entry.Updated = now
+			// move the entry to the front
+			copy(acl.log[1:i+1], acl.log[:i])
+			acl.log[0] = entry
+			return
+		}
+	}
+
+	entry := &LogEntry{Count: 1, Reason: reason, Object: object, Username: username, Created: now, Updated: now}
+	acl.log = append([]*LogEntry{entry}, acl.log...)
+	if len(acl.log) > maxLogLen {
+		acl.log = acl.log[:maxLogLen]
+	}
+}
+
+// Log returns at most count newest entries, all of them when count is negative
+func (acl *ACL) Log(count int) []LogEntry {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	if count < 0 || count > len(acl.log) {
+		count = len(acl.log)
+	}
+	entries := make([]LogEntry, 0, count)
+	for _, entry := range acl.log[:count] {
+		entries = append(entries, *entry)
+	}
+
+	return entries
+}
+
+func (acl *ACL) ResetLog() {
+	acl.mu.Lock()
+	acl.log = nil
+	acl.mu.Unlock()
+}
+
+// LoadFile replaces users with the ones described in the file. Every line is
+// 'user <name> [rule ...]', empty lines and lines starting with # are skipped.
+// The default user keeps its defaults unless the file describes it
+func (acl *ACL) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := map[string]*User{DefaultUser: defaultUser()}
+	redefined := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: line should start with 'user <name>'", path, lineNumber)
+		}
+
+		name := fields[1]
+		if redefined[name] {
+			return fmt.Errorf("%s:%d: user %s is defined twice", path, lineNumber, name)
+		}
+		redefined[name] = true
+		// a described user starts from scratch
+		users[name] = newUser(name)
+
+		if err := acl.setUserWithoutLock(users, name, fields[2:]...); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	acl.mu.Lock()
+	acl.users = users
+	acl.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package acl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUser_CanRun(t *testing.T) {
+	user := newUser("analytics")
+	err := user.setRules("on", ">secret", "~stats:*", "+@read", "-dget")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		command    string
+		categories []string
+		expected   bool
+	}{
+		{command: "GET", categories: []string{Read}, expected: true},
+		{command: "DGET", categories: []string{Read}, expected: false},
+		{command: "REM", categories: []string{Write}, expected: false},
+		{command: "ACL", categories: []string{Admin}, expected: false},
+	}
+
+	for _, testCase := range testCases {
+		assert.EqualValues(t, testCase.expected, user.CanRun(testCase.command, testCase.categories...), testCase.command)
+	}
+
+	{
+		t.Log("It should match keys against patterns")
+		assert.True(t, user.CanAccessKey("stats:daily"))
+		assert.False(t, user.CanAccessKey("users:1"))
+	}
+
+	{
+		t.Log("+@all should override previous rules")
+		err := user.setRules("-@write", "+@all")
+		assert.NoError(t, err)
+		assert.True(t, user.CanRun("DGET", Read))
+		assert.EqualValues(t, []string{"on", "#" + hashPassword("secret"), "~stats:*", "+@all"}, user.Rules())
+	}
+}
+
+func TestUser_CheckPassword(t *testing.T) {
+	user := newUser("app")
+	assert.NoError(t, user.setRules(">first", ">second"))
+
+	{
+		t.Log("Given a disabled user it should refuse any password")
+		assert.False(t, user.CheckPassword("first"))
+	}
+
+	{
+		assert.NoError(t, user.setRules("on", "<first"))
+		assert.False(t, user.CheckPassword("first"))
+		assert.True(t, user.CheckPassword("second"))
+	}
+
+	{
+		err := user.setRules("+@unknown")
+		assert.Error(t, err)
+		err = user.setRules("#abc")
+		assert.Error(t, err)
+	}
+}
+
+func TestACL_LoadFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "users.acl")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	file.WriteString("# analytics jobs\n" +
+		"user analytics on >reader ~* +@read\n" +
+		"\n" +
+		"user admin on #" + hashPassword("admin") + " ~* +@all\n")
+	file.Close()
+
+	acl := NewACL()
+	assert.NoError(t, acl.LoadFile(file.Name()))
+
+	{
+		t.Log("It should load users and keep the default one")
+		_, ok := acl.Authenticate("analytics", "reader")
+		assert.True(t, ok)
+		_, ok = acl.Authenticate("admin", "admin")
+		assert.True(t, ok)
+		_, ok = acl.Authenticate(DefaultUser, "")
+		assert.True(t, ok)
+	}
+
+	{
+		t.Log("Failed attempts should be logged once per user and object")
+		acl.Authenticate("analytics", "wrong")
+		acl.Authenticate("analytics", "wrong")
+		entries := acl.Log(-1)
+		assert.Len(t, entries, 1)
+		assert.EqualValues(t, 2, entries[0].Count)
+		assert.EqualValues(t, ReasonAuth, entries[0].Reason)
+	}
+
+	{
+		t.Log("Given an invalid file it should keep users unchanged")
+		ioutil.WriteFile(file.Name(), []byte("user broken on +@nothing\n"), 0600)
+		assert.Error(t, acl.LoadFile(file.Name()))
+		_, ok := acl.User("analytics")
+		assert.True(t, ok)
+	}
+}
@@ -0,0 +1,241 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"redis_like_in_memory_db/internal/glob"
+	"sort"
+	"strings"
+)
+
+// command categories, a command may belong to several of them
+const (
+	Read  = "read"
+	Write = "write"
+	Admin = "admin"
+	All   = "all"
+)
+
+var categories = map[string]bool{Read: true, Write: true, Admin: true, All: true}
+
+var (
+	unknownCategory = errors.New("unknown command category")
+	invalidHash     = errors.New("password hash should be 64 hex characters")
+)
+
+// commandRule allows or denies either a single command or a category
+type commandRule struct {
+	allow    bool
+	command  string
+	category string
+}
+
+func (rule commandRule) String() string {
+	sign := "-"
+	if rule.allow {
+		sign = "+"
+	}
+	if rule.category != "" {
+		return sign + "@" + rule.category
+	}
+	return sign + strings.ToLower(rule.command)
+}
+
+// User is never modified after it is registered, rules are applied to a copy
+type User struct {
+	Name    string
+	Enabled bool
+	NoPass  bool
+	// sha256 hashes of passwords in hex
+	passwords map[string]bool
+	// applied in order, the last matching rule wins
+	commands    []commandRule
+	keyPatterns []string
+}
+
+func newUser(name string) *User {
+	return &User{Name: name, passwords: make(map[string]bool)}
+}
+
+func (user *User) clone() *User {
+	clone := *user
+	clone.passwords = make(map[string]bool, len(user.passwords))
+	for hash := range user.passwords {
+		clone.passwords[hash] = true
+	}
+	clone.commands = append([]commandRule{}, user.commands...)
+	clone.keyPatterns = append([]string{}, user.keyPatterns...)
+
+	return &clone
+}
+
+func hashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
+
+// setRules applies rules in the ACL SETUSER syntax:
+// on, off, >password, <password, #hash, !hash, nopass, resetpass,
+// +command, -command, +@category, -@category, allcommands, nocommands,
+// ~pattern, allkeys, resetkeys and reset
+func (user *User) setRules(rules ...string) error {
+	for _, rule := range rules {
+		if err := user.setRule(rule); err != nil {
+			return fmt.Errorf("error in ACL rule '%s': %s", rule, err)
+		}
+	}
+
+	return nil
+}
+
+func (user *User) setRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		user.Enabled = true
+		return nil
+	case "off":
+		user.Enabled = false
+		return nil
+	case "nopass":
+		user.NoPass = true
+		user.passwords = make(map[string]bool)
+		return nil
+	case "resetpass":
+		user.NoPass = false
+		user.passwords = make(map[string]bool)
+		return nil
+	case "allcommands":
+		return user.setRule("+@all")
+	case "nocommands":
+		return user.setRule("-@all")
+	case "allkeys":
+		user.keyPatterns = []string{"*"}
+		return nil
+	case "resetkeys":
+		user.keyPatterns = nil
+		return nil
+	case "reset":
+		*user = *newUser(user.Name)
+		return nil
+	}
+
+	if rule == "" {
+		return errors.New("empty rule")
+	}
+
+	switch value := rule[1:]; rule[0] {
+	case '>':
+		user.passwords[hashPassword(value)] = true
+		user.NoPass = false
+	case '<':
+		delete(user.passwords, hashPassword(value))
+	case '#':
+		if _, err := hex.DecodeString(value); err != nil || len(value) != 64 {
+			return invalidHash
+		}
+		user.passwords[strings.ToLower(value)] = true
+		user.NoPass = false
+	case '!':
+		delete(user.passwords, strings.ToLower(value))
+	case '~':
+		user.keyPatterns = append(user.keyPatterns, value)
+	case '+', '-':
+		commandRule := commandRule{allow: rule[0] == '+'}
+		if strings.HasPrefix(value, "@") {
+			commandRule.category = strings.ToLower(value[1:])
+			if !categories[commandRule.category] {
+				return unknownCategory
+			}
+			if commandRule.category == All {
+				// every previous rule is overridden
+				user.commands = nil
+			}
+		} else {
+			commandRule.command = strings.ToUpper(value)
+		}
+		user.commands = append(user.commands, commandRule)
+	default:
+		return errors.New("syntax error")
+	}
+
+	return nil
+}
+
+// CheckPassword reports whether the user is enabled and accepts the password
+func (user *User) CheckPassword(password string) bool {
+	if !user.Enabled {
+		return false
+	}
+
+	return user.NoPass || user.passwords[hashPassword(password)]
+}
+
+// CanRun reports whether the user may execute the command belonging to the categories
+func (user *User) CanRun(command string, commandCategories ...string) bool {
+	allowed := false
+	for _, rule := range user.commands {
+		switch {
+		case rule.category == All:
+			allowed = rule.allow
+		case rule.command == command:
+			allowed = rule.allow
+		case rule.category != "":
+			for _, category := range commandCategories {
+				if rule.category == category {
+					allowed = rule.allow
+				}
+			}
+		}
+	}
+
+	return allowed
+}
+
+// CanAccessKey reports whether the key matches one of the user key patterns
+func (user *User) CanAccessKey(key string) bool {
+	for _, pattern := range user.keyPatterns {
+		if glob.Match(pattern, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rules returns the rules which recreate the user
+func (user *User) Rules() []string {
+	rules := make([]string, 0)
+	if user.Enabled {
+		rules = append(rules, "on")
+	} else {
+		rules = append(rules, "off")
+	}
+
+	if user.NoPass {
+		rules = append(rules, "nopass")
+	}
+	hashes := make([]string, 0, len(user.passwords))
+	for hash := range user.passwords {
+		hashes = append(hashes, "#"+hash)
+	}
+	sort.Strings(hashes)
+	rules = append(rules, hashes...)
+
+	for _, pattern := range user.keyPatterns {
+		rules = append(rules, "~"+pattern)
+	}
+	if len(user.commands) == 0 {
+		rules = append(rules, "-@all")
+	}
+	for _, rule := range user.commands {
+		rules = append(rules, rule.String())
+	}
+
+	return rules
+}
+
+func (user *User) String() string {
+	return fmt.Sprintf("user %s %s", user.Name, strings.Join(user.Rules(), " "))
+}
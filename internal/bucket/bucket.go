@@ -1,18 +1,23 @@
 package bucket
 
 import (
-	"errors"
 	"github.com/spf13/cast"
-	"strings"
+	"redis_like_in_memory_db/internal/reply"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var wrongNumber = errors.New("wrong number of arguments")
+var (
+	wrongNumber  = reply.ErrWrongArgsNumber
+	keyNotExists = reply.ErrKeyNotExists
+)
 
 type Bucket struct {
 	mu      sync.Mutex
 	entries map[string]*node
+	// entries removed on access after their ttl passed
+	expired uint64
 }
 
 type node struct {
@@ -21,6 +26,12 @@ type node struct {
 	ttl   time.Time
 }
 
+// Entry is an exported copy of a stored value used to move keys around
+type Entry struct {
+	Value string
+	TTL   time.Time
+}
+
 func NewBucket() *Bucket {
 	bucket := new(Bucket)
 	bucket.entries = make(map[string]*node)
@@ -78,6 +89,7 @@ func (b *Bucket) get(key string) (string, bool) {
 
 	if n.ttl.Before(time.Now()) {
 		// It has expired
+		atomic.AddUint64(&b.expired, 1)
 		defer b.removeWithoutLock(key)
 		return "", false
 	}
@@ -86,27 +98,78 @@ func (b *Bucket) get(key string) (string, bool) {
 }
 
 // Keys for interface impl
-func (b *Bucket) Keys(args ...string) string {
+func (b *Bucket) Keys(args ...string) []string {
 	if len(args) != 0 {
-		return ""
+		return nil
 	}
 
 	return b.keys()
 }
 
-func (b *Bucket) keys() string {
+func (b *Bucket) keys() []string {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	keys := make([]string, 0)
 	for key, value := range b.entries {
 		if value.ttl.Before(time.Now()) {
+			atomic.AddUint64(&b.expired, 1)
 			b.removeWithoutLock(key)
 		}
 		keys = append(keys, key)
 	}
 
-	return strings.Join(keys, ", ")
+	return keys
+}
+
+// Range calls fn for every key which has not expired. fn is called with the
+// bucket locked and must not call the bucket back
+func (b *Bucket) Range(fn func(key string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for key, value := range b.entries {
+		if value.ttl.Before(now) {
+			continue
+		}
+		fn(key)
+	}
+}
+
+// RandomKeys returns up to n keys which have not expired, they start at a
+// random position of the map iteration
+func (b *Bucket) RandomKeys(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, n)
+	for key, value := range b.entries {
+		if len(keys) == n {
+			break
+		}
+		if value.ttl.Before(now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Expired returns the number of entries removed because their ttl has passed
+func (b *Bucket) Expired() uint64 {
+	return atomic.LoadUint64(&b.expired)
+}
+
+// Size returns the number of stored keys without walking them, expired keys
+// are counted until they are removed
+func (b *Bucket) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.entries)
 }
 
 func (b *Bucket) Len(args ...string) int {
@@ -144,5 +207,37 @@ func (b *Bucket) removeWithoutLock(key string) error {
 		return nil
 	}
 
-	return errors.New("key does not exist")
+	return keyNotExists
+}
+
+// Exists reports whether key is stored and has not expired
+func (b *Bucket) Exists(key string) bool {
+	_, ok := b.get(key)
+	return ok
+}
+
+// Delete removes key and reports whether it has been stored
+func (b *Bucket) Delete(key string) bool {
+	return b.remove(key) == nil
+}
+
+// Dump returns a copy of the entry stored by key
+func (b *Bucket) Dump(key string) (Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, ok := b.entries[key]
+	if !ok || n.ttl.Before(time.Now()) {
+		return Entry{}, false
+	}
+
+	return Entry{Value: n.value, TTL: n.ttl}, true
+}
+
+// Restore stores entry by key keeping its expiration time
+func (b *Bucket) Restore(key string, entry Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[key] = &node{key: key, value: entry.Value, ttl: entry.TTL}
 }
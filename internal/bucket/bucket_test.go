@@ -3,7 +3,6 @@ package bucket
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
-	"strings"
 	"testing"
 	"time"
 )
@@ -68,7 +67,7 @@ func TestBucket_Keys(t *testing.T) {
 	testCases := setupTestCases(t, bucket)
 	keys := bucket.Keys()
 
-	assert.EqualValues(t, len(strings.Split(keys, ", ")), len(testCases))
+	assert.EqualValues(t, len(keys), len(testCases))
 	for _, testCase := range testCases {
 		assert.Containsf(t, keys, testCase.key, "error message %s", "formatted")
 	}
@@ -121,3 +120,19 @@ func setupTestCases(t *testing.T, bucket *Bucket) []struct {
 
 	return testCases
 }
+
+func TestBucket_Expired(t *testing.T) {
+	buck := NewBucket()
+	buck.Set("short", "lived", "1ms")
+	buck.Set("long", "lived", "10m")
+	time.Sleep(5 * time.Millisecond)
+
+	{
+		t.Log("Given an expired key Size should count it until it is removed on access")
+		assert.EqualValues(t, 2, buck.Size())
+		_, ok := buck.Get("short")
+		assert.False(t, ok)
+		assert.EqualValues(t, 1, buck.Size())
+		assert.EqualValues(t, 1, buck.Expired())
+	}
+}
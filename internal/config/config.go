@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Param is a single 'name value' line of a config file
+type Param struct {
+	Name  string
+	Value string
+	// line number for error messages
+	Line int
+}
+
+// File is a config file in the redis.conf format: a parameter per line,
+// the name and the value are separated by spaces, lines starting with # are
+// comments. Values with spaces are put in double quotes
+type File struct {
+	Path string
+	// lines are kept as is, so that REWRITE does not lose comments
+	lines []string
+}
+
+func Load(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := &File{Path: path, lines: make([]string, 0)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		config.lines = append(config.lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := config.Params(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Params returns parameters in order of lines
+func (config *File) Params() ([]Param, error) {
+	params := make([]Param, 0)
+	for i, line := range config.lines {
+		name, value, ok, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", config.Path, i+1, err)
+		}
+		if ok {
+			params = append(params, Param{Name: name, Value: value, Line: i + 1})
+		}
+	}
+
+	return params, nil
+}
+
+func parseLine(line string) (string, string, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+
+	separator := strings.IndexAny(line, " \t")
+	if separator == -1 {
+		return "", "", false, fmt.Errorf("parameter %s has no value", line)
+	}
+
+	name := strings.ToLower(line[:separator])
+	value := strings.TrimSpace(line[separator:])
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", "", false, fmt.Errorf("invalid quoted value of %s", name)
+		}
+		value = unquoted
+	}
+	return name, value, true, nil
+}
+
+func formatLine(name, value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"#") {
+		value = strconv.Quote(value)
+	}
+	return name + " " + value
+}
+
+// Rewrite replaces values of the parameters in place and appends the missing
+// ones, comments and other lines are kept. The file is replaced only once
+// the new content is written
+func (config *File) Rewrite(values map[string]string) error {
+	written := make(map[string]bool)
+	lines := make([]string, 0, len(config.lines)+len(values))
+	for _, line := range config.lines {
+		name, _, ok, _ := parseLine(line)
+		value, changed := values[name]
+		switch {
+		case !ok || !changed:
+			lines = append(lines, line)
+		case !written[name]:
+			// repeated parameters collapse into the first line
+			lines = append(lines, formatLine(name, value))
+			written[name] = true
+		}
+	}
+
+	appended := make([]string, 0)
+	for name := range values {
+		if !written[name] {
+			appended = append(appended, name)
+		}
+	}
+	sort.Strings(appended)
+	for _, name := range appended {
+		lines = append(lines, formatLine(name, values[name]))
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(config.Path), "temp-config")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(config.Path); err == nil {
+		os.Chmod(temp.Name(), info.Mode())
+	}
+	if err := os.Rename(temp.Name(), config.Path); err != nil {
+		return err
+	}
+
+	config.lines = lines
+	return nil
+}
+
+// ParseMemory parses a number of bytes with an optional kb, mb or gb suffix
+func ParseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"b", 1}}
+
+	lower := strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid memory size %s", value)
+	}
+	return number * multiplier, nil
+}
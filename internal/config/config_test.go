@@ -0,0 +1,77 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "server.conf")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, "# server\nport :9000\n\nrequirepass \"with space\"\nMaxClients\t100\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := Load(path)
+	assert.NoError(t, err)
+	params, err := file.Params()
+	assert.NoError(t, err)
+	assert.Equal(t, []Param{
+		{Name: "port", Value: ":9000", Line: 2},
+		{Name: "requirepass", Value: "with space", Line: 4},
+		{Name: "maxclients", Value: "100", Line: 5},
+	}, params)
+
+	{
+		t.Log("invalid lines")
+		broken := writeConfig(t, "port\n")
+		defer os.RemoveAll(filepath.Dir(broken))
+		_, err := Load(broken)
+		assert.EqualError(t, err, broken+":1: parameter port has no value")
+
+		quoted := writeConfig(t, "requirepass \"unterminated\n")
+		defer os.RemoveAll(filepath.Dir(quoted))
+		_, err = Load(quoted)
+		assert.Error(t, err)
+	}
+}
+
+func TestFile_Rewrite(t *testing.T) {
+	path := writeConfig(t, "# server\nport :9000\nmaxclients 10\nmaxclients 20\nunknown value\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := Load(path)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Rewrite(map[string]string{"maxclients": "100", "requirepass": "a b", "timeout": "1m0s"}))
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# server\nport :9000\nmaxclients 100\nunknown value\nrequirepass \"a b\"\ntimeout 1m0s\n", string(content))
+
+	reloaded, err := Load(path)
+	assert.NoError(t, err)
+	params, err := reloaded.Params()
+	assert.NoError(t, err)
+	assert.Equal(t, "a b", params[3].Value)
+}
+
+func TestParseMemory(t *testing.T) {
+	for value, expected := range map[string]int64{"0": 0, "100": 100, "10b": 10, "2kb": 2048, "100mb": 100 << 20, "1GB": 1 << 30} {
+		bytes, err := ParseMemory(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, bytes, value)
+	}
+
+	for _, value := range []string{"", "mb", "-1mb", "1tb"} {
+		_, err := ParseMemory(value)
+		assert.Error(t, err, value)
+	}
+}
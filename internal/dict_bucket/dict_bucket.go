@@ -1,23 +1,26 @@
 package dict_bucket
 
 import (
-	"errors"
 	"github.com/spf13/cast"
-	"strings"
+	"redis_like_in_memory_db/internal/reply"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	dictionaryNotExists = errors.New("dictionary does not exist")
-	keyNotFound         = errors.New("key not found")
-	keyExpired          = errors.New("key has expired")
-	wrongArgNum         = errors.New("wrong arguments number")
+	dictionaryNotExists = reply.ErrDictNotExists
+	keyNotFound         = reply.ErrDictKeyNotFound
+	keyExpired          = reply.ErrDictKeyExpired
+	wrongArgNum         = reply.ErrWrongArgsNumber
 )
 
 type DictBucket struct {
 	mu      sync.Mutex
 	entries map[string]map[string]*dictNode
+	// entries removed on access after their ttl passed
+	expired uint64
 }
 
 type dictNode struct {
@@ -25,6 +28,12 @@ type dictNode struct {
 	ttl   time.Time
 }
 
+// Entry is an exported copy of a dictionary value used to move keys around
+type Entry struct {
+	Value string
+	TTL   time.Time
+}
+
 func NewBucket() *DictBucket {
 	bucket := new(DictBucket)
 	bucket.entries = make(map[string]map[string]*dictNode)
@@ -68,6 +77,7 @@ func (b *DictBucket) set(dictName, key, value string, expiration time.Duration)
 	}
 	// check expiration
 	if dictNode.ttl.Before(time.Now()) {
+		atomic.AddUint64(&b.expired, 1)
 		err := b.removeWithoutLock(dictName, key)
 		if err != nil {
 			return err
@@ -93,23 +103,119 @@ func (b *DictBucket) Get(args ...string) (string, bool) {
 func (b *DictBucket) get(dictName, key string) (string, bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	// dictionary check
-	dict, ok := b.entries[dictName]
+
+	node, ok := b.liveWithoutLock(dictName, key, time.Now())
 	if !ok {
 		return "", false
 	}
-	// key check
-	dictNode, ok := dict[key]
+
+	return node.value, true
+}
+
+// SetMany stores fields of the dictionary with the same ttl, args are the
+// dictionary name, field and value pairs and the ttl. Expired fields are
+// replaced like missing ones
+func (b *DictBucket) SetMany(args ...string) error {
+	if len(args) < 4 || len(args)%2 != 0 {
+		return wrongArgNum
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dictName := args[0]
+	ttl := time.Now().Add(cast.ToDuration(args[len(args)-1]))
+	dict, ok := b.entries[dictName]
 	if !ok {
-		return "", false
+		dict = make(map[string]*dictNode)
+		b.entries[dictName] = dict
+	}
+	for i := 1; i < len(args)-1; i += 2 {
+		dict[args[i]] = &dictNode{value: args[i+1], ttl: ttl}
 	}
 
-	if dictNode.ttl.Before(time.Now()) {
+	return nil
+}
+
+// GetMany returns values of the fields, args are the dictionary name and the
+// fields. found is false for fields which do not exist or have expired
+func (b *DictBucket) GetMany(args ...string) (values []string, found []bool) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dictName := args[0]
+	now := time.Now()
+	values = make([]string, len(args)-1)
+	found = make([]bool, len(args)-1)
+	for i, key := range args[1:] {
+		if node, ok := b.liveWithoutLock(dictName, key, now); ok {
+			values[i], found[i] = node.value, true
+		}
+	}
+
+	return values, found
+}
+
+// GetAll returns field and value pairs of the dictionary ordered by field,
+// the list is empty when the dictionary does not exist
+func (b *DictBucket) GetAll(args ...string) []string {
+	if len(args) != 1 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dictName := args[0]
+	now := time.Now()
+	keys := make([]string, 0, len(b.entries[dictName]))
+	for key := range b.entries[dictName] {
+		if _, ok := b.liveWithoutLock(dictName, key, now); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key, b.entries[dictName][key].value)
+	}
+
+	return pairs
+}
+
+// liveWithoutLock returns the node of the field, an expired one is removed
+// and counted. Every read filters expired fields with it
+func (b *DictBucket) liveWithoutLock(dictName, key string, now time.Time) (*dictNode, bool) {
+	node, ok := b.entries[dictName][key]
+	if !ok {
+		return nil, false
+	}
+	if node.ttl.Before(now) {
+		atomic.AddUint64(&b.expired, 1)
 		b.removeWithoutLock(dictName, key)
-		return "", false
+		return nil, false
 	}
 
-	return dictNode.value, true
+	return node, true
+}
+
+// Expired returns the number of entries removed because their ttl has passed
+func (b *DictBucket) Expired() uint64 {
+	return atomic.LoadUint64(&b.expired)
+}
+
+// Size returns the number of stored keys without walking them, expired keys
+// are counted until they are removed
+func (b *DictBucket) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.entries)
 }
 
 func (b *DictBucket) Len(args ...string) int {
@@ -131,43 +237,81 @@ func (b *DictBucket) len(dictName string) int {
 	}
 
 	count := 0
-	for key, value := range dict {
-		if value.ttl.After(time.Now()) {
+	now := time.Now()
+	for key := range dict {
+		if _, ok := b.liveWithoutLock(dictName, key, now); ok {
 			count++
-			continue
 		}
-
-		b.removeWithoutLock(dictName, key)
 	}
 
 	return count
 }
 
-func (b *DictBucket) Keys(args ...string) string {
+func (b *DictBucket) Keys(args ...string) []string {
 	if len(args) != 1 {
-		return ""
+		return nil
 	}
 
 	dictName := args[0]
 	return b.keys(dictName)
 }
 
-func (b *DictBucket) keys(dictName string) string {
-	dictLen := b.Len(dictName)
-	if dictLen == -1 {
-		return ""
-	}
+func (b *DictBucket) keys(dictName string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
 	keys := make([]string, 0)
-	for key, value := range b.entries[dictName] {
-		if value.ttl.Before(time.Now()) {
-			b.removeWithoutLock(dictName, key)
+	now := time.Now()
+	for key := range b.entries[dictName] {
+		if _, ok := b.liveWithoutLock(dictName, key, now); ok {
+			keys = append(keys, key)
 		}
+	}
+
+	return keys
+}
 
+// Range calls fn for every dictionary name. fn is called with the bucket
+// locked and must not call the bucket back
+func (b *DictBucket) Range(fn func(dictName string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for dictName := range b.entries {
+		fn(dictName)
+	}
+}
+
+// RandomKeys returns up to n keys, they start at a random position of the
+// map iteration
+func (b *DictBucket) RandomKeys(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0, n)
+	for key := range b.entries {
+		if len(keys) == n {
+			break
+		}
 		keys = append(keys, key)
 	}
 
-	return strings.Join(keys, ", ")
+	return keys
+}
+
+// RangeFields calls fn for every key of the dictionary which has not expired.
+// fn is called with the bucket locked and must not call the bucket back
+func (b *DictBucket) RangeFields(dictName string, fn func(key, value string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for key, node := range b.entries[dictName] {
+		if node.ttl.Before(now) {
+			continue
+		}
+		fn(key, node.value)
+	}
 }
 
 func (b *DictBucket) Remove(args ...string) error {
@@ -210,3 +354,63 @@ func (b *DictBucket) removeWithoutLock(dictName, key string) error {
 
 	return nil
 }
+
+// Exists reports whether the dictionary has a field which has not expired,
+// expired fields met on the way are removed
+func (b *DictBucket) Exists(dictName string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for key := range b.entries[dictName] {
+		if _, ok := b.liveWithoutLock(dictName, key, now); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delete removes the whole dictionary and reports whether it has been stored
+func (b *DictBucket) Delete(dictName string) bool {
+	return b.remove(dictName, "") == nil
+}
+
+// Dump returns a copy of dictionary values which have not expired
+func (b *DictBucket) Dump(dictName string) (map[string]Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dict, ok := b.entries[dictName]
+	if !ok {
+		return nil, false
+	}
+
+	entries := make(map[string]Entry, len(dict))
+	now := time.Now()
+	for key, node := range dict {
+		if node.ttl.Before(now) {
+			continue
+		}
+		entries[key] = Entry{Value: node.value, TTL: node.ttl}
+	}
+
+	return entries, len(entries) != 0
+}
+
+// Restore replaces the dictionary with entries keeping their expiration time
+func (b *DictBucket) Restore(dictName string, entries map[string]Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(entries) == 0 {
+		delete(b.entries, dictName)
+		return
+	}
+
+	dict := make(map[string]*dictNode, len(entries))
+	for key, entry := range entries {
+		dict[key] = &dictNode{value: entry.Value, ttl: entry.TTL}
+	}
+	b.entries[dictName] = dict
+}
@@ -3,7 +3,6 @@ package dict_bucket
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
-	"strings"
 	"testing"
 	"time"
 )
@@ -96,7 +95,7 @@ func TestDictBucket_Keys(t *testing.T) {
 	testCases := setupTestCases(t, bucket)
 
 	{
-		keys := strings.Split(bucket.Keys("dict"), ", ")
+		keys := bucket.Keys("dict")
 		for _, testCase := range testCases {
 			assert.Contains(t, keys, testCase.key)
 		}
@@ -105,15 +104,54 @@ func TestDictBucket_Keys(t *testing.T) {
 	{
 		expected := "i will expire"
 		bucket.Set("dict", expected, "soon", "50ms")
-		keys := strings.Split(bucket.Keys("dict"), ", ")
+		keys := bucket.Keys("dict")
 
 		assert.Contains(t, keys, expected)
 		<-time.After(51 * time.Millisecond)
-		keys = strings.Split(bucket.Keys("dict"), ", ")
+		keys = bucket.Keys("dict")
 		assert.NotContains(t, keys, expected)
 	}
 }
 
+func TestDictBucket_Many(t *testing.T) {
+	bucket := NewBucket()
+
+	{
+		t.Log("Given fields set at once it should return them at once")
+		assert.NoError(t, bucket.SetMany("user", "name", "ann", "city", "paris", "10m"))
+		values, found := bucket.GetMany("user", "name", "missing", "city")
+		assert.EqualValues(t, []string{"ann", "", "paris"}, values)
+		assert.EqualValues(t, []bool{true, false, true}, found)
+		assert.EqualValues(t, []string{"city", "paris", "name", "ann"}, bucket.GetAll("user"))
+		assert.EqualValues(t, []string{}, bucket.GetAll("missing"))
+	}
+
+	{
+		t.Log("Given an expired field every read should skip it and remove it once")
+		assert.NoError(t, bucket.SetMany("user", "token", "t-1", "50ms"))
+		<-time.After(51 * time.Millisecond)
+		assert.NotContains(t, bucket.Keys("user"), "token")
+		assert.EqualValues(t, []string{"city", "paris", "name", "ann"}, bucket.GetAll("user"))
+		_, found := bucket.GetMany("user", "token")
+		assert.EqualValues(t, []bool{false}, found)
+		assert.EqualValues(t, 2, bucket.Len("user"))
+		assert.EqualValues(t, 1, bucket.Expired())
+
+		t.Log("and it should be set again like a missing field")
+		assert.NoError(t, bucket.SetMany("user", "token", "t-2", "10m"))
+		value, ok := bucket.Get("user", "token")
+		assert.True(t, ok)
+		assert.EqualValues(t, "t-2", value)
+	}
+
+	{
+		t.Log("Given wrong arguments it should fail")
+		assert.Error(t, bucket.SetMany("user", "name", "10m"))
+		assert.Error(t, bucket.SetMany("user", "name", "ann", "city", "10m"))
+		assert.Nil(t, bucket.GetAll())
+	}
+}
+
 func setupTestCases(t *testing.T, bucket *DictBucket) []struct {
 	dictKey, key, value, duration string
 } {
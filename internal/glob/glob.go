@@ -0,0 +1,107 @@
+package glob
+
+// Match reports whether str matches the glob-style pattern. Supported syntax:
+// '*' matches any sequence, '?' matches a single character, '[abc]', '[a-z]'
+// and '[^a]' match character classes, '\' escapes the next character
+func Match(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// collapse consecutive stars
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if Match(pattern, str[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			str = str[1:]
+
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], str[0])
+			if !ok {
+				// unterminated class is matched literally
+				if str[0] != '[' {
+					return false
+				}
+				pattern = pattern[1:]
+				str = str[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pattern = rest
+			str = str[1:]
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+			pattern = pattern[1:]
+			str = str[1:]
+		}
+	}
+
+	return len(str) == 0
+}
+
+// matchClass matches char against a class body (everything after '[') and
+// returns the pattern remaining after the closing ']'
+func matchClass(class string, char byte) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(class) > 0 && class[0] == '^' {
+		negate = true
+		class = class[1:]
+	}
+
+	for i := 0; i < len(class); i++ {
+		switch {
+		case class[i] == ']':
+			return matched != negate, class[i+1:], true
+
+		case class[i] == '\\' && i+1 < len(class):
+			i++
+			if class[i] == char {
+				matched = true
+			}
+
+		case i+2 < len(class) && class[i+1] == '-' && class[i+2] != ']':
+			low, high := class[i], class[i+2]
+			if low > high {
+				low, high = high, low
+			}
+			if char >= low && char <= high {
+				matched = true
+			}
+			i += 2
+
+		default:
+			if class[i] == char {
+				matched = true
+			}
+		}
+	}
+
+	return false, "", false
+}
@@ -0,0 +1,42 @@
+package glob
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern, str string
+		expected     bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:42", true},
+		{"user:*", "session:42", false},
+		{"*:42", "user:42", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"path/*", "path/to/file", true},
+		{"[abc", "[abc", true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase // preserve variable copy within current closure
+		t.Run(testCase.pattern+" "+testCase.str, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, testCase.expected, Match(testCase.pattern, testCase.str))
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package global_cache
+
+import (
+	"errors"
+	"fmt"
+	"redis_like_in_memory_db/internal/acl"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+)
+
+var (
+	noAuth        = reply.ErrAuthRequired
+	wrongPassword = reply.ErrWrongPassword
+	invalidCount  = errors.New("count should be a positive integer")
+)
+
+// NewSession starts a connection as the default user, it is authenticated
+// right away unless the default user requires a password
+func (cache *GlobalCache) NewSession() *Session {
+	session := &Session{User: acl.DefaultUser}
+	if user, ok := cache.users.User(acl.DefaultUser); ok && user.Enabled && user.NoPass {
+		session.authenticated = true
+	}
+
+	return session
+}
+
+// AuthenticateUser switches the session to an enabled user without checking
+// the password, the caller has verified the user otherwise, e.g. by a
+// client certificate
+func (cache *GlobalCache) AuthenticateUser(session *Session, name string) bool {
+	user, ok := cache.users.User(name)
+	if !ok || !user.Enabled {
+		return false
+	}
+	session.User = name
+	session.authenticated = true
+
+	return true
+}
+
+// SetUser creates or modifies the ACL user as ACL SETUSER does
+func (cache *GlobalCache) SetUser(name string, rules ...string) error {
+	return cache.users.SetUser(name, rules...)
+}
+
+// LoadACLFile replaces ACL users with the ones described in the file
+func (cache *GlobalCache) LoadACLFile(path string) error {
+	return cache.users.LoadFile(path)
+}
+
+// Authorize reports whether the session may execute a command handled
+// outside of the cache, e.g. by the server
+func (cache *GlobalCache) Authorize(session *Session, args []string) error {
+	_, err := cache.authorize(session, args)
+	return err
+}
+
+// authorize returns the user of the session when it may execute the command,
+// sessions without a user are not restricted and get nil
+func (cache *GlobalCache) authorize(session *Session, args []string) (*acl.User, error) {
+	if session.User == "" {
+		return nil, nil
+	}
+	if !session.authenticated {
+		return nil, noAuth
+	}
+
+	user, ok := cache.users.User(session.User)
+	if !ok {
+		// the user was deleted, the connection has to authenticate again
+		session.authenticated = false
+		return nil, noAuth
+	}
+
+	return user, cache.checkUser(user, args)
+}
+
+// checkUser reports whether the user may execute the command with its keys,
+// denied attempts are written to the ACL log
+func (cache *GlobalCache) checkUser(user *acl.User, args []string) error {
+	info, ok := commandTable[args[0]]
+	if !ok {
+		// unknown commands are never dispatched, so they are refused for anyone
+		return commandNotFound
+	}
+
+	if !user.CanRun(args[0], info.categories()...) {
+		cache.users.LogDenied(acl.ReasonCommand, args[0], user.Name)
+		return reply.NewError(reply.CodeNoPerm, fmt.Sprintf("user %s has no permissions to run the '%s' command", user.Name, args[0]))
+	}
+	for _, key := range commandKeys(args) {
+		if !user.CanAccessKey(key) {
+			cache.users.LogDenied(acl.ReasonKey, key, user.Name)
+			return reply.NewError(reply.CodeNoPerm, fmt.Sprintf("user %s has no permissions to access the '%s' key", user.Name, key))
+		}
+	}
+
+	return nil
+}
+
+// AUTH [username] password
+func (cache *GlobalCache) authCommand(session *Session, args []string) reply.Reply {
+	name, password := acl.DefaultUser, ""
+	switch len(args) {
+	case 2:
+		password = args[1]
+	case 3:
+		name, password = args[1], args[2]
+	default:
+		return reply.Err(wrongArgsNumber)
+	}
+
+	if _, ok := cache.users.Authenticate(name, password); !ok {
+		return reply.Err(wrongPassword)
+	}
+	session.User = name
+	session.authenticated = true
+
+	return reply.OK
+}
+
+// ACL SETUSER|GETUSER|DELUSER|LIST|WHOAMI|LOG
+func (cache *GlobalCache) aclCommand(session *Session, args []string) reply.Reply {
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	switch args[1] {
+	// ACL SETUSER username [rule ...]
+	case "SETUSER":
+		if len(args) < 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		if err := cache.users.SetUser(args[2], args[3:]...); err != nil {
+			return reply.Err(err)
+		}
+		return reply.OK
+
+	// ACL GETUSER username
+	case "GETUSER":
+		if len(args) != 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		user, ok := cache.users.User(args[2])
+		if !ok {
+			return reply.Nil
+		}
+		return reply.Value(strings.Join(user.Rules(), " "))
+
+	// ACL DELUSER username [username ...]
+	case "DELUSER":
+		if len(args) < 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		count, err := cache.users.DeleteUsers(args[2:]...)
+		if err != nil {
+			return reply.Err(err)
+		}
+		return reply.Integer(int64(count))
+
+	case "LIST":
+		users := make([]string, 0)
+		for _, user := range cache.users.Users() {
+			users = append(users, user.String())
+		}
+		return reply.Values(users)
+
+	case "WHOAMI":
+		if session.User == "" {
+			return reply.Value(acl.DefaultUser)
+		}
+		return reply.Value(session.User)
+
+	// ACL LOG [count|RESET]
+	case "LOG":
+		if len(args) > 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		count := -1
+		if len(args) == 3 {
+			if args[2] == "RESET" {
+				cache.users.ResetLog()
+				return reply.OK
+			}
+			var err error
+			if count, err = strconv.Atoi(args[2]); err != nil || count < 0 {
+				return reply.Err(invalidCount)
+			}
+		}
+
+		entries := make([]string, 0)
+		for _, entry := range cache.users.Log(count) {
+			entries = append(entries, entry.String())
+		}
+		return reply.Values(entries)
+	}
+
+	return reply.Err(commandNotFound)
+}
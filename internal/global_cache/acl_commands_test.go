@@ -0,0 +1,88 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGlobalCache_ACL(t *testing.T) {
+	cache := NewCache(8, false)
+	cache.ProcessCommand([]string{"SET", "stats:daily", "42", "1h"})
+	cache.ProcessCommand([]string{"SET", "users:1", "moose", "1h"})
+	reply := cache.ProcessCommand([]string{"ACL", "SETUSER", "analytics", "on", ">reader", "~stats:*", "+@read"})
+	assert.EqualValues(t, "Success\n", reply)
+
+	session := cache.NewSession()
+	assert.True(t, session.Authenticated())
+
+	{
+		t.Log("Given a wrong password it should keep the session user")
+		reply := cache.ProcessSessionCommand(session, []string{"AUTH", "analytics", "wrong"})
+		assert.EqualValues(t, errorReply(wrongPassword), reply)
+		assert.EqualValues(t, "default\n", cache.ProcessSessionCommand(session, []string{"ACL", "WHOAMI"}))
+	}
+
+	assert.EqualValues(t, "Success\n", cache.ProcessSessionCommand(session, []string{"AUTH", "analytics", "reader"}))
+
+	{
+		t.Log("A read-only user should read allowed keys only")
+		assert.EqualValues(t, "42\n", cache.ProcessSessionCommand(session, []string{"GET", "stats:daily"}))
+
+		reply := cache.ProcessSessionCommand(session, []string{"REM", "stats:daily"})
+		assert.EqualValues(t, "-NOPERM user analytics has no permissions to run the 'REM' command\n", reply)
+		reply = cache.ProcessSessionCommand(session, []string{"GET", "users:1"})
+		assert.EqualValues(t, "-NOPERM user analytics has no permissions to access the 'users:1' key\n", reply)
+		reply = cache.ProcessSessionCommand(session, []string{"ACL", "SETUSER", "analytics", "+@all"})
+		assert.Contains(t, reply, "no permissions to run the 'ACL' command")
+	}
+
+	{
+		t.Log("Unknown commands should be refused instead of being taken for similar ones")
+		for _, args := range [][]string{{"XREM", "stats:daily"}, {"XGET", "users:1"}, {"XREM", "users:1"}} {
+			reply := cache.ProcessSessionCommand(session, args)
+			assert.EqualValues(t, errorReply(commandNotFound), reply, args)
+		}
+		assert.EqualValues(t, "42\n", cache.ProcessCommand([]string{"GET", "stats:daily"}))
+		assert.EqualValues(t, "moose\n", cache.ProcessCommand([]string{"GET", "users:1"}))
+		assert.EqualValues(t, errorReply(commandNotFound), cache.ProcessCommand([]string{"XREM", "users:1"}))
+	}
+
+	{
+		t.Log("Scripts should not bypass permissions")
+		reply := cache.ProcessSessionCommand(session, []string{"EVAL", "return redis.pcall('REM', KEYS[1])", "1", "stats:daily"})
+		assert.Contains(t, reply, "no permissions to run the 'REM' command")
+		assert.EqualValues(t, "42\n", cache.ProcessCommand([]string{"GET", "stats:daily"}))
+	}
+
+	{
+		t.Log("Denied attempts should be logged")
+		entries := cache.Execute(&Session{}, []string{"ACL", "LOG"}).Strings()
+		assert.Len(t, entries, 4)
+		assert.Contains(t, entries[0], "count=2 reason=command object=REM username=analytics")
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"ACL", "LOG", "RESET"}))
+		assert.Equal(t, []string{}, cache.Execute(&Session{}, []string{"ACL", "LOG"}).Strings())
+	}
+
+	{
+		t.Log("Given a deleted user the session should authenticate again")
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"ACL", "DELUSER", "analytics"}))
+		reply := cache.ProcessSessionCommand(session, []string{"GET", "stats:daily"})
+		assert.EqualValues(t, errorReply(noAuth), reply)
+		reply = cache.ProcessCommand([]string{"ACL", "DELUSER", "default"})
+		assert.EqualValues(t, "-ERR the default user can not be removed\n", reply)
+	}
+}
+
+func TestGlobalCache_DefaultUserPassword(t *testing.T) {
+	cache := NewCache(8, false)
+	assert.NoError(t, cache.SetUser("default", "resetpass", ">password"))
+
+	session := cache.NewSession()
+	assert.False(t, session.Authenticated())
+	assert.EqualValues(t, errorReply(noAuth), cache.ProcessSessionCommand(session, []string{"GET", "key"}))
+
+	assert.EqualValues(t, "Success\n", cache.ProcessSessionCommand(session, []string{"AUTH", "password"}))
+	assert.EqualValues(t, "Success\n", cache.ProcessSessionCommand(session, []string{"SET", "key", "value", "1h"}))
+	assert.EqualValues(t, "user default on #5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8 ~* +@all\n",
+		cache.ProcessCommand([]string{"ACL", "LIST"}))
+}
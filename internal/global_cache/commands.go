@@ -0,0 +1,148 @@
+package global_cache
+
+import "redis_like_in_memory_db/internal/acl"
+
+// commandInfo describes a command for callers that have to know which keys it
+// touches and whether it modifies the dataset (scripts, read-only contexts)
+type commandInfo struct {
+	write bool
+	// position of the first and the last key argument, 0 when the command
+	// takes no keys; negative lastKey counts from the end of arguments
+	firstKey int
+	lastKey  int
+	keyStep  int
+	// command can not be called from within a script
+	noScript bool
+	// command manages the server rather than data
+	admin bool
+	// type of keys the command works with, empty for keyspace commands
+	family string
+	// command may grow the dataset, it is refused above maxmemory
+	denyOOM bool
+}
+
+var commandTable = map[string]commandInfo{
+	"GET":  {firstKey: 1, lastKey: 1, keyStep: 1, family: "string"},
+	"SET":  {write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "string"},
+	"REM":  {write: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "string"},
+	"KEYS": {},
+	"LEN":  {},
+	"SCAN": {},
+
+	"MGET":   {firstKey: 1, lastKey: -1, keyStep: 1, family: "string"},
+	"MSET":   {write: true, denyOOM: true, firstKey: 1, lastKey: -2, keyStep: 2, family: "string"},
+	"MSETNX": {write: true, denyOOM: true, firstKey: 1, lastKey: -2, keyStep: 2, family: "string"},
+
+	"DEL":       {write: true, firstKey: 1, lastKey: -1, keyStep: 1},
+	"UNLINK":    {write: true, firstKey: 1, lastKey: -1, keyStep: 1},
+	"EXISTS":    {firstKey: 1, lastKey: -1, keyStep: 1},
+	"TYPE":      {firstKey: 1, lastKey: 1, keyStep: 1},
+	"RENAME":    {write: true, firstKey: 1, lastKey: 2, keyStep: 1},
+	"RENAMENX":  {write: true, firstKey: 1, lastKey: 2, keyStep: 1},
+	"COPY":      {write: true, denyOOM: true, firstKey: 1, lastKey: 2, keyStep: 1},
+	"RANDOMKEY": {},
+
+	"MOVE":     {write: true, firstKey: 1, lastKey: 1, keyStep: 1},
+	"DBSIZE":   {},
+	"SELECT":   {noScript: true},
+	"SWAPDB":   {write: true, noScript: true, admin: true},
+	"FLUSHDB":  {write: true, noScript: true, admin: true},
+	"FLUSHALL": {write: true, noScript: true, admin: true},
+
+	"ZGET":  {firstKey: 1, lastKey: 1, keyStep: 1, family: "list"},
+	"ZSET":  {write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "list"},
+	"ZREM":  {write: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "list"},
+	"ZKEYS": {firstKey: 1, lastKey: 1, keyStep: 1, family: "list"},
+	"ZLEN":  {firstKey: 1, lastKey: 1, keyStep: 1, family: "list"},
+	"ZSCAN": {firstKey: 1, lastKey: 1, keyStep: 1, family: "list"},
+
+	"DGET":  {firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+	"DSET":  {write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+	"DREM":  {write: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+	"DKEYS": {firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+	"DLEN":  {firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+	"DSCAN": {firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+
+	"HMGET":   {firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+	"HMSET":   {write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+	"HGETALL": {firstKey: 1, lastKey: 1, keyStep: 1, family: "dict"},
+
+	"JSON.GET":       {firstKey: 1, lastKey: 1, keyStep: 1, family: "json"},
+	"JSON.TYPE":      {firstKey: 1, lastKey: 1, keyStep: 1, family: "json"},
+	"JSON.SET":       {write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "json"},
+	"JSON.DEL":       {write: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "json"},
+	"JSON.ARRAPPEND": {write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "json"},
+	"JSON.NUMINCRBY": {write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, family: "json"},
+
+	"EVAL":    {noScript: true},
+	"EVALSHA": {noScript: true},
+	"SCRIPT":  {noScript: true, admin: true},
+
+	"FCALL":    {noScript: true},
+	"FCALL_RO": {noScript: true},
+	"FUNCTION": {write: true, noScript: true, admin: true},
+
+	"AUTH": {noScript: true},
+	"ACL":  {noScript: true, admin: true},
+
+	"SAVE":     {noScript: true, admin: true},
+	"INFO":     {noScript: true, admin: true},
+	"SLOWLOG":  {noScript: true, admin: true},
+	"LATENCY":  {noScript: true, admin: true},
+	"MONITOR":  {noScript: true, admin: true},
+	"CONFIG":   {noScript: true, admin: true},
+	"SHUTDOWN": {noScript: true, admin: true},
+	"CLIENT":   {noScript: true, admin: true},
+}
+
+// IsWriteCommand reports whether the command may modify the dataset,
+// scripts and functions are counted in since they may call write commands
+func IsWriteCommand(command string) bool {
+	switch command {
+	case "EVAL", "EVALSHA", "FCALL":
+		return true
+	}
+
+	return commandTable[command].write
+}
+
+// categories returns ACL categories of the command, administrative commands
+// are not readable even if they do not modify the dataset
+func (info commandInfo) categories() []string {
+	categories := make([]string, 0, 2)
+	switch {
+	case info.write:
+		categories = append(categories, acl.Write)
+	case !info.admin:
+		categories = append(categories, acl.Read)
+	}
+	if info.admin {
+		categories = append(categories, acl.Admin)
+	}
+
+	return categories
+}
+
+// commandKeys returns key arguments of the command
+func commandKeys(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+
+	info, ok := commandTable[args[0]]
+	if !ok || info.firstKey == 0 {
+		return nil
+	}
+
+	last := info.lastKey
+	if last < 0 {
+		last += len(args)
+	}
+
+	keys := make([]string, 0)
+	for i := info.firstKey; i <= last && i < len(args); i += info.keyStep {
+		keys = append(keys, args[i])
+	}
+
+	return keys
+}
@@ -0,0 +1,219 @@
+package global_cache
+
+import (
+	"redis_like_in_memory_db/internal/bucket"
+	"redis_like_in_memory_db/internal/dict_bucket"
+	"redis_like_in_memory_db/internal/json_bucket"
+	"redis_like_in_memory_db/internal/list_bucket"
+	"sort"
+	"sync"
+)
+
+// database is a numbered keyspace with its own shards of every family
+type database struct {
+	hashFunc
+	buckets     []*bucket.Bucket
+	listBuckets []*list_bucket.ListBucket
+	dictBuckets []*dict_bucket.DictBucket
+	jsonBuckets []*json_bucket.JSONBucket
+	// guard writes to keys of a shard across all families
+	shardLocks []sync.Mutex
+	scans      *scanSnapshots
+}
+
+func newDatabase(numBuckets int) *database {
+	db := new(database)
+	db.hashFunc = bucketHashFunc(numBuckets)
+	db.buckets = make([]*bucket.Bucket, numBuckets, numBuckets)
+	db.listBuckets = make([]*list_bucket.ListBucket, numBuckets, numBuckets)
+	db.dictBuckets = make([]*dict_bucket.DictBucket, numBuckets, numBuckets)
+	db.jsonBuckets = make([]*json_bucket.JSONBucket, numBuckets, numBuckets)
+	db.shardLocks = make([]sync.Mutex, numBuckets)
+	db.scans = newScanSnapshots()
+
+	for i := 0; i < numBuckets; i++ {
+		db.buckets[i] = bucket.NewBucket()
+		db.dictBuckets[i] = dict_bucket.NewBucket()
+		db.listBuckets[i] = list_bucket.NewBucket()
+		db.jsonBuckets[i] = json_bucket.NewBucket()
+	}
+
+	return db
+}
+
+// pickBucket returns the shard of the key in the family of the command
+func (db *database) pickBucket(command, key string) iBucket {
+	bucketIndex := db.hashFunc(key)
+	switch commandTable[command].family {
+	// ZGET ZSET ZLEN ZREM ZKEYS
+	case "list":
+		return db.listBuckets[bucketIndex]
+	// DGET DSET DLEN DREM DKEYS
+	case "dict":
+		return db.dictBuckets[bucketIndex]
+	// GET SET LEN REM
+	default:
+		return db.buckets[bucketIndex]
+	}
+}
+
+func (db *database) totalBucketsLen() int {
+	wg := &sync.WaitGroup{}
+	ch := make(chan int)
+
+	go func() {
+		for key := range db.buckets {
+			wg.Add(1)
+
+			go func(buck *bucket.Bucket) {
+				ch <- buck.Len()
+				wg.Done()
+			}(db.buckets[key])
+		}
+
+		wg.Wait()
+		close(ch)
+	}()
+
+	count := 0
+	for length := range ch {
+		count += length
+	}
+
+	return count
+}
+
+// size returns the number of live keys of every family
+func (db *database) size() int {
+	count := 0
+	for shard := range db.buckets {
+		db.rangeShard(shard, func(_, _ string) {
+			count++
+		})
+	}
+
+	return count
+}
+
+// keyType returns the family holding a live key or an empty string
+func (db *database) keyType(key string) string {
+	shard := db.hashFunc(key)
+	switch {
+	case db.buckets[shard].Exists(key):
+		return "string"
+	case db.listBuckets[shard].Exists(key):
+		return "list"
+	case db.dictBuckets[shard].Exists(key):
+		return "dict"
+	case db.jsonBuckets[shard].Exists(key):
+		return "json"
+	}
+
+	return ""
+}
+
+// deleteKey removes key from every family and reports whether it existed
+func (db *database) deleteKey(key string) bool {
+	shard := db.hashFunc(key)
+
+	deleted := db.buckets[shard].Delete(key)
+	deleted = db.listBuckets[shard].Delete(key) || deleted
+	deleted = db.dictBuckets[shard].Delete(key) || deleted
+	deleted = db.jsonBuckets[shard].Delete(key) || deleted
+
+	return deleted
+}
+
+func (db *database) dumpKey(key string) (dumpedKey, bool) {
+	shard := db.hashFunc(key)
+
+	if entry, ok := db.buckets[shard].Dump(key); ok {
+		return dumpedKey{family: "string", value: entry}, true
+	}
+	if entries, ok := db.listBuckets[shard].Dump(key); ok {
+		return dumpedKey{family: "list", value: entries}, true
+	}
+	if entries, ok := db.dictBuckets[shard].Dump(key); ok {
+		return dumpedKey{family: "dict", value: entries}, true
+	}
+	if entry, ok := db.jsonBuckets[shard].Dump(key); ok {
+		return dumpedKey{family: "json", value: entry}, true
+	}
+
+	return dumpedKey{}, false
+}
+
+func (db *database) restoreKey(key string, dumped dumpedKey) error {
+	shard := db.hashFunc(key)
+
+	switch dumped.family {
+	case "string":
+		db.buckets[shard].Restore(key, dumped.value.(bucket.Entry))
+	case "list":
+		db.listBuckets[shard].Restore(key, dumped.value.([]list_bucket.Entry))
+	case "dict":
+		db.dictBuckets[shard].Restore(key, dumped.value.(map[string]dict_bucket.Entry))
+	case "json":
+		return db.jsonBuckets[shard].Restore(key, dumped.value.(json_bucket.Entry))
+	}
+
+	return nil
+}
+
+// lockKeys locks shards of the keys in index order and returns the unlock function.
+// Writes hold the lock so that a key can not be created in two families at once
+func (db *database) lockKeys(keys ...string) func() {
+	shards := make([]int, 0, len(keys))
+	seen := make(map[int]bool)
+	for _, key := range keys {
+		shard := int(db.hashFunc(key))
+		if seen[shard] {
+			continue
+		}
+		seen[shard] = true
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+
+	for _, shard := range shards {
+		db.shardLocks[shard].Lock()
+	}
+
+	return func() {
+		for i := len(shards) - 1; i >= 0; i-- {
+			db.shardLocks[shards[i]].Unlock()
+		}
+	}
+}
+
+// randomKeys returns up to n random keys of any family stored in the shard
+func (db *database) randomKeys(shard, n int) []string {
+	keys := db.buckets[shard].RandomKeys(n)
+	if len(keys) < n {
+		keys = append(keys, db.listBuckets[shard].RandomKeys(n-len(keys))...)
+	}
+	if len(keys) < n {
+		keys = append(keys, db.dictBuckets[shard].RandomKeys(n-len(keys))...)
+	}
+	if len(keys) < n {
+		keys = append(keys, db.jsonBuckets[shard].RandomKeys(n-len(keys))...)
+	}
+
+	return keys
+}
+
+// rangeShard calls fn for every key of every family stored in the shard
+func (db *database) rangeShard(shard int, fn func(key, typeName string)) {
+	db.buckets[shard].Range(func(key string) {
+		fn(key, "string")
+	})
+	db.listBuckets[shard].Range(func(key string) {
+		fn(key, "list")
+	})
+	db.dictBuckets[shard].Range(func(key string) {
+		fn(key, "dict")
+	})
+	db.jsonBuckets[shard].Range(func(key string) {
+		fn(key, "json")
+	})
+}
@@ -0,0 +1,150 @@
+package global_cache
+
+import (
+	"errors"
+	"redis_like_in_memory_db/internal/reply"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+var (
+	invalidDBIndex = reply.ErrInvalidDBIndex
+	dbOutOfRange   = reply.ErrDBOutOfRange
+	sameDatabases  = errors.New("source and destination databases are the same")
+)
+
+func (cache *GlobalCache) parseDBIndex(arg string) (int, error) {
+	index, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, invalidDBIndex
+	}
+	// the number of databases never changes, no lock is needed
+	if index < 0 || index >= len(cache.databases) {
+		return 0, dbOutOfRange
+	}
+
+	return index, nil
+}
+
+// SELECT index switches the database of the session
+func (cache *GlobalCache) selectCommand(session *Session, args []string) reply.Reply {
+	if len(args) != 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	index, err := cache.parseDBIndex(args[1])
+	if err != nil {
+		return reply.Err(err)
+	}
+	session.DB = index
+
+	return reply.OK
+}
+
+// processDatabaseCommand handles commands replacing whole databases, they
+// hold the cache lock exclusively so no other command sees a half done change
+func (cache *GlobalCache) processDatabaseCommand(index int, args []string) reply.Reply {
+	switch args[0] {
+	// SWAPDB index index
+	case "SWAPDB":
+		if len(args) != 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		first, err := cache.parseDBIndex(args[1])
+		if err != nil {
+			return reply.Err(err)
+		}
+		second, err := cache.parseDBIndex(args[2])
+		if err != nil {
+			return reply.Err(err)
+		}
+
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+
+		cache.databases[first], cache.databases[second] = cache.databases[second], cache.databases[first]
+		cache.writeToLog(index, args)
+		return reply.OK
+
+	// FLUSHDB [ASYNC|SYNC]
+	// FLUSHALL [ASYNC|SYNC]
+	case "FLUSHDB", "FLUSHALL":
+		if len(args) > 2 {
+			return reply.Err(wrongArgsNumber)
+		}
+		sync := true
+		if len(args) == 2 {
+			switch args[1] {
+			case "SYNC":
+			case "ASYNC":
+				sync = false
+			default:
+				return reply.Err(syntaxError)
+			}
+		}
+
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		defer cache.recordLatency(flushEvent, time.Now())
+
+		if args[0] == "FLUSHDB" {
+			cache.databases[index] = newDatabase(cache.numBuckets)
+		} else {
+			for i := range cache.databases {
+				cache.databases[i] = newDatabase(cache.numBuckets)
+			}
+		}
+		cache.writeToLog(index, args)
+
+		// old shards are unreachable now, ASYNC leaves them to the garbage
+		// collector while SYNC frees them before replying
+		if sync {
+			runtime.GC()
+		}
+		return reply.OK
+	}
+
+	return reply.Err(commandNotFound)
+}
+
+// MOVE key index moves a key of any family to another database, nothing
+// happens when the key is missing or the destination already holds it
+func (cache *GlobalCache) moveCommand(index int, args []string) reply.Reply {
+	if len(args) != 3 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	target, err := cache.parseDBIndex(args[2])
+	if err != nil {
+		return reply.Err(err)
+	}
+	if target == index {
+		return reply.Err(sameDatabases)
+	}
+
+	key := args[1]
+	source, destination := cache.databases[index], cache.databases[target]
+
+	// shards of both databases are locked in database order
+	if index < target {
+		defer source.lockKeys(key)()
+		defer destination.lockKeys(key)()
+	} else {
+		defer destination.lockKeys(key)()
+		defer source.lockKeys(key)()
+	}
+
+	dumped, ok := source.dumpKey(key)
+	if !ok || destination.keyType(key) != "" {
+		return reply.Integer(0)
+	}
+	if err := destination.restoreKey(key, dumped); err != nil {
+		return reply.Err(err)
+	}
+	source.deleteKey(key)
+
+	cache.writeToLog(index, args)
+	return reply.Integer(1)
+}
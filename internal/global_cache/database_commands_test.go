@@ -0,0 +1,88 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGlobalCache_Select(t *testing.T) {
+	cache := NewCacheWithDatabases(8, 4, false)
+	session := &Session{}
+
+	{
+		t.Log("Given a selected database it should keep keys apart from other ones")
+		cache.ProcessSessionCommand(session, []string{"SET", "key", "zero", "1h"})
+		assert.EqualValues(t, "Success\n", cache.ProcessSessionCommand(session, []string{"SELECT", "2"}))
+		assert.EqualValues(t, 2, session.DB)
+		assert.EqualValues(t, "(nil)\n", cache.ProcessSessionCommand(session, []string{"GET", "key"}))
+
+		cache.ProcessSessionCommand(session, []string{"ZSET", "key", "two", "1h"})
+		assert.EqualValues(t, "1\n", cache.ProcessSessionCommand(session, []string{"DBSIZE"}))
+		assert.EqualValues(t, "zero\n", cache.ProcessCommand([]string{"GET", "key"}))
+	}
+
+	{
+		t.Log("Given a wrong index it should keep the selected database")
+		assert.EqualValues(t, errorReply(dbOutOfRange), cache.ProcessSessionCommand(session, []string{"SELECT", "4"}))
+		assert.EqualValues(t, errorReply(invalidDBIndex), cache.ProcessSessionCommand(session, []string{"SELECT", "one"}))
+		assert.EqualValues(t, 2, session.DB)
+	}
+
+	{
+		t.Log("Scripts should work with the database of the caller")
+		reply := cache.ProcessSessionCommand(session, []string{"EVAL", "return redis.call('ZGET', KEYS[1], '0')", "1", "key"})
+		assert.EqualValues(t, "two\n", reply)
+	}
+}
+
+func TestGlobalCache_Move(t *testing.T) {
+	cache := NewCacheWithDatabases(8, 4, false)
+	session := &Session{DB: 1}
+	cache.ProcessCommand([]string{"DSET", "user", "name", "elk", "1h"})
+	cache.ProcessCommand([]string{"SET", "taken", "zero", "1h"})
+	cache.ProcessSessionCommand(session, []string{"SET", "taken", "one", "1h"})
+
+	{
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"MOVE", "user", "1"}))
+		assert.EqualValues(t, "none\n", cache.ProcessCommand([]string{"TYPE", "user"}))
+		assert.EqualValues(t, "elk\n", cache.ProcessSessionCommand(session, []string{"DGET", "user", "name"}))
+	}
+
+	{
+		t.Log("Given an existing destination or a missing key it should do nothing")
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"MOVE", "taken", "1"}))
+		assert.EqualValues(t, "zero\n", cache.ProcessCommand([]string{"GET", "taken"}))
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"MOVE", "missing", "1"}))
+		assert.EqualValues(t, errorReply(sameDatabases), cache.ProcessCommand([]string{"MOVE", "taken", "0"}))
+	}
+}
+
+func TestGlobalCache_SwapFlush(t *testing.T) {
+	cache := NewCacheWithDatabases(8, 4, false)
+	session := &Session{DB: 1}
+	cache.ProcessCommand([]string{"SET", "key", "zero", "1h"})
+	cache.ProcessSessionCommand(session, []string{"SET", "key", "one", "1h"})
+
+	{
+		t.Log("SWAPDB should be visible to every session")
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"SWAPDB", "0", "1"}))
+		assert.EqualValues(t, "one\n", cache.ProcessCommand([]string{"GET", "key"}))
+		assert.EqualValues(t, "zero\n", cache.ProcessSessionCommand(session, []string{"GET", "key"}))
+	}
+
+	{
+		assert.EqualValues(t, "Success\n", cache.ProcessSessionCommand(session, []string{"FLUSHDB", "ASYNC"}))
+		assert.EqualValues(t, "0\n", cache.ProcessSessionCommand(session, []string{"DBSIZE"}))
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"DBSIZE"}))
+
+		assert.EqualValues(t, errorReply(syntaxError), cache.ProcessCommand([]string{"FLUSHALL", "LATER"}))
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"FLUSHALL"}))
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"DBSIZE"}))
+	}
+
+	{
+		t.Log("Database wide commands should be refused from scripts")
+		reply := cache.ProcessCommand([]string{"EVAL", "return redis.pcall('FLUSHALL')", "0"})
+		assert.EqualValues(t, errorReply(notAllowedCommand), reply)
+	}
+}
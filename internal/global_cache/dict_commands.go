@@ -0,0 +1,48 @@
+package global_cache
+
+import "redis_like_in_memory_db/internal/reply"
+
+// processDictCommand handles commands which work with several fields of a
+// dictionary at once
+func (cache *GlobalCache) processDictCommand(index int, command, key string, args []string) reply.Reply {
+	db := cache.databases[index]
+	bucket := db.dictBuckets[db.hashFunc(key)]
+
+	switch command {
+	// HMGET key field [field ...]
+	case "HMGET":
+		values, found := bucket.GetMany(args[1:]...)
+		if values == nil {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		items := make([]reply.Reply, 0, len(values))
+		for i, value := range values {
+			cache.stats.lookup(found[i])
+			if !found[i] {
+				items = append(items, reply.Nil)
+				continue
+			}
+			items = append(items, reply.Value(value))
+		}
+		return reply.Array(items)
+
+	// HMSET key field value [field value ...] ttl
+	case "HMSET":
+		if err := bucket.SetMany(args[1:]...); err != nil {
+			return reply.Err(err)
+		}
+		cache.writeToLog(index, args)
+		return reply.OK
+
+	// HGETALL key
+	case "HGETALL":
+		pairs := bucket.GetAll(args[1:]...)
+		if pairs == nil {
+			return reply.Err(wrongArgsNumber)
+		}
+		return reply.Values(pairs)
+	}
+
+	return reply.Err(commandNotFound)
+}
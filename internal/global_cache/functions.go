@@ -0,0 +1,466 @@
+package global_cache
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"redis_like_in_memory_db/internal/acl"
+	"redis_like_in_memory_db/internal/reply"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	libraryExists     = errors.New("library already exists, use REPLACE to overwrite it")
+	libraryNotExists  = errors.New("library not found")
+	functionNotExists = errors.New("function not found")
+	noFunctions       = errors.New("no functions registered")
+	writeFunction     = errors.New("can not execute a function with write flag using FCALL_RO")
+	callDuringLoad    = errors.New("redis.call is not allowed while loading a library")
+	invalidDump       = errors.New("payload is not a valid function dump")
+	invalidHeader     = errors.New("library code has to start with a header like '#!lua name=mylib [version=1]'")
+	invalidName       = errors.New("names can only contain letters, digits and underscores")
+	invalidPolicy     = errors.New("restore policy should be one of APPEND, REPLACE or FLUSH")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// functionRegistry holds named libraries of server-side functions. Unlike the
+// script cache it is a part of the dataset and is written to the tx_log
+type functionRegistry struct {
+	mu        sync.Mutex
+	libraries map[string]*functionLibrary
+	// function name to the library which registered it
+	functions map[string]*functionLibrary
+}
+
+type functionLibrary struct {
+	name      string
+	version   string
+	code      string
+	proto     *lua.FunctionProto
+	functions map[string]*libraryFunction
+}
+
+type libraryFunction struct {
+	name     string
+	readOnly bool
+}
+
+// registeredFunction is produced by redis.register_function when library code runs
+type registeredFunction struct {
+	libraryFunction
+	callback *lua.LFunction
+}
+
+func newFunctionRegistry() *functionRegistry {
+	registry := new(functionRegistry)
+	registry.libraries = make(map[string]*functionLibrary)
+	registry.functions = make(map[string]*functionLibrary)
+
+	return registry
+}
+
+// compileLibrary parses the header, compiles the code and runs it once to
+// learn which functions the library registers
+func compileLibrary(code string) (*functionLibrary, error) {
+	library := new(functionLibrary)
+	library.code = code
+	library.version = "1"
+
+	header := code
+	if end := strings.IndexByte(code, '\n'); end != -1 {
+		header = code[:end]
+	}
+	fields := strings.Fields(header)
+	if len(fields) == 0 || fields[0] != "#!lua" {
+		return nil, invalidHeader
+	}
+	for _, field := range fields[1:] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, invalidHeader
+		}
+
+		switch parts[0] {
+		case "name":
+			library.name = parts[1]
+		case "version":
+			library.version = parts[1]
+		default:
+			return nil, fmt.Errorf("unknown library metadata %q", parts[0])
+		}
+	}
+	if !validName.MatchString(library.name) {
+		return nil, invalidName
+	}
+
+	// the header is turned into a comment to keep line numbers in errors
+	proto, err := compileScript("--"+code, "@"+library.name)
+	if err != nil {
+		return nil, err
+	}
+	library.proto = proto
+
+	state := newLuaState()
+	defer state.Close()
+
+	registered := make(map[string]*registeredFunction)
+	redis := state.NewTable()
+	state.SetField(redis, "register_function", state.NewFunction(registerFunction(registered)))
+	state.SetField(redis, "call", state.NewFunction(func(state *lua.LState) int {
+		state.RaiseError("%s", callDuringLoad.Error())
+		return 0
+	}))
+	state.SetField(redis, "pcall", redis.RawGetString("call"))
+	state.SetGlobal("redis", redis)
+
+	state.Push(state.NewFunctionFromProto(proto))
+	if err := state.PCall(0, 0, nil); err != nil {
+		return nil, fmt.Errorf("error loading library: %s", err)
+	}
+	if len(registered) == 0 {
+		return nil, noFunctions
+	}
+
+	library.functions = make(map[string]*libraryFunction)
+	for name, function := range registered {
+		function := function.libraryFunction
+		library.functions[name] = &function
+	}
+
+	return library, nil
+}
+
+// registerFunction implements both forms of redis.register_function:
+// register_function(name, callback) and
+// register_function{function_name = name, callback = callback, flags = {"no-writes"}}
+func registerFunction(registered map[string]*registeredFunction) lua.LGFunction {
+	return func(state *lua.LState) int {
+		function := new(registeredFunction)
+
+		if table, ok := state.Get(1).(*lua.LTable); ok {
+			function.name = lua.LVAsString(table.RawGetString("function_name"))
+			function.callback, _ = table.RawGetString("callback").(*lua.LFunction)
+			if flags, ok := table.RawGetString("flags").(*lua.LTable); ok {
+				flags.ForEach(func(_, flag lua.LValue) {
+					if lua.LVAsString(flag) == "no-writes" {
+						function.readOnly = true
+					}
+				})
+			}
+		} else {
+			function.name = state.CheckString(1)
+			function.callback = state.CheckFunction(2)
+		}
+
+		if !validName.MatchString(function.name) {
+			state.RaiseError("%s", invalidName.Error())
+		}
+		if function.callback == nil {
+			state.RaiseError("function %s has no callback", function.name)
+		}
+		if _, ok := registered[function.name]; ok {
+			state.RaiseError("function %s is already registered", function.name)
+		}
+
+		registered[function.name] = function
+		return 0
+	}
+}
+
+func (registry *functionRegistry) add(library *functionLibrary, replace bool) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	return registry.addWithoutLock(library, replace)
+}
+
+func (registry *functionRegistry) addWithoutLock(library *functionLibrary, replace bool) error {
+	if _, ok := registry.libraries[library.name]; ok && !replace {
+		return libraryExists
+	}
+	for name := range library.functions {
+		if owner, ok := registry.functions[name]; ok && owner.name != library.name {
+			return fmt.Errorf("function %s already exists in library %s", name, owner.name)
+		}
+	}
+
+	registry.removeWithoutLock(library.name)
+	registry.libraries[library.name] = library
+	for name := range library.functions {
+		registry.functions[name] = library
+	}
+
+	return nil
+}
+
+func (registry *functionRegistry) remove(name string) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, ok := registry.libraries[name]; !ok {
+		return libraryNotExists
+	}
+
+	registry.removeWithoutLock(name)
+	return nil
+}
+
+func (registry *functionRegistry) removeWithoutLock(name string) {
+	library, ok := registry.libraries[name]
+	if !ok {
+		return
+	}
+
+	for function := range library.functions {
+		delete(registry.functions, function)
+	}
+	delete(registry.libraries, name)
+}
+
+func (registry *functionRegistry) flush() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.libraries = make(map[string]*functionLibrary)
+	registry.functions = make(map[string]*functionLibrary)
+}
+
+func (registry *functionRegistry) lookup(function string) (*functionLibrary, bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	library, ok := registry.functions[function]
+	return library, ok
+}
+
+// sortedLibraries returns libraries ordered by name
+func (registry *functionRegistry) sortedLibraries() []*functionLibrary {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	libraries := make([]*functionLibrary, 0, len(registry.libraries))
+	for _, library := range registry.libraries {
+		libraries = append(libraries, library)
+	}
+	sort.Slice(libraries, func(i, j int) bool {
+		return libraries[i].name < libraries[j].name
+	})
+
+	return libraries
+}
+
+// dump serializes code of every library, restore accepts the result
+func (registry *functionRegistry) dump() string {
+	codes := make([]string, 0)
+	for _, library := range registry.sortedLibraries() {
+		codes = append(codes, library.code)
+	}
+
+	payload, _ := json.Marshal(codes)
+	return base64.StdEncoding.EncodeToString(payload)
+}
+
+// restore loads libraries from payload, policy is one of APPEND, REPLACE or FLUSH
+func (registry *functionRegistry) restore(payload, policy string) error {
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return invalidDump
+	}
+
+	codes := make([]string, 0)
+	if err := json.Unmarshal(raw, &codes); err != nil {
+		return invalidDump
+	}
+
+	libraries := make([]*functionLibrary, 0, len(codes))
+	for _, code := range codes {
+		library, err := compileLibrary(code)
+		if err != nil {
+			return err
+		}
+		libraries = append(libraries, library)
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	// validate against a copy so that a failed restore changes nothing
+	staged := &functionRegistry{
+		libraries: make(map[string]*functionLibrary),
+		functions: make(map[string]*functionLibrary),
+	}
+	if policy != "FLUSH" {
+		for name, library := range registry.libraries {
+			staged.libraries[name] = library
+		}
+		for name, library := range registry.functions {
+			staged.functions[name] = library
+		}
+	}
+	for _, library := range libraries {
+		if err := staged.addWithoutLock(library, policy == "REPLACE"); err != nil {
+			return err
+		}
+	}
+
+	registry.libraries = staged.libraries
+	registry.functions = staged.functions
+	return nil
+}
+
+// FUNCTION LOAD [REPLACE] code | DELETE name | LIST | DUMP | RESTORE payload [policy] | FLUSH
+func (cache *GlobalCache) functionCommand(index int, args []string) reply.Reply {
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	switch args[1] {
+	case "LOAD":
+		replace := len(args) == 4 && args[2] == "REPLACE"
+		if len(args) != 3 && !replace {
+			return reply.Err(wrongArgsNumber)
+		}
+		// libraries survive restarts only in the snapshot, the log is not replayed
+		if cache.SnapshotFile() == "" {
+			return reply.Err(noSnapshotFile)
+		}
+
+		library, err := compileLibrary(args[len(args)-1])
+		if err != nil {
+			return reply.Err(err)
+		}
+		if err := cache.functions.add(library, replace); err != nil {
+			return reply.Err(err)
+		}
+		cache.writeToLog(index, args)
+		return reply.Value(library.name)
+
+	case "DELETE":
+		if len(args) != 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		if err := cache.functions.remove(args[2]); err != nil {
+			return reply.Err(err)
+		}
+		cache.writeToLog(index, args)
+
+	case "FLUSH":
+		cache.functions.flush()
+		cache.writeToLog(index, args)
+
+	case "LIST":
+		libraries := make([]string, 0)
+		for _, library := range cache.functions.sortedLibraries() {
+			names := make([]string, 0, len(library.functions))
+			for name, function := range library.functions {
+				if function.readOnly {
+					name += " (no-writes)"
+				}
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			libraries = append(libraries, fmt.Sprintf("%s v%s: %s", library.name, library.version, strings.Join(names, ", ")))
+		}
+		return reply.Values(libraries)
+
+	case "DUMP":
+		return reply.Value(cache.functions.dump())
+
+	case "RESTORE":
+		policy := "APPEND"
+		switch len(args) {
+		case 3:
+		case 4:
+			policy = args[3]
+		default:
+			return reply.Err(wrongArgsNumber)
+		}
+		if policy != "APPEND" && policy != "REPLACE" && policy != "FLUSH" {
+			return reply.Err(invalidPolicy)
+		}
+		if cache.SnapshotFile() == "" {
+			return reply.Err(noSnapshotFile)
+		}
+
+		if err := cache.functions.restore(args[2], policy); err != nil {
+			return reply.Err(err)
+		}
+		cache.writeToLog(index, args)
+
+	default:
+		return reply.Err(commandNotFound)
+	}
+
+	return reply.OK
+}
+
+// FCALL function numkeys [key ...] [arg ...]
+// FCALL_RO function numkeys [key ...] [arg ...]
+func (cache *GlobalCache) fcallCommand(index int, user *acl.User, args []string) reply.Reply {
+	if len(args) < 3 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	name := args[1]
+	library, ok := cache.functions.lookup(name)
+	if !ok {
+		return reply.Err(functionNotExists)
+	}
+
+	function := library.functions[name]
+	if args[0] == "FCALL_RO" && !function.readOnly {
+		return reply.Err(writeFunction)
+	}
+
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || numKeys < 0 {
+		return reply.Err(invalidNumKeys)
+	}
+	if numKeys > len(args)-3 {
+		return reply.Err(wrongNumKeys)
+	}
+
+	keys := args[3 : 3+numKeys]
+	argv := args[3+numKeys:]
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	script := newRunningScript(index, user, keys)
+	script.readOnly = function.readOnly
+
+	return cache.runLua(script, func(state *lua.LState) (lua.LValue, error) {
+		// library code is executed again to bind callbacks to this interpreter
+		registered := make(map[string]*registeredFunction)
+		state.SetField(state.GetGlobal("redis"), "register_function", state.NewFunction(registerFunction(registered)))
+
+		state.Push(state.NewFunctionFromProto(library.proto))
+		if err := state.PCall(0, 0, nil); err != nil {
+			return nil, err
+		}
+
+		callback, ok := registered[name]
+		if !ok {
+			return nil, functionNotExists
+		}
+
+		state.Push(callback.callback)
+		state.Push(stringsToTable(state, keys))
+		state.Push(stringsToTable(state, argv))
+		if err := state.PCall(2, 1, nil); err != nil {
+			return nil, err
+		}
+
+		result := state.Get(-1)
+		state.Pop(1)
+		return result, nil
+	})
+}
@@ -0,0 +1,129 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const counterLibrary = `#!lua name=counter version=2
+local function incr(keys, args)
+	local current = tonumber(redis.call("GET", keys[1])) or 0
+	current = current + tonumber(args[1])
+	redis.call("SET", keys[1], tostring(current), "1h")
+	return current
+end
+
+redis.register_function("incr", incr)
+redis.register_function{
+	function_name = "peek",
+	callback = function(keys) return redis.call("GET", keys[1]) end,
+	flags = {"no-writes"},
+}
+redis.register_function{
+	function_name = "sneaky",
+	callback = function(keys) return redis.call("SET", keys[1], "x", "1h") end,
+	flags = {"no-writes"},
+}`
+
+// newFunctionsCache returns a cache with a snapshot file, libraries are not
+// loaded without one. The file is not written unless the test saves
+func newFunctionsCache() *GlobalCache {
+	cache := NewCache(32, false)
+	cache.SetSnapshotFile(filepath.Join(os.TempDir(), "functions.snapshot"))
+	return cache
+}
+
+func TestGlobalCache_Function(t *testing.T) {
+	{
+		t.Log("Given no snapshot file libraries should not be loaded")
+		cache := NewCache(32, false)
+		reply := cache.ProcessCommand([]string{"FUNCTION", "LOAD", counterLibrary})
+		assert.EqualValues(t, errorReply(noSnapshotFile), reply)
+		reply = cache.ProcessCommand([]string{"FUNCTION", "RESTORE", "payload"})
+		assert.EqualValues(t, errorReply(noSnapshotFile), reply)
+	}
+
+	cache := newFunctionsCache()
+
+	{
+		t.Log("Given a library it should be loaded once unless REPLACE is passed")
+		reply := cache.ProcessCommand([]string{"FUNCTION", "LOAD", counterLibrary})
+		assert.EqualValues(t, "counter\n", reply)
+		reply = cache.ProcessCommand([]string{"FUNCTION", "LOAD", counterLibrary})
+		assert.EqualValues(t, errorReply(libraryExists), reply)
+		reply = cache.ProcessCommand([]string{"FUNCTION", "LOAD", "REPLACE", counterLibrary})
+		assert.EqualValues(t, "counter\n", reply)
+	}
+
+	{
+		t.Log("It should list libraries with versions and flags")
+		libraries := cache.Execute(&Session{}, []string{"FUNCTION", "LIST"}).Strings()
+		assert.Equal(t, []string{"counter v2: incr, peek (no-writes), sneaky (no-writes)"}, libraries)
+	}
+
+	{
+		t.Log("It should call functions")
+		reply := cache.ProcessCommand([]string{"FCALL", "incr", "1", "hits", "5"})
+		assert.EqualValues(t, "5\n", reply)
+		reply = cache.ProcessCommand([]string{"FCALL", "incr", "1", "hits", "2"})
+		assert.EqualValues(t, "7\n", reply)
+		reply = cache.ProcessCommand([]string{"FCALL_RO", "peek", "1", "hits"})
+		assert.EqualValues(t, "7\n", reply)
+	}
+
+	{
+		t.Log("Read only calls should reject write functions and writes")
+		reply := cache.ProcessCommand([]string{"FCALL_RO", "incr", "1", "hits", "1"})
+		assert.EqualValues(t, errorReply(writeFunction), reply)
+		reply = cache.ProcessCommand([]string{"FCALL_RO", "sneaky", "1", "hits"})
+		assert.Contains(t, reply, readOnlyScript.Error())
+	}
+
+	{
+		t.Log("It should reject libraries without header or calling commands on load")
+		reply := cache.ProcessCommand([]string{"FUNCTION", "LOAD", `redis.register_function("f", function() end)`})
+		assert.EqualValues(t, errorReply(invalidHeader), reply)
+		reply = cache.ProcessCommand([]string{"FUNCTION", "LOAD", "#!lua name=bad\nredis.call('GET', 'a')"})
+		assert.Contains(t, reply, callDuringLoad.Error())
+		reply = cache.ProcessCommand([]string{"FUNCTION", "LOAD", "#!lua name=empty\nlocal a = 1"})
+		assert.EqualValues(t, errorReply(noFunctions), reply)
+	}
+
+	{
+		t.Log("It should delete libraries")
+		reply := cache.ProcessCommand([]string{"FUNCTION", "DELETE", "counter"})
+		assert.EqualValues(t, "Success\n", reply)
+		reply = cache.ProcessCommand([]string{"FCALL", "incr", "1", "hits", "1"})
+		assert.EqualValues(t, errorReply(functionNotExists), reply)
+	}
+}
+
+func TestGlobalCache_FunctionDumpRestore(t *testing.T) {
+	source := newFunctionsCache()
+	source.ProcessCommand([]string{"FUNCTION", "LOAD", counterLibrary})
+	payload := strings.TrimSpace(source.ProcessCommand([]string{"FUNCTION", "DUMP"}))
+
+	target := newFunctionsCache()
+	{
+		reply := target.ProcessCommand([]string{"FUNCTION", "RESTORE", payload})
+		assert.EqualValues(t, "Success\n", reply)
+		reply = target.ProcessCommand([]string{"FCALL", "incr", "1", "hits", "3"})
+		assert.EqualValues(t, "3\n", reply)
+	}
+
+	{
+		t.Log("Given existing libraries APPEND should fail without changes and REPLACE should succeed")
+		reply := target.ProcessCommand([]string{"FUNCTION", "RESTORE", payload})
+		assert.EqualValues(t, errorReply(libraryExists), reply)
+		reply = target.ProcessCommand([]string{"FUNCTION", "RESTORE", payload, "REPLACE"})
+		assert.EqualValues(t, "Success\n", reply)
+	}
+
+	{
+		reply := target.ProcessCommand([]string{"FUNCTION", "RESTORE", "garbage"})
+		assert.EqualValues(t, errorReply(invalidDump), reply)
+	}
+}
@@ -3,192 +3,353 @@ package global_cache
 import (
 	"encoding/csv"
 	"fmt"
-	"redis_like_in_memory_db/internal/bucket"
-	"redis_like_in_memory_db/internal/dict_bucket"
-	"redis_like_in_memory_db/internal/list_bucket"
+	"redis_like_in_memory_db/internal/acl"
+	"redis_like_in_memory_db/internal/latency"
+	"redis_like_in_memory_db/internal/metrics"
+	"redis_like_in_memory_db/internal/reply"
 	"redis_like_in_memory_db/internal/tx_logger"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	wrongArgsNumber = reply.ErrWrongArgsNumber
+	commandNotFound = reply.ErrUnknownCommand
+	shuttingDown    = reply.ErrShuttingDown
+)
+
+const DefaultDatabases = 16
+
 type hashFunc func(string) uint
 
 type GlobalCache struct {
-	hashFunc
-	buckets           []*bucket.Bucket
-	listBuckets       []*list_bucket.ListBucket
-	dictBuckets       []*dict_bucket.DictBucket
+	numBuckets        int
+	databases         []*database
 	transactionLogger *tx_logger.TXLogger
+	scripts           *scriptEngine
+	functions         *functionRegistry
+	users             *acl.ACL
+	snapshotMu        sync.Mutex
+	snapshotFile      string
+	lastSave          time.Time
+	started           time.Time
+	stats             stats
+	infoMu            sync.Mutex
+	// serializes SaveSnapshot, so saves replace the file in order
+	saveMu sync.Mutex
+	// INFO sections added by the network server
+	infoProviders map[string]func() []string
+	// latency by command name, the map is never modified after creation
+	commandLatency map[string]*metrics.Histogram
+	slowlog        *slowlog
+	latency        *latency.Monitor
+	monitors       *monitors
+	memory         memoryLimit
+	// set once Close is called, commands are refused afterwards
+	closed int32
+	// closed by Close to stop sampling ops/sec
+	stopSampling chan struct{}
+	// scripts and database wide commands hold it exclusively, other commands share it
+	mu sync.RWMutex
+}
+
+// Session keeps the state of a single connection between commands
+type Session struct {
+	// index of the selected database
+	DB int
+	// ACL user of the connection, commands are not restricted when it is empty
+	User          string
+	authenticated bool
+	// address and name of the client shown by SLOWLOG and MONITOR
+	Addr string
+	Name string
+}
+
+func (session *Session) Authenticated() bool {
+	return session.User == "" || session.authenticated
 }
 
 type iBucket interface {
 	Get(...string) (string, bool)
 	Set(...string) error
-	Keys(...string) string
+	Keys(...string) []string
 	Len(...string) int
 	Remove(...string) error
 }
 
 func NewCache(numBuckets int, enableLogging bool) *GlobalCache {
-	cache := new(GlobalCache)
-	cache.hashFunc = bucketHashFunc(numBuckets)
-	cache.buckets = make([]*bucket.Bucket, numBuckets, numBuckets)
-	cache.listBuckets = make([]*list_bucket.ListBucket, numBuckets, numBuckets)
-	cache.dictBuckets = make([]*dict_bucket.DictBucket, numBuckets, numBuckets)
+	return NewCacheWithDatabases(numBuckets, DefaultDatabases, enableLogging)
+}
 
-	for i := 0; i < numBuckets; i++ {
-		cache.buckets[i] = bucket.NewBucket()
-		cache.dictBuckets[i] = dict_bucket.NewBucket()
-		cache.listBuckets[i] = list_bucket.NewBucket()
+func NewCacheWithDatabases(numBuckets, numDatabases int, enableLogging bool) *GlobalCache {
+	cache := new(GlobalCache)
+	cache.numBuckets = numBuckets
+	cache.databases = make([]*database, numDatabases, numDatabases)
+	for i := range cache.databases {
+		cache.databases[i] = newDatabase(numBuckets)
 	}
+	cache.scripts = newScriptEngine()
+	cache.functions = newFunctionRegistry()
+	cache.users = acl.NewACL()
+	cache.started = time.Now()
+	cache.stats.sampleTime = cache.started
+	cache.stopSampling = make(chan struct{})
+	go cache.stats.sampleOps(cache.stopSampling)
+	cache.infoProviders = make(map[string]func() []string)
+	cache.commandLatency = newCommandLatency()
+	cache.slowlog = newSlowlog(DefaultSlowlogThreshold, DefaultSlowlogMaxLen)
+	cache.latency = latency.NewMonitor(0)
+	cache.monitors = newMonitors()
 
 	if enableLogging {
-		cache.transactionLogger = tx_logger.NewTXLogger("tx_log")
-		go cache.transactionLogger.ProcessLogWrite()
+		cache.EnableTXLog(tx_logger.DefaultPath)
 	}
 	return cache
 }
 
+// EnableTXLog starts writing the transaction log to the file, it has to be
+// called before commands are executed
+func (cache *GlobalCache) EnableTXLog(path string) {
+	cache.transactionLogger = tx_logger.NewTXLogger(path)
+	cache.transactionLogger.Latency = cache.latency
+	go cache.transactionLogger.ProcessLogWrite()
+}
+
+// SetTXLogFsync sets the policy of syncing the transaction log to disk
+func (cache *GlobalCache) SetTXLogFsync(policy string) error {
+	if err := cache.CheckTXLogFsync(policy); err != nil {
+		return err
+	}
+	return cache.transactionLogger.SetFsync(policy)
+}
+
+// CheckTXLogFsync returns an error when SetTXLogFsync would refuse the policy
+func (cache *GlobalCache) CheckTXLogFsync(policy string) error {
+	if cache.transactionLogger == nil {
+		return reply.ErrTXLogDisabled
+	}
+	return tx_logger.CheckFsync(policy)
+}
+
+// ChangesSinceSave returns the number of writes after the last snapshot
+func (cache *GlobalCache) ChangesSinceSave() int64 {
+	return atomic.LoadInt64(&cache.stats.dirty)
+}
+
 func (cache *GlobalCache) PerformCommand(request []byte) string {
+	return cache.PerformSessionCommand(&Session{}, request)
+}
+
+func (cache *GlobalCache) PerformSessionCommand(session *Session, request []byte) string {
 	args := cache.parseMessage(string(request))
-	return cache.ProcessCommand(args)
+	return cache.ProcessSessionCommand(session, args)
 }
 
+// ProcessCommand executes args against the database 0
 func (cache *GlobalCache) ProcessCommand(args []string) string {
+	return cache.ProcessSessionCommand(&Session{}, args)
+}
+
+// ProcessSessionCommand executes args against the database selected by the
+// session and returns the reply encoded for the text protocol
+func (cache *GlobalCache) ProcessSessionCommand(session *Session, args []string) string {
+	return fmt.Sprintf("%s\n", cache.Execute(session, args))
+}
+
+// Execute executes args against the database selected by the session
+func (cache *GlobalCache) Execute(session *Session, args []string) reply.Reply {
 	if len(args) < 1 {
-		return "wrong arguments number\n"
+		return reply.Err(wrongArgsNumber)
 	}
 
+	if atomic.LoadInt32(&cache.closed) != 0 {
+		return reply.Err(shuttingDown)
+	}
+	atomic.AddInt64(&cache.stats.commands, 1)
+	defer cache.finishCommand(session, args, time.Now())
+	cache.feedMonitors(session.DB, session.Addr, args)
+	// commands are dispatched by exact names of the table only
+	if _, ok := commandTable[args[0]]; !ok {
+		return reply.Err(commandNotFound)
+	}
+	if args[0] == "AUTH" {
+		return cache.authCommand(session, args)
+	}
+	user, err := cache.authorize(session, args)
+	if err != nil {
+		return reply.Err(err)
+	}
+
+	switch args[0] {
+	case "EVAL", "EVALSHA":
+		return cache.evalCommand(session.DB, user, args)
+	// SCRIPT KILL has to get through while a script holds the lock
+	case "SCRIPT":
+		return cache.scriptCommand(args)
+	case "FCALL", "FCALL_RO":
+		return cache.fcallCommand(session.DB, user, args)
+	case "FUNCTION":
+		return cache.functionCommand(session.DB, args)
+	case "SELECT":
+		return cache.selectCommand(session, args)
+	case "ACL":
+		return cache.aclCommand(session, args)
+	case "SAVE":
+		if len(args) != 1 {
+			return reply.Err(wrongArgsNumber)
+		}
+		if err := cache.Save(); err != nil {
+			return reply.Err(err)
+		}
+		return reply.OK
+	case "SWAPDB", "FLUSHDB", "FLUSHALL":
+		return cache.processDatabaseCommand(session.DB, args)
+	case "INFO":
+		return cache.infoCommand(args)
+	case "SLOWLOG":
+		return cache.slowlogCommand(args)
+	case "LATENCY":
+		return cache.latencyCommand(args)
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	return cache.processCommand(session.DB, args)
+}
+
+// processCommand executes a single command against the database with the
+// given index without taking the cache lock
+func (cache *GlobalCache) processCommand(index int, args []string) reply.Reply {
+	db := cache.databases[index]
 	firstArg := ""
 	command := args[0]
 	if len(args) > 1 {
 		firstArg = args[1]
 	}
-	bucket := cache.pickBucket(command, firstArg)
 
-	var reply string
-	switch {
-	case strings.HasSuffix(command, "GET"):
-		if value, ok := bucket.Get(args[1:]...); ok {
-			reply = value
-		} else {
-			reply = "value does not exist for given arguments"
-		}
-
-	case strings.HasSuffix(command, "SET"):
-		if err := bucket.Set(args[1:]...); err != nil {
-			reply = err.Error()
-		} else {
-			cache.writeToLog(args)
-			reply = "Success"
-		}
+	if commandTable[command].denyOOM && cache.overMemoryLimit() && !cache.evict() {
+		return reply.Err(outOfMemory)
+	}
 
-	case strings.HasSuffix(command, "KEYS"):
-		if firstArg == "" {
-			reply = cache.totalBucketsKeys()
-		} else {
-			reply = bucket.Keys(args[1:]...)
+	switch command {
+	case "KEYS", "RANDOMKEY", "DEL", "UNLINK", "EXISTS", "TYPE", "RENAME", "RENAMENX", "COPY":
+		return cache.processKeyspaceCommand(index, args)
+	case "MGET", "MSET", "MSETNX":
+		return cache.processMultiKeyCommand(index, args)
+	case "MOVE":
+		return cache.moveCommand(index, args)
+	case "DBSIZE":
+		if len(args) != 1 {
+			return reply.Err(wrongArgsNumber)
 		}
+		return reply.Integer(int64(db.size()))
+	}
 
-	case strings.HasSuffix(command, "LEN"):
-		if firstArg == "" {
-			reply = fmt.Sprintf("%d", cache.totalBucketsLen())
-		} else {
-			reply = fmt.Sprintf("%d", bucket.Len(args[1:]...))
+	// a key lives in a single family, commands of other families are refused
+	if info := commandTable[command]; info.family != "" && firstArg != "" {
+		if info.write {
+			unlock := db.lockKeys(firstArg)
+			defer unlock()
 		}
-
-	case strings.HasSuffix(command, "REM"):
-		if err := bucket.Remove(args[1:]...); err != nil {
-			reply = err.Error()
-		} else {
-			cache.writeToLog(args)
-			reply = "Success"
+		if family := db.keyType(firstArg); family != "" && family != info.family {
+			return reply.Err(wrongType)
 		}
-
-	default:
-		reply = "Command not found"
 	}
 
-	return fmt.Sprintf("%s\n", reply)
-}
+	// JSON.SET JSON.GET JSON.DEL JSON.TYPE JSON.ARRAPPEND JSON.NUMINCRBY
+	if strings.HasPrefix(command, "JSON.") {
+		return cache.processJSONCommand(index, command, firstArg, args)
+	}
 
-func (cache *GlobalCache) pickBucket(command, key string) iBucket {
-	bucketIndex := cache.hashFunc(key)
-	switch {
-	// ZGET ZSET ZLEN ZREM ZKEYS
-	case strings.HasPrefix(command, "Z"):
-		return cache.listBuckets[bucketIndex]
-	// DGET DSET DLEN DREM DKEYS
-	case strings.HasPrefix(command, "D"):
-		return cache.dictBuckets[bucketIndex]
-	// GET SET LEN REM KEYS
-	default:
-		return cache.buckets[bucketIndex]
+	switch command {
+	case "SCAN":
+		return db.scanCommand(args)
+	case "DSCAN", "ZSCAN":
+		return db.memberScanCommand(args)
+	case "HMGET", "HMSET", "HGETALL":
+		return cache.processDictCommand(index, command, firstArg, args)
 	}
-}
 
-func (cache *GlobalCache) totalBucketsLen() int {
-	wg := &sync.WaitGroup{}
-	ch := make(chan int)
+	bucket := db.pickBucket(command, firstArg)
 
-	go func() {
-		for key := range cache.buckets {
-			wg.Add(1)
+	switch command {
+	case "GET", "ZGET", "DGET":
+		value, ok := bucket.Get(args[1:]...)
+		cache.stats.lookup(ok)
+		if !ok {
+			return reply.Nil
+		}
+		return reply.Value(value)
 
-			go func(buck *bucket.Bucket) {
-				ch <- buck.Len()
-				wg.Done()
-			}(cache.buckets[key])
+	case "SET", "ZSET", "DSET":
+		if err := bucket.Set(args[1:]...); err != nil {
+			return reply.Err(err)
 		}
+		cache.writeToLog(index, args)
+		return reply.OK
+
+	case "ZKEYS", "DKEYS":
+		return reply.Values(bucket.Keys(args[1:]...))
 
-		wg.Wait()
-		close(ch)
-	}()
+	case "LEN", "ZLEN", "DLEN":
+		if firstArg == "" {
+			return reply.Integer(int64(db.totalBucketsLen()))
+		}
+		return reply.Integer(int64(bucket.Len(args[1:]...)))
 
-	count := 0
-	for length := range ch {
-		count += length
+	case "REM", "ZREM", "DREM":
+		if err := bucket.Remove(args[1:]...); err != nil {
+			return reply.Err(err)
+		}
+		cache.writeToLog(index, args)
+		return reply.OK
 	}
 
-	return count
+	return reply.Err(commandNotFound)
 }
 
-func (cache *GlobalCache) totalBucketsKeys() string {
-	wg := &sync.WaitGroup{}
-	ch := make(chan string)
-
-	go func() {
-		for key := range cache.buckets {
-			wg.Add(1)
-
-			go func(buck *bucket.Bucket) {
-				ch <- buck.Keys()
-				wg.Done()
-			}(cache.buckets[key])
-		}
+// Close refuses new commands, stops sampling ops/sec, waits for running ones
+// and flushes the transaction log to disk
+func (cache *GlobalCache) Close() error {
+	if atomic.CompareAndSwapInt32(&cache.closed, 0, 1) {
+		close(cache.stopSampling)
+	}
 
-		wg.Wait()
-		close(ch)
-	}()
+	// commands which got through before hold the lock until they finish
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
 
-	result := make([]string, 0)
-	for msg := range ch {
-		result = append(result, msg)
+	if cache.transactionLogger == nil {
+		return nil
 	}
+	return cache.transactionLogger.Close()
+}
 
-	return strings.Join(result, ", ")
+// AbortScript stops the running script even if it has written, so that Close
+// does not wait for a script which never ends. The dataset may keep a part of
+// the script writes and should not be saved afterwards. It reports whether a
+// script was running
+func (cache *GlobalCache) AbortScript() bool {
+	return cache.scripts.abort()
 }
 
-func (cache *GlobalCache) writeToLog(args []string) {
+// writeToLog records a command executed against the database with the given index
+func (cache *GlobalCache) writeToLog(index int, args []string) {
+	atomic.AddInt64(&cache.stats.dirty, 1)
 	if cache.transactionLogger == nil {
 		// logging disabled
 		return
 	}
 
-	go func() {
-		cache.transactionLogger.LogChan <- fmt.Sprintf("%d %s\n", time.Now().Unix(), args)
-	}()
+	cache.transactionLogger.Write(tx_logger.Format(tx_logger.Entry{Time: time.Now(), DB: index, Args: args}))
+}
+
+// ParseRequest splits a request into arguments the way commands are parsed
+func (cache *GlobalCache) ParseRequest(request []byte) []string {
+	return cache.parseMessage(string(request))
 }
 
 func (cache *GlobalCache) parseMessage(msg string) []string {
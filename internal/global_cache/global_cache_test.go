@@ -1,8 +1,12 @@
 package global_cache
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"redis_like_in_memory_db/internal/reply"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestGlobalCache_ProcessCommand_keyValue(t *testing.T) {
@@ -30,7 +34,17 @@ func TestGlobalCache_ProcessCommand_keyValue(t *testing.T) {
 	{
 		cache.ProcessCommand([]string{"REM", "testArg1"})
 		reply := cache.ProcessCommand([]string{"GET", "testArg1"})
-		assert.EqualValues(t, reply, "value does not exist for given arguments\n")
+		assert.EqualValues(t, reply, "(nil)\n")
+	}
+
+	{
+		t.Log("Values which look like errors or nil should be escaped")
+		cache.ProcessCommand([]string{"SET", "error", "-ERR fake", "100m"})
+		cache.ProcessCommand([]string{"SET", "nil", "(nil)", "100m"})
+		assert.EqualValues(t, "+-ERR fake\n", cache.ProcessCommand([]string{"GET", "error"}))
+		assert.EqualValues(t, "+(nil)\n", cache.ProcessCommand([]string{"GET", "nil"}))
+		assert.EqualValues(t, "-1\n", cache.ProcessCommand([]string{"ZLEN", "missing"}))
+		assert.EqualValues(t, "-ERR wrong arguments number\n", cache.ProcessCommand([]string{"SET", "error"}))
 	}
 }
 
@@ -56,6 +70,14 @@ func TestGlobalCache_ProcessCommand_lists(t *testing.T) {
 		assert.Contains(t, reply, "world")
 		assert.Contains(t, reply, "yesterday")
 	}
+
+	{
+		t.Log("Values should be replied as an array")
+		cache.ProcessCommand([]string{"ZSET", "binary", "a, b", "1h"})
+		cache.ProcessCommand([]string{"ZSET", "binary", "\x00\r\n", "1h"})
+		result := cache.Execute(&Session{}, []string{"ZKEYS", "binary"})
+		assert.Equal(t, []string{"a, b", "\x00\r\n"}, result.Strings())
+	}
 }
 
 func TestGlobalCache_ProcessCommand_dictionary(t *testing.T) {
@@ -84,6 +106,108 @@ func TestGlobalCache_ProcessCommand_dictionary(t *testing.T) {
 	{
 		cache.ProcessCommand([]string{"DREM", "testDict", "random key"})
 		reply := cache.ProcessCommand([]string{"DGET", "testDict", "random key"})
-		assert.EqualValues(t, "value does not exist for given arguments\n", reply)
+		assert.EqualValues(t, "(nil)\n", reply)
+	}
+}
+
+func TestGlobalCache_ProcessCommand_json(t *testing.T) {
+	cache := NewCache(32, false)
+	{
+		reply := cache.ProcessCommand([]string{"JSON.SET", "doc", "$", `{"name":"moose","visits":1,"tags":[]}`, "1h"})
+		assert.EqualValues(t, "Success\n", reply)
+	}
+
+	{
+		reply := cache.ProcessCommand([]string{"JSON.NUMINCRBY", "doc", "$.visits", "2"})
+		assert.EqualValues(t, "3\n", reply)
+		reply = cache.ProcessCommand([]string{"JSON.ARRAPPEND", "doc", "$.tags", `"red"`, `"green"`})
+		assert.EqualValues(t, "2\n", reply)
+		reply = cache.ProcessCommand([]string{"JSON.TYPE", "doc", "$.tags"})
+		assert.EqualValues(t, "array\n", reply)
+	}
+
+	{
+		cache.ProcessCommand([]string{"JSON.DEL", "doc", "$.name"})
+		reply := cache.ProcessCommand([]string{"JSON.GET", "doc"})
+		assert.EqualValues(t, `{"tags":["red","green"],"visits":3}`+"\n", reply)
+	}
+
+	{
+		t.Log("JSON documents should not be accessible with plain key commands")
+		reply := cache.ProcessCommand([]string{"GET", "doc"})
+		assert.EqualValues(t, errorReply(wrongType), reply)
+	}
+}
+
+func TestGlobalCache_MaxMemory(t *testing.T) {
+	cache := NewCache(32, false)
+	cache.ProcessCommand([]string{"SET", "testArg", "hello", "100m"})
+	cache.SetMaxMemory(1)
+
+	{
+		reply := cache.ProcessCommand([]string{"SET", "testArg1", "hello", "100m"})
+		assert.EqualValues(t, "-OOM command not allowed when used memory > 'maxmemory'\n", reply)
+		reply = cache.ProcessCommand([]string{"GET", "testArg"})
+		assert.EqualValues(t, "hello\n", reply)
+		reply = cache.ProcessCommand([]string{"REM", "testArg"})
+		assert.EqualValues(t, "Success\n", reply)
+	}
+
+	{
+		cache.SetMaxMemory(0)
+		reply := cache.ProcessCommand([]string{"SET", "testArg1", "hello", "100m"})
+		assert.EqualValues(t, "Success\n", reply)
 	}
 }
+
+func TestGlobalCache_Eviction(t *testing.T) {
+	cache := NewCache(4, false)
+	assert.Error(t, cache.SetEvictionPolicy("allkeys-lru"))
+	assert.NoError(t, cache.SetEvictionPolicy(AllKeysRandom))
+	for i := 0; i < 10; i++ {
+		cache.ProcessCommand([]string{"SET", fmt.Sprintf("key%d", i), "hello", "100m"})
+	}
+	cache.ProcessSessionCommand(&Session{DB: 3}, []string{"DSET", "dict", "field", "hello", "100m"})
+	// the heap is reported just over the limit until the next sample
+	cache.SetMaxMemory(1 << 40)
+	atomic.StoreInt64(&cache.memory.used, 1<<40+1)
+	atomic.StoreInt64(&cache.memory.sampled, time.Now().Add(time.Hour).UnixNano())
+
+	{
+		t.Log("Writes over the limit should evict random keys until the memory is under it")
+		reply := cache.ProcessCommand([]string{"SET", "new", "hello", "100m"})
+		assert.EqualValues(t, "Success\n", reply)
+		assert.EqualValues(t, 1, cache.EvictedKeys())
+		size := cache.ProcessCommand([]string{"DBSIZE"}) + cache.ProcessSessionCommand(&Session{DB: 3}, []string{"DBSIZE"})
+		assert.Contains(t, []string{"10\n1\n", "11\n0\n"}, size)
+		assert.Contains(t, cache.ProcessCommand([]string{"INFO", "stats"}), "evicted_keys:1")
+
+		cache.ProcessCommand([]string{"SET", "other", "hello", "100m"})
+		assert.EqualValues(t, 1, cache.EvictedKeys())
+	}
+
+	{
+		cache.SetMaxMemory(1)
+		t.Log("Keys of every database should be evicted until none is left")
+		reply := cache.ProcessCommand([]string{"SET", "new", "hello", "100m"})
+		assert.EqualValues(t, "Success\n", reply)
+		assert.EqualValues(t, "0\n", cache.ProcessSessionCommand(&Session{DB: 3}, []string{"DBSIZE"}))
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"DBSIZE"}))
+		// the only key is evicted for itself
+		reply = cache.ProcessCommand([]string{"SET", "other", "hello", "100m"})
+		assert.EqualValues(t, "Success\n", reply)
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"DBSIZE"}))
+	}
+
+	{
+		t.Log("Writes should be refused when there is nothing to evict")
+		cache.ProcessCommand([]string{"FLUSHALL"})
+		reply := cache.ProcessCommand([]string{"SET", "new", "hello", "100m"})
+		assert.EqualValues(t, "-OOM command not allowed when used memory > 'maxmemory'\n", reply)
+	}
+}
+
+// errorReply returns the error reply of err encoded for the text protocol
+func errorReply(err error) string {
+	return reply.Err(err).String() + "\n"
+}
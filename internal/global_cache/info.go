@@ -0,0 +1,254 @@
+package global_cache
+
+import (
+	"fmt"
+	"redis_like_in_memory_db/internal/reply"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// infoSections lists INFO sections in output order, server and clients are
+// provided by the network server through AddInfoSection
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "keyspace", "shards"}
+
+// ops/sec is averaged over the last opsSamples samples taken every
+// opsSampleInterval, so it does not depend on how often INFO is called
+const (
+	opsSampleInterval = 100 * time.Millisecond
+	opsSamples        = 16
+)
+
+// stats counts commands for INFO, counters are updated atomically
+type stats struct {
+	commands       int64
+	keyspaceHits   int64
+	keyspaceMisses int64
+	// writes since the last snapshot
+	dirty int64
+
+	// commands count at the previous sample and the rates of the last samples
+	mu             sync.Mutex
+	sampleTime     time.Time
+	sampleCommands int64
+	samples        [opsSamples]float64
+	sampled        int
+}
+
+func (stats *stats) lookup(hit bool) {
+	if hit {
+		atomic.AddInt64(&stats.keyspaceHits, 1)
+	} else {
+		atomic.AddInt64(&stats.keyspaceMisses, 1)
+	}
+}
+
+// sampleOps samples the commands rate every opsSampleInterval until stop is closed
+func (stats *stats) sampleOps(stop <-chan struct{}) {
+	ticker := time.NewTicker(opsSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			stats.sample(now)
+		}
+	}
+}
+
+func (stats *stats) sample(now time.Time) {
+	commands := atomic.LoadInt64(&stats.commands)
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if elapsed := now.Sub(stats.sampleTime).Seconds(); elapsed > 0 {
+		stats.samples[stats.sampled%opsSamples] = float64(commands-stats.sampleCommands) / elapsed
+		stats.sampled++
+	}
+	stats.sampleTime, stats.sampleCommands = now, commands
+}
+
+func (stats *stats) opsPerSec() float64 {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	count := stats.sampled
+	if count > opsSamples {
+		count = opsSamples
+	}
+	if count == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, ops := range stats.samples[:count] {
+		sum += ops
+	}
+
+	return sum / float64(count)
+}
+
+// AddInfoSection adds a section to INFO, fn returns its 'field:value' lines
+func (cache *GlobalCache) AddInfoSection(name string, fn func() []string) {
+	cache.infoMu.Lock()
+	cache.infoProviders[strings.ToLower(name)] = fn
+	cache.infoMu.Unlock()
+}
+
+// Uptime returns the time since the cache was created
+func (cache *GlobalCache) Uptime() time.Duration {
+	return time.Since(cache.started)
+}
+
+// INFO [section ...] returns all sections when none or 'all' is given
+func (cache *GlobalCache) infoCommand(args []string) reply.Reply {
+	requested := make(map[string]bool)
+	for _, section := range args[1:] {
+		requested[strings.ToLower(section)] = true
+	}
+	all := len(requested) == 0 || requested["all"] || requested["default"] || requested["everything"]
+
+	sections := make([]string, 0)
+	for _, section := range infoSections {
+		if !all && !requested[section] {
+			continue
+		}
+
+		lines, ok := cache.infoSection(section)
+		if !ok {
+			continue
+		}
+		header := "# " + strings.ToUpper(section[:1]) + section[1:]
+		sections = append(sections, strings.Join(append([]string{header}, lines...), ", "))
+	}
+
+	return reply.Value(strings.Join(sections, "; "))
+}
+
+func (cache *GlobalCache) infoSection(section string) ([]string, bool) {
+	switch section {
+	case "memory":
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		fragmentation := 0.0
+		if memStats.HeapAlloc != 0 {
+			fragmentation = float64(memStats.HeapInuse) / float64(memStats.HeapAlloc)
+		}
+		return []string{
+			fmt.Sprintf("used_memory:%d", memStats.HeapAlloc),
+			fmt.Sprintf("used_memory_heap_inuse:%d", memStats.HeapInuse),
+			fmt.Sprintf("used_memory_sys:%d", memStats.Sys),
+			fmt.Sprintf("maxmemory:%d", cache.MaxMemory()),
+			fmt.Sprintf("maxmemory_policy:%s", cache.EvictionPolicy()),
+			fmt.Sprintf("mem_fragmentation_ratio:%.2f", fragmentation),
+			fmt.Sprintf("gc_runs:%d", memStats.NumGC),
+			fmt.Sprintf("goroutines:%d", runtime.NumGoroutine()),
+		}, true
+
+	case "persistence":
+		lines := []string{"tx_log_enabled:0"}
+		if cache.transactionLogger != nil {
+			lines = []string{
+				"tx_log_enabled:1",
+				fmt.Sprintf("tx_log_pending:%d", cache.transactionLogger.Pending()),
+			}
+		}
+		lastSave := int64(0)
+		if save := cache.LastSave(); !save.IsZero() {
+			lastSave = save.Unix()
+		}
+		return append(lines,
+			fmt.Sprintf("snapshot_file:%s", cache.SnapshotFile()),
+			fmt.Sprintf("changes_since_last_save:%d", atomic.LoadInt64(&cache.stats.dirty)),
+			fmt.Sprintf("last_save_time:%d", lastSave),
+		), true
+
+	case "stats":
+		return []string{
+			fmt.Sprintf("total_commands_processed:%d", atomic.LoadInt64(&cache.stats.commands)),
+			fmt.Sprintf("instantaneous_ops_per_sec:%.2f", cache.stats.opsPerSec()),
+			fmt.Sprintf("keyspace_hits:%d", atomic.LoadInt64(&cache.stats.keyspaceHits)),
+			fmt.Sprintf("keyspace_misses:%d", atomic.LoadInt64(&cache.stats.keyspaceMisses)),
+			fmt.Sprintf("evicted_keys:%d", cache.EvictedKeys()),
+		}, true
+
+	case "replication":
+		return []string{"role:master", "connected_slaves:0"}, true
+
+	case "keyspace":
+		lines := make([]string, 0)
+		for index, db := range cache.currentDatabases() {
+			var counts ShardCounts
+			for shard := range db.buckets {
+				counts.add(db.shardSizes(shard))
+			}
+			keys := counts.Keys()
+			if keys == 0 {
+				continue
+			}
+			// every key has a TTL, so all of them are expiring
+			lines = append(lines, fmt.Sprintf("db%d:keys=%d expires=%d string=%d list=%d dict=%d json=%d",
+				index, keys, keys, counts.String, counts.List, counts.Dict, counts.JSON))
+		}
+		return lines, true
+
+	case "shards":
+		lines := make([]string, 0)
+		for shard, counts := range cache.ShardKeyCounts() {
+			lines = append(lines, fmt.Sprintf("shard%d:keys=%d expires=%d string=%d list=%d dict=%d json=%d",
+				shard, counts.Keys(), counts.Keys(), counts.String, counts.List, counts.Dict, counts.JSON))
+		}
+		return lines, true
+	}
+
+	cache.infoMu.Lock()
+	provider, ok := cache.infoProviders[section]
+	cache.infoMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return provider(), true
+}
+
+// ShardCounts holds numbers of live keys of every family in a shard
+type ShardCounts struct {
+	String, List, Dict, JSON int
+}
+
+func (counts ShardCounts) Keys() int {
+	return counts.String + counts.List + counts.Dict + counts.JSON
+}
+
+func (counts *ShardCounts) add(other ShardCounts) {
+	counts.String += other.String
+	counts.List += other.List
+	counts.Dict += other.Dict
+	counts.JSON += other.JSON
+}
+
+// ShardKeyCounts returns key counts of every shard summed over databases,
+// they show how evenly the hash function spreads keys. Shards are sized
+// without walking their keys, so expired keys count until they are removed
+func (cache *GlobalCache) ShardKeyCounts() []ShardCounts {
+	counts := make([]ShardCounts, cache.numBuckets)
+	for _, db := range cache.currentDatabases() {
+		for shard := range counts {
+			counts[shard].add(db.shardSizes(shard))
+		}
+	}
+
+	return counts
+}
+
+// currentDatabases copies the databases under the cache lock, FLUSHDB,
+// FLUSHALL and SWAPDB replace elements of cache.databases in place
+func (cache *GlobalCache) currentDatabases() []*database {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	return append([]*database(nil), cache.databases...)
+}
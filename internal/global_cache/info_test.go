@@ -0,0 +1,130 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGlobalCache_Info(t *testing.T) {
+	cache := NewCacheWithDatabases(4, 4, false)
+	session := &Session{DB: 2}
+	cache.ProcessCommand([]string{"SET", "user:1", "moose", "1h"})
+	cache.ProcessCommand([]string{"ZSET", "colors", "red", "1h"})
+	cache.ProcessSessionCommand(session, []string{"DSET", "user:dict", "name", "elk", "1h"})
+	cache.ProcessCommand([]string{"GET", "user:1"})
+	cache.ProcessCommand([]string{"GET", "user:2"})
+	cache.ProcessSessionCommand(session, []string{"JSON.GET", "doc"})
+
+	{
+		t.Log("INFO keyspace should count keys of every family per database")
+		reply := cache.ProcessCommand([]string{"INFO", "keyspace"})
+		assert.EqualValues(t, "# Keyspace, db0:keys=2 expires=2 string=1 list=1 dict=0 json=0, "+
+			"db2:keys=1 expires=1 string=0 list=0 dict=1 json=0\n", reply)
+	}
+
+	{
+		t.Log("INFO stats should count commands, hits and misses")
+		reply := cache.ProcessCommand([]string{"INFO", "stats"})
+		assert.Contains(t, reply, "total_commands_processed:8,")
+		assert.Contains(t, reply, "keyspace_hits:1, keyspace_misses:2")
+	}
+
+	{
+		t.Log("INFO shards should sum keys of a shard over databases")
+		shards := 0
+		for _, counts := range cache.ShardKeyCounts() {
+			shards += counts.Keys()
+		}
+		assert.EqualValues(t, 3, shards)
+		assert.Contains(t, cache.ProcessCommand([]string{"INFO", "shards"}), "shard3:")
+	}
+
+	{
+		t.Log("Given no section it should return every section in order")
+		cache.AddInfoSection("server", func() []string { return []string{"uptime_in_seconds:0"} })
+		reply := cache.ProcessCommand([]string{"INFO"})
+		sections := make([]string, 0)
+		for _, section := range strings.Split(strings.TrimSuffix(reply, "\n"), "; ") {
+			sections = append(sections, strings.SplitN(section, ",", 2)[0])
+		}
+		assert.EqualValues(t, []string{"# Server", "# Memory", "# Persistence", "# Stats", "# Replication", "# Keyspace", "# Shards"}, sections)
+		assert.Contains(t, reply, "role:master")
+	}
+}
+
+func TestGlobalCache_InfoPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "info")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cache := NewCache(4, false)
+	cache.SetSnapshotFile(filepath.Join(dir, "dump.snapshot"))
+	cache.ProcessCommand([]string{"SET", "user:1", "moose", "1h"})
+	cache.ProcessCommand([]string{"SET", "user:2", "elk", "1h"})
+
+	reply := cache.ProcessCommand([]string{"INFO", "persistence"})
+	assert.Contains(t, reply, "tx_log_enabled:0")
+	assert.Contains(t, reply, "changes_since_last_save:2, last_save_time:0")
+
+	{
+		t.Log("SAVE should reset the changes counter")
+		cache.ProcessCommand([]string{"SAVE"})
+		reply = cache.ProcessCommand([]string{"INFO", "persistence"})
+		assert.Contains(t, reply, "changes_since_last_save:0")
+		assert.NotContains(t, reply, "last_save_time:0\n")
+	}
+}
+
+func TestGlobalCache_InfoOpsPerSec(t *testing.T) {
+	started := time.Now()
+	stats := &stats{sampleTime: started}
+
+	{
+		t.Log("ops/sec should be the average of samples taken at fixed intervals")
+		atomic.AddInt64(&stats.commands, 100)
+		stats.sample(started.Add(time.Second))
+		atomic.AddInt64(&stats.commands, 300)
+		stats.sample(started.Add(2 * time.Second))
+		assert.EqualValues(t, 200, stats.opsPerSec())
+	}
+
+	{
+		t.Log("Reading ops/sec should not reset the samples")
+		assert.EqualValues(t, 200, stats.opsPerSec())
+	}
+
+	{
+		t.Log("Only the last samples should be averaged")
+		for i := 3; i < 3+opsSamples; i++ {
+			stats.sample(started.Add(time.Duration(i) * time.Second))
+		}
+		assert.EqualValues(t, 0, stats.opsPerSec())
+	}
+}
+
+func TestGlobalCache_InfoKeyspaceSwapDB(t *testing.T) {
+	t.Log("INFO keyspace should not race with commands replacing databases")
+	cache := NewCacheWithDatabases(4, 4, false)
+	cache.ProcessCommand([]string{"SET", "user:1", "moose", "1h"})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cache.ProcessCommand([]string{"SWAPDB", "0", "1"})
+			cache.ProcessCommand([]string{"FLUSHDB"})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Contains(t, cache.ProcessCommand([]string{"INFO", "keyspace", "shards"}), "# Keyspace")
+	}
+	wg.Wait()
+}
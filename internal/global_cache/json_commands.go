@@ -0,0 +1,56 @@
+package global_cache
+
+import "redis_like_in_memory_db/internal/reply"
+
+func (cache *GlobalCache) processJSONCommand(index int, command, key string, args []string) reply.Reply {
+	db := cache.databases[index]
+	bucket := db.jsonBuckets[db.hashFunc(key)]
+
+	switch command {
+	case "JSON.GET":
+		value, ok := bucket.Get(args[1:]...)
+		cache.stats.lookup(ok)
+		if ok {
+			return reply.Value(value)
+		}
+		return reply.Nil
+
+	case "JSON.TYPE":
+		if value, ok := bucket.Type(args[1:]...); ok {
+			return reply.Status(value)
+		}
+		return reply.Nil
+
+	case "JSON.SET":
+		if err := bucket.Set(args[1:]...); err != nil {
+			return reply.Err(err)
+		}
+
+	case "JSON.DEL":
+		if err := bucket.Remove(args[1:]...); err != nil {
+			return reply.Err(err)
+		}
+
+	case "JSON.ARRAPPEND":
+		length, err := bucket.ArrAppend(args[1:]...)
+		if err != nil {
+			return reply.Err(err)
+		}
+		cache.writeToLog(index, args)
+		return reply.Integer(int64(length))
+
+	case "JSON.NUMINCRBY":
+		value, err := bucket.NumIncrBy(args[1:]...)
+		if err != nil {
+			return reply.Err(err)
+		}
+		cache.writeToLog(index, args)
+		return reply.Value(value)
+
+	default:
+		return reply.Err(commandNotFound)
+	}
+
+	cache.writeToLog(index, args)
+	return reply.OK
+}
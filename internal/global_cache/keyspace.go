@@ -0,0 +1,195 @@
+package global_cache
+
+import (
+	"math/rand"
+	"redis_like_in_memory_db/internal/glob"
+	"redis_like_in_memory_db/internal/reply"
+)
+
+var (
+	wrongType   = reply.ErrWrongType
+	noSuchKey   = reply.ErrNoSuchKey
+	sameKeys    = reply.ErrSameKeys
+	syntaxError = reply.ErrSyntax
+)
+
+// dumpedKey is a copy of a key of any family, used to rename and copy keys
+type dumpedKey struct {
+	family string
+	value  interface{}
+}
+
+// processKeyspaceCommand handles commands which work with keys of any family
+func (cache *GlobalCache) processKeyspaceCommand(index int, args []string) reply.Reply {
+	db := cache.databases[index]
+	command := args[0]
+	keys := commandKeys(args)
+	if commandTable[command].write {
+		unlock := db.lockKeys(keys...)
+		defer unlock()
+	}
+
+	switch command {
+	case "KEYS":
+		return db.keysCommand(args)
+
+	case "RANDOMKEY":
+		if len(args) != 1 {
+			return reply.Err(wrongArgsNumber)
+		}
+		if key := db.randomKey(); key != "" {
+			return reply.Value(key)
+		}
+		return reply.Nil
+
+	case "DEL", "UNLINK":
+		if len(keys) == 0 {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		count := 0
+		for _, key := range keys {
+			if db.deleteKey(key) {
+				count++
+			}
+		}
+		if count != 0 {
+			cache.writeToLog(index, args)
+		}
+		return reply.Integer(int64(count))
+
+	case "EXISTS":
+		if len(keys) == 0 {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		count := 0
+		for _, key := range keys {
+			if db.keyType(key) != "" {
+				count++
+			}
+		}
+		return reply.Integer(int64(count))
+
+	case "TYPE":
+		if len(args) != 2 {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		if family := db.keyType(args[1]); family != "" {
+			return reply.Status(family)
+		}
+		return reply.Status("none")
+
+	case "RENAME", "RENAMENX":
+		if len(args) != 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		renamed, err := db.moveKey(args[1], args[2], command == "RENAME", true)
+		if err != nil {
+			return reply.Err(err)
+		}
+		if command == "RENAME" {
+			cache.writeToLog(index, args)
+			return reply.OK
+		}
+		if renamed {
+			cache.writeToLog(index, args)
+			return reply.Integer(1)
+		}
+		return reply.Integer(0)
+
+	case "COPY":
+		replace := len(args) == 4 && args[3] == "REPLACE"
+		if len(args) != 3 && !replace {
+			return reply.Err(syntaxError)
+		}
+
+		copied, err := db.moveKey(args[1], args[2], replace, false)
+		if err != nil {
+			return reply.Err(err)
+		}
+		if copied {
+			cache.writeToLog(index, args)
+			return reply.Integer(1)
+		}
+		return reply.Integer(0)
+	}
+
+	return reply.Err(commandNotFound)
+}
+
+// moveKey copies source to destination removing the source when rename is
+// set. An existing destination of any family is overwritten only when replace
+// is set, otherwise nothing happens and false is returned
+func (db *database) moveKey(source, destination string, replace, rename bool) (bool, error) {
+	if source == destination {
+		if rename && db.keyType(source) != "" {
+			// renaming a key to itself changes nothing
+			return false, nil
+		}
+		return false, sameKeys
+	}
+
+	dumped, ok := db.dumpKey(source)
+	if !ok {
+		return false, noSuchKey
+	}
+
+	if db.keyType(destination) != "" {
+		if !replace {
+			return false, nil
+		}
+		db.deleteKey(destination)
+	}
+
+	if err := db.restoreKey(destination, dumped); err != nil {
+		return false, err
+	}
+	if rename {
+		db.deleteKey(source)
+	}
+
+	return true, nil
+}
+
+// KEYS [pattern] returns live keys of every family matching the pattern
+func (db *database) keysCommand(args []string) reply.Reply {
+	if len(args) > 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	pattern := "*"
+	if len(args) == 2 {
+		pattern = args[1]
+	}
+
+	keys := make([]string, 0)
+	for shard := range db.buckets {
+		db.rangeShard(shard, func(key, _ string) {
+			if glob.Match(pattern, key) {
+				keys = append(keys, key)
+			}
+		})
+	}
+
+	return reply.Values(keys)
+}
+
+// randomKey starts at a random shard and returns a key of the first non empty one
+func (db *database) randomKey() string {
+	start := rand.Intn(len(db.buckets))
+	for i := 0; i < len(db.buckets); i++ {
+		keys := make([]string, 0)
+		db.rangeShard((start+i)%len(db.buckets), func(key, _ string) {
+			keys = append(keys, key)
+		})
+
+		if len(keys) != 0 {
+			return keys[rand.Intn(len(keys))]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,141 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupKeyspace(cache *GlobalCache) {
+	cache.ProcessCommand([]string{"SET", "user:1", "moose", "1h"})
+	cache.ProcessCommand([]string{"ZSET", "user:list", "red", "1h"})
+	cache.ProcessCommand([]string{"DSET", "user:dict", "name", "elk", "1h"})
+	cache.ProcessCommand([]string{"JSON.SET", "session:1", "$", `{"a":1}`, "1h"})
+}
+
+func TestGlobalCache_Keys(t *testing.T) {
+	cache := NewCache(32, false)
+	setupKeyspace(cache)
+
+	{
+		t.Log("Given no pattern it should return keys of every family")
+		keys := strings.Split(strings.TrimSpace(cache.ProcessCommand([]string{"KEYS"})), ", ")
+		assert.ElementsMatch(t, []string{"user:1", "user:list", "user:dict", "session:1"}, keys)
+	}
+
+	{
+		keys := strings.Split(strings.TrimSpace(cache.ProcessCommand([]string{"KEYS", "user:*"})), ", ")
+		assert.ElementsMatch(t, []string{"user:1", "user:list", "user:dict"}, keys)
+	}
+
+	{
+		key := strings.TrimSpace(cache.ProcessCommand([]string{"RANDOMKEY"}))
+		assert.Contains(t, []string{"user:1", "user:list", "user:dict", "session:1"}, key)
+		reply := NewCache(4, false).ProcessCommand([]string{"RANDOMKEY"})
+		assert.EqualValues(t, "(nil)\n", reply)
+	}
+}
+
+func TestGlobalCache_TypeExistsDel(t *testing.T) {
+	cache := NewCache(32, false)
+	setupKeyspace(cache)
+
+	{
+		t.Log("It should report type of every family")
+		expected := map[string]string{
+			"user:1":    "string",
+			"user:list": "list",
+			"user:dict": "dict",
+			"session:1": "json",
+			"missing":   "none",
+		}
+		for key, typeName := range expected {
+			assert.EqualValues(t, typeName+"\n", cache.ProcessCommand([]string{"TYPE", key}), key)
+		}
+	}
+
+	{
+		reply := cache.ProcessCommand([]string{"EXISTS", "user:1", "user:list", "missing", "user:1"})
+		assert.EqualValues(t, "3\n", reply)
+	}
+
+	{
+		reply := cache.ProcessCommand([]string{"DEL", "user:1", "user:dict", "missing"})
+		assert.EqualValues(t, "2\n", reply)
+		reply = cache.ProcessCommand([]string{"UNLINK", "session:1"})
+		assert.EqualValues(t, "1\n", reply)
+		reply = cache.ProcessCommand([]string{"EXISTS", "user:1", "user:dict", "session:1"})
+		assert.EqualValues(t, "0\n", reply)
+	}
+}
+
+func TestGlobalCache_WrongType(t *testing.T) {
+	cache := NewCache(32, false)
+	setupKeyspace(cache)
+
+	{
+		t.Log("Given a key of one family it should not be created in another one")
+		reply := cache.ProcessCommand([]string{"ZSET", "user:1", "red", "1h"})
+		assert.EqualValues(t, errorReply(wrongType), reply)
+		reply = cache.ProcessCommand([]string{"DSET", "user:list", "a", "b", "1h"})
+		assert.EqualValues(t, errorReply(wrongType), reply)
+		reply = cache.ProcessCommand([]string{"SET", "session:1", "v", "1h"})
+		assert.EqualValues(t, errorReply(wrongType), reply)
+		reply = cache.ProcessCommand([]string{"DGET", "user:1", "a"})
+		assert.EqualValues(t, errorReply(wrongType), reply)
+	}
+
+	{
+		t.Log("Given a removed key it should be created in another family")
+		cache.ProcessCommand([]string{"DEL", "user:1"})
+		reply := cache.ProcessCommand([]string{"ZSET", "user:1", "red", "1h"})
+		assert.EqualValues(t, "Success\n", reply)
+	}
+
+	{
+		t.Log("Given expired lists and dictionaries they should not exist for any family")
+		cache.ProcessCommand([]string{"ZSET", "old:list", "red", "1ms"})
+		cache.ProcessCommand([]string{"DSET", "old:dict", "name", "elk", "1ms"})
+		time.Sleep(10 * time.Millisecond)
+
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"EXISTS", "old:list", "old:dict"}))
+		assert.EqualValues(t, "none\n", cache.ProcessCommand([]string{"TYPE", "old:dict"}))
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"MSETNX", "old:list", "v", "1h"}))
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"SET", "old:dict", "v", "1h"}))
+	}
+}
+
+func TestGlobalCache_RenameCopy(t *testing.T) {
+	cache := NewCache(32, false)
+	setupKeyspace(cache)
+
+	{
+		t.Log("It should rename keys of every family")
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"RENAME", "user:dict", "people"}))
+		assert.EqualValues(t, "elk\n", cache.ProcessCommand([]string{"DGET", "people", "name"}))
+		assert.EqualValues(t, "none\n", cache.ProcessCommand([]string{"TYPE", "user:dict"}))
+
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"RENAME", "session:1", "session:2"}))
+		assert.EqualValues(t, `{"a":1}`+"\n", cache.ProcessCommand([]string{"JSON.GET", "session:2"}))
+	}
+
+	{
+		t.Log("RENAME should overwrite a destination of another family, RENAMENX should not")
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"RENAMENX", "user:1", "people"}))
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"RENAME", "user:1", "people"}))
+		assert.EqualValues(t, "string\n", cache.ProcessCommand([]string{"TYPE", "people"}))
+		assert.EqualValues(t, errorReply(noSuchKey), cache.ProcessCommand([]string{"RENAME", "user:1", "x"}))
+	}
+
+	{
+		t.Log("COPY should not share values between keys")
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"COPY", "session:2", "session:3"}))
+		cache.ProcessCommand([]string{"JSON.SET", "session:3", "$.a", "2"})
+		assert.EqualValues(t, `{"a":1}`+"\n", cache.ProcessCommand([]string{"JSON.GET", "session:2"}))
+
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"COPY", "user:list", "session:3"}))
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"COPY", "user:list", "session:3", "REPLACE"}))
+		assert.EqualValues(t, "red\n", cache.ProcessCommand([]string{"ZGET", "session:3", "0"}))
+	}
+}
@@ -0,0 +1,113 @@
+package global_cache
+
+import (
+	"fmt"
+	"redis_like_in_memory_db/internal/reply"
+	"strings"
+	"time"
+)
+
+// latency events of internal operations, keys expire on access so there is no
+// expiry cycle to measure
+const (
+	commandEvent      = "command"
+	txLogWriteEvent   = "tx-log-write"
+	snapshotSaveEvent = "snapshot-save"
+	snapshotLoadEvent = "snapshot-load"
+	flushEvent        = "flush"
+)
+
+// SetLatencyThreshold sets the duration above which internal operations are
+// recorded by LATENCY, 0 disables the monitor
+func (cache *GlobalCache) SetLatencyThreshold(threshold time.Duration) {
+	cache.latency.SetThreshold(threshold)
+}
+
+func (cache *GlobalCache) LatencyThreshold() time.Duration {
+	return cache.latency.Threshold()
+}
+
+// recordLatency reports an internal operation started at start
+func (cache *GlobalCache) recordLatency(event string, start time.Time) {
+	cache.latency.Record(event, time.Since(start))
+}
+
+func milliseconds(duration time.Duration) int64 {
+	return int64(duration / time.Millisecond)
+}
+
+// LATENCY LATEST | HISTORY event | RESET [event ...] | DOCTOR
+func (cache *GlobalCache) latencyCommand(args []string) reply.Reply {
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	switch args[1] {
+	case "LATEST":
+		events := make([]string, 0)
+		for _, event := range cache.latency.Events() {
+			events = append(events, fmt.Sprintf("event=%s time=%d latest=%d max=%d",
+				event.Name, event.Latest.Time.Unix(), milliseconds(event.Latest.Duration), milliseconds(event.Max)))
+		}
+		return reply.Values(events)
+
+	case "HISTORY":
+		if len(args) != 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		event, _ := cache.latency.Event(args[2])
+		samples := make([]string, 0, len(event.History))
+		for _, sample := range event.History {
+			samples = append(samples, fmt.Sprintf("time=%d latency=%d", sample.Time.Unix(), milliseconds(sample.Duration)))
+		}
+		return reply.Values(samples)
+
+	case "RESET":
+		return reply.Integer(int64(cache.latency.Reset(args[2:]...)))
+
+	case "DOCTOR":
+		return reply.Value(cache.latencyDoctor())
+	}
+
+	return reply.Err(commandNotFound)
+}
+
+// latencyDoctor describes recorded events and suggests what to look at
+func (cache *GlobalCache) latencyDoctor() string {
+	threshold := cache.latency.Threshold()
+	if threshold <= 0 {
+		return "Latency monitoring is disabled, set latency_monitor_threshold to enable it."
+	}
+
+	events := cache.latency.Events()
+	if len(events) == 0 {
+		return fmt.Sprintf("No latency spikes above %d ms were observed.", milliseconds(threshold))
+	}
+
+	report := []string{fmt.Sprintf("Latency spikes above %d ms were observed:", milliseconds(threshold))}
+	for i, event := range events {
+		average := event.Total / time.Duration(event.Count)
+		report = append(report, fmt.Sprintf("%d. %s: %d spikes, average %d ms, worst %d ms.",
+			i+1, event.Name, event.Count, milliseconds(average), milliseconds(event.Max)))
+	}
+
+	advice := make([]string, 0)
+	for _, event := range events {
+		switch event.Name {
+		case commandEvent:
+			advice = append(advice, "Check SLOWLOG GET for commands walking many keys such as KEYS, LEN or long lists, prefer SCAN.")
+		case txLogWriteEvent:
+			advice = append(advice, "The transaction log disk is slow, move tx_logs to a faster disk or disable logging.")
+		case snapshotSaveEvent, snapshotLoadEvent:
+			advice = append(advice, "Snapshots block commands while the dataset is copied, save less often or reduce the dataset.")
+		case flushEvent:
+			advice = append(advice, "Use FLUSHDB ASYNC or FLUSHALL ASYNC to skip the garbage collection.")
+		}
+	}
+	if len(advice) != 0 {
+		report = append(report, "Advice:")
+		report = append(report, advice...)
+	}
+
+	return strings.Join(report, " ")
+}
@@ -0,0 +1,201 @@
+package global_cache
+
+import (
+	"errors"
+	"math/rand"
+	"redis_like_in_memory_db/internal/bucket"
+	"redis_like_in_memory_db/internal/dict_bucket"
+	"redis_like_in_memory_db/internal/json_bucket"
+	"redis_like_in_memory_db/internal/list_bucket"
+	"redis_like_in_memory_db/internal/reply"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// used memory is sampled at most this often since reading it stops the world
+const memorySampleInterval = 100 * time.Millisecond
+
+// policies applied to commands adding data once the heap exceeds maxmemory
+const (
+	// commands are refused
+	NoEviction = "noeviction"
+	// random keys of any family are removed to make room
+	AllKeysRandom = "allkeys-random"
+)
+
+// random keys taken from a shard at once while evicting
+const evictionBatch = 16
+
+// bytes a stored entry is assumed to take besides its key and value
+const entryOverhead = 64
+
+var (
+	outOfMemory           = reply.ErrOutOfMemory
+	unknownEvictionPolicy = errors.New("eviction policy should be noeviction or allkeys-random")
+)
+
+// memoryLimit refuses commands which grow the dataset or evicts keys for them
+// once the heap exceeds max bytes, fields are accessed atomically
+type memoryLimit struct {
+	// 0 disables the limit
+	max  int64
+	used int64
+	// unix nanoseconds of the last sample
+	sampled int64
+	// 1 when keys are evicted instead of refusing commands
+	evict   int32
+	evicted int64
+}
+
+// SetMaxMemory sets the heap size above which the eviction policy applies to
+// commands adding data, 0 disables the limit
+func (cache *GlobalCache) SetMaxMemory(bytes int64) {
+	atomic.StoreInt64(&cache.memory.max, bytes)
+	// the next check samples the heap again
+	atomic.StoreInt64(&cache.memory.sampled, 0)
+}
+
+func (cache *GlobalCache) MaxMemory() int64 {
+	return atomic.LoadInt64(&cache.memory.max)
+}
+
+func (cache *GlobalCache) overMemoryLimit() bool {
+	max := atomic.LoadInt64(&cache.memory.max)
+	if max <= 0 {
+		return false
+	}
+
+	now := time.Now().UnixNano()
+	sampled := atomic.LoadInt64(&cache.memory.sampled)
+	if now-sampled > int64(memorySampleInterval) && atomic.CompareAndSwapInt64(&cache.memory.sampled, sampled, now) {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		if int64(memStats.HeapAlloc) > max {
+			// evicted keys are only released by the collector, so the heap is
+			// collected before evicting keys which may already be garbage
+			runtime.GC()
+			runtime.ReadMemStats(&memStats)
+		}
+		atomic.StoreInt64(&cache.memory.used, int64(memStats.HeapAlloc))
+	}
+
+	return atomic.LoadInt64(&cache.memory.used) > max
+}
+
+// SetEvictionPolicy sets what happens to commands adding data above the
+// memory limit: NoEviction refuses them, AllKeysRandom removes random keys
+func (cache *GlobalCache) SetEvictionPolicy(policy string) error {
+	if err := CheckEvictionPolicy(policy); err != nil {
+		return err
+	}
+	var evict int32
+	if policy == AllKeysRandom {
+		evict = 1
+	}
+	atomic.StoreInt32(&cache.memory.evict, evict)
+
+	return nil
+}
+
+// CheckEvictionPolicy returns an error when the policy is unknown
+func CheckEvictionPolicy(policy string) error {
+	if policy != NoEviction && policy != AllKeysRandom {
+		return unknownEvictionPolicy
+	}
+
+	return nil
+}
+
+func (cache *GlobalCache) EvictionPolicy() string {
+	if atomic.LoadInt32(&cache.memory.evict) == 1 {
+		return AllKeysRandom
+	}
+
+	return NoEviction
+}
+
+// EvictedKeys returns the number of keys removed to free memory
+func (cache *GlobalCache) EvictedKeys() int64 {
+	return atomic.LoadInt64(&cache.memory.evicted)
+}
+
+// evict removes random keys until the used memory less the estimated size of
+// removed keys gets under the limit, it returns false when nothing was removed
+// and the command has to be refused. Evictions are logged as DEL, so
+// replaying the log gives the same dataset
+func (cache *GlobalCache) evict() bool {
+	if atomic.LoadInt32(&cache.memory.evict) == 0 {
+		return false
+	}
+
+	// databases and shards are visited from random ones, so the command is
+	// refused only when the cache is empty
+	evicted := 0
+	start := rand.Intn(len(cache.databases))
+	for i := 0; i < len(cache.databases) && cache.overEvictionTarget(); i++ {
+		index := (start + i) % len(cache.databases)
+		shards := len(cache.databases[index].buckets)
+		startShard := rand.Intn(shards)
+		for j := 0; j < shards && cache.overEvictionTarget(); j++ {
+			evicted += cache.evictShard(index, (startShard+j)%shards)
+		}
+	}
+	atomic.AddInt64(&cache.memory.evicted, int64(evicted))
+
+	return evicted != 0
+}
+
+// evictShard removes random keys of the shard while the memory is over the
+// limit and returns how many were removed
+func (cache *GlobalCache) evictShard(index, shard int) int {
+	db := cache.databases[index]
+	evicted := 0
+	for cache.overEvictionTarget() {
+		keys := db.randomKeys(shard, evictionBatch)
+		if len(keys) == 0 {
+			break
+		}
+		for _, key := range keys {
+			if !cache.overEvictionTarget() {
+				break
+			}
+			unlock := db.lockKeys(key)
+			dumped, ok := db.dumpKey(key)
+			deleted := ok && db.deleteKey(key)
+			unlock()
+			if deleted {
+				evicted++
+				atomic.AddInt64(&cache.memory.used, -dumped.size(key))
+				cache.writeToLog(index, []string{"DEL", key})
+			}
+		}
+	}
+
+	return evicted
+}
+
+func (cache *GlobalCache) overEvictionTarget() bool {
+	return atomic.LoadInt64(&cache.memory.used) > atomic.LoadInt64(&cache.memory.max)
+}
+
+// size estimates the bytes the key takes with its values
+func (dumped dumpedKey) size(key string) int64 {
+	size := int64(len(key) + entryOverhead)
+	switch value := dumped.value.(type) {
+	case bucket.Entry:
+		size += int64(len(value.Value))
+	case json_bucket.Entry:
+		size += int64(len(value.Value))
+	case []list_bucket.Entry:
+		for _, entry := range value {
+			size += int64(len(entry.Value) + entryOverhead)
+		}
+	case map[string]dict_bucket.Entry:
+		for field, entry := range value {
+			size += int64(len(field) + len(entry.Value) + entryOverhead)
+		}
+	}
+
+	return size
+}
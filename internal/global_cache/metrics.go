@@ -0,0 +1,107 @@
+package global_cache
+
+import (
+	"fmt"
+	"redis_like_in_memory_db/internal/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// unknownCommand labels latency of commands missing in the command table, so
+// that clients sending garbage do not create new series
+const unknownCommand = "unknown"
+
+func newCommandLatency() map[string]*metrics.Histogram {
+	latency := make(map[string]*metrics.Histogram, len(commandTable)+1)
+	for command := range commandTable {
+		latency[command] = metrics.NewHistogram(metrics.LatencyBuckets)
+	}
+	latency[unknownCommand] = metrics.NewHistogram(metrics.LatencyBuckets)
+
+	return latency
+}
+
+// finishCommand records the latency of a command started at start
+func (cache *GlobalCache) finishCommand(session *Session, args []string, start time.Time) {
+	duration := time.Since(start)
+	histogram, ok := cache.commandLatency[args[0]]
+	if !ok {
+		histogram = cache.commandLatency[unknownCommand]
+	}
+	histogram.Observe(duration)
+
+	cache.slowlog.add(session, args, duration)
+	cache.latency.Record(commandEvent, duration)
+}
+
+// shardSizes returns numbers of stored keys of every family in a shard, keys
+// are not walked so expired ones are counted until removed
+func (db *database) shardSizes(shard int) ShardCounts {
+	return ShardCounts{
+		String: db.buckets[shard].Size(),
+		List:   db.listBuckets[shard].Size(),
+		Dict:   db.dictBuckets[shard].Size(),
+		JSON:   db.jsonBuckets[shard].Size(),
+	}
+}
+
+// expired returns the number of keys removed from the database after their ttl
+func (db *database) expired() uint64 {
+	count := uint64(0)
+	for shard := range db.buckets {
+		count += db.buckets[shard].Expired() + db.listBuckets[shard].Expired() +
+			db.dictBuckets[shard].Expired() + db.jsonBuckets[shard].Expired()
+	}
+
+	return count
+}
+
+// CollectMetrics writes command, keyspace and persistence metrics. It takes
+// no key locks, shards are sized without walking their keys
+func (cache *GlobalCache) CollectMetrics(w *metrics.Writer) {
+	w.Histograms("cache_command_duration_seconds", "Latency of executed commands.", "command", cache.commandLatency)
+	w.Counter("cache_commands_total", "Commands received including refused ones.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&cache.stats.commands))})
+	w.Counter("cache_keyspace_hits_total", "Reads of existing keys.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&cache.stats.keyspaceHits))})
+	w.Counter("cache_keyspace_misses_total", "Reads of missing keys.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&cache.stats.keyspaceMisses))})
+
+	expired := uint64(0)
+	for _, db := range cache.currentDatabases() {
+		expired += db.expired()
+	}
+	shards := cache.ShardKeyCounts()
+
+	w.Counter("cache_expired_keys_total", "Keys removed after their ttl passed, reset by FLUSHDB and FLUSHALL.",
+		metrics.Sample{Value: float64(expired)})
+	w.Counter("cache_evicted_keys_total", "Keys evicted to free memory.",
+		metrics.Sample{Value: float64(cache.EvictedKeys())})
+
+	samples := make([]metrics.Sample, 0, len(shards)*4)
+	for shard, counts := range shards {
+		label := metrics.Label("shard", fmt.Sprintf("%d", shard))
+		samples = append(samples,
+			metrics.Sample{Labels: label + "," + metrics.Label("family", "string"), Value: float64(counts.String)},
+			metrics.Sample{Labels: label + "," + metrics.Label("family", "list"), Value: float64(counts.List)},
+			metrics.Sample{Labels: label + "," + metrics.Label("family", "dict"), Value: float64(counts.Dict)},
+			metrics.Sample{Labels: label + "," + metrics.Label("family", "json"), Value: float64(counts.JSON)},
+		)
+	}
+	w.Gauge("cache_shard_keys", "Keys stored in a bucket shard summed over databases.", samples...)
+
+	w.Gauge("cache_changes_since_last_save", "Writes made after the last snapshot.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&cache.stats.dirty))})
+	lastSave := 0.0
+	if save := cache.LastSave(); !save.IsZero() {
+		lastSave = float64(save.Unix())
+	}
+	w.Gauge("cache_last_save_timestamp_seconds", "Time of the last successful snapshot.", metrics.Sample{Value: lastSave})
+
+	if cache.transactionLogger != nil {
+		w.Gauge("cache_tx_log_pending_entries", "Transaction log entries waiting to be written.",
+			metrics.Sample{Value: float64(cache.transactionLogger.Pending())})
+		w.Histograms("cache_tx_log_write_duration_seconds", "Latency of transaction log writes.", "",
+			map[string]*metrics.Histogram{"": cache.transactionLogger.WriteLatency})
+	}
+}
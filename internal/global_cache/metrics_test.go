@@ -0,0 +1,37 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"redis_like_in_memory_db/internal/metrics"
+	"sync"
+	"testing"
+)
+
+func TestGlobalCache_CollectMetricsSwapDB(t *testing.T) {
+	t.Log("Metrics should not race with commands replacing databases")
+	cache := NewCacheWithDatabases(4, 4, false)
+	cache.ProcessCommand([]string{"SET", "user:1", "moose", "1h"})
+
+	var wg sync.WaitGroup
+	collected := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-collected:
+				return
+			default:
+				cache.ProcessCommand([]string{"SWAPDB", "0", "1"})
+			}
+		}
+	}()
+	for i := 0; i < 500; i++ {
+		w := metrics.NewWriter(ioutil.Discard)
+		cache.CollectMetrics(w)
+		assert.NoError(t, w.Err())
+	}
+	close(collected)
+	wg.Wait()
+}
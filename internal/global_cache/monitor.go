@@ -0,0 +1,79 @@
+package global_cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBuffer is the number of lines a slow monitor may lag behind, later
+// lines are dropped so that commands never wait for monitors
+const monitorBuffer = 1024
+
+// monitors fans executed commands out to MONITOR connections
+type monitors struct {
+	// read without the lock so that commands skip formatting while nobody monitors
+	count int32
+
+	mu          sync.Mutex
+	subscribers map[int64]chan string
+	nextID      int64
+}
+
+func newMonitors() *monitors {
+	return &monitors{subscribers: make(map[int64]chan string)}
+}
+
+// Monitor subscribes to lines describing every command, stop unsubscribes and
+// closes the channel
+func (cache *GlobalCache) Monitor() (<-chan string, func()) {
+	m := cache.monitors
+	lines := make(chan string, monitorBuffer)
+
+	m.mu.Lock()
+	m.nextID++
+	id := m.nextID
+	m.subscribers[id] = lines
+	atomic.AddInt32(&m.count, 1)
+	m.mu.Unlock()
+
+	var once sync.Once
+	return lines, func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.subscribers, id)
+			atomic.AddInt32(&m.count, -1)
+			m.mu.Unlock()
+			close(lines)
+		})
+	}
+}
+
+// feedMonitors sends the command to every monitor as
+// '1700000000.123456 [db addr] "SET" "key" "value"', passwords are hidden
+func (cache *GlobalCache) feedMonitors(db int, addr string, args []string) {
+	m := cache.monitors
+	if atomic.LoadInt32(&m.count) == 0 {
+		return
+	}
+
+	now := time.Now()
+	quoted := make([]string, 0, len(args))
+	for _, arg := range redactArgs(args) {
+		quoted = append(quoted, strconv.Quote(arg))
+	}
+	line := fmt.Sprintf("%d.%06d [%d %s] %s", now.Unix(), now.Nanosecond()/1000, db, addr, strings.Join(quoted, " "))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, lines := range m.subscribers {
+		select {
+		case lines <- line:
+		default:
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestGlobalCache_Monitor(t *testing.T) {
+	cache := NewCache(4, false)
+	cache.ProcessCommand([]string{"SET", "before", "monitor", "1h"})
+
+	lines, stop := cache.Monitor()
+	session := &Session{DB: 0, Addr: "127.0.0.1:5000"}
+	cache.ProcessSessionCommand(session, []string{"SET", "greeting", "hello world", "1h"})
+	cache.ProcessSessionCommand(session, []string{"AUTH", "secret"})
+	cache.ProcessSessionCommand(session, []string{"EVAL", `return redis.call("GET", KEYS[1])`, "1", "greeting"})
+
+	{
+		t.Log("It should describe every command with its time, database and client")
+		assert.Regexp(t, regexp.MustCompile(`^\d+\.\d{6} \[0 127.0.0.1:5000\] "SET" "greeting" "hello world" "1h"$`), <-lines)
+		assert.Regexp(t, `\[0 127.0.0.1:5000\] "AUTH" "\(redacted\)"$`, <-lines)
+		assert.Regexp(t, `\[0 127.0.0.1:5000\] "EVAL" `, <-lines)
+		assert.Regexp(t, `\[0 lua\] "GET" "greeting"$`, <-lines)
+	}
+
+	{
+		t.Log("Given the monitor stopped it should close the channel")
+		stop()
+		cache.ProcessCommand([]string{"DBSIZE"})
+		_, ok := <-lines
+		assert.False(t, ok)
+	}
+}
@@ -0,0 +1,67 @@
+package global_cache
+
+import "redis_like_in_memory_db/internal/reply"
+
+// processMultiKeyCommand handles commands which read or write several plain
+// keys at once. They hold shards of every key, so MGET never sees a part of
+// an MSET
+func (cache *GlobalCache) processMultiKeyCommand(index int, args []string) reply.Reply {
+	db := cache.databases[index]
+	command := args[0]
+	keys := commandKeys(args)
+	unlock := db.lockKeys(keys...)
+	defer unlock()
+
+	switch command {
+	// MGET key [key ...]
+	case "MGET":
+		if len(keys) == 0 {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		// keys of other families are missing plain keys
+		values := make([]reply.Reply, 0, len(keys))
+		for _, key := range keys {
+			value, ok := db.buckets[db.hashFunc(key)].Get(key)
+			cache.stats.lookup(ok)
+			if !ok {
+				values = append(values, reply.Nil)
+				continue
+			}
+			values = append(values, reply.Value(value))
+		}
+		return reply.Array(values)
+
+	// MSET key value [key value ...] ttl
+	// MSETNX key value [key value ...] ttl
+	case "MSET", "MSETNX":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return reply.Err(wrongArgsNumber)
+		}
+
+		// nothing is written unless every key may be
+		for _, key := range keys {
+			family := db.keyType(key)
+			switch {
+			case family != "" && command == "MSETNX":
+				return reply.Integer(0)
+			case family != "" && family != "string":
+				return reply.Err(wrongType)
+			}
+		}
+
+		ttl := args[len(args)-1]
+		for i := 1; i < len(args)-1; i += 2 {
+			if err := db.buckets[db.hashFunc(args[i])].Set(args[i], args[i+1], ttl); err != nil {
+				return reply.Err(err)
+			}
+		}
+		cache.writeToLog(index, args)
+		if command == "MSETNX" {
+			return reply.Integer(1)
+		}
+		return reply.OK
+	}
+
+	return reply.Err(commandNotFound)
+}
@@ -0,0 +1,134 @@
+package global_cache
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"redis_like_in_memory_db/internal/reply"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGlobalCache_MultiKey(t *testing.T) {
+	cache := NewCache(32, false)
+	setupKeyspace(cache)
+
+	{
+		t.Log("Given several keys it should set and get them at once")
+		result := cache.ProcessCommand([]string{"MSET", "a", "1", "b", "2", "1h"})
+		assert.EqualValues(t, "Success\n", result)
+		values := cache.Execute(&Session{}, []string{"MGET", "a", "missing", "b", "user:dict"})
+		assert.Equal(t, reply.Array([]reply.Reply{reply.Value("1"), reply.Nil, reply.Value("2"), reply.Nil}), values)
+		assert.Equal(t, "1, (nil), 2, (nil)", values.String())
+	}
+
+	{
+		t.Log("Given a key of another family MSET should write nothing")
+		result := cache.ProcessCommand([]string{"MSET", "c", "3", "user:list", "4", "1h"})
+		assert.EqualValues(t, errorReply(wrongType), result)
+		assert.EqualValues(t, "(nil)\n", cache.ProcessCommand([]string{"GET", "c"}))
+	}
+
+	{
+		t.Log("MSETNX should write all keys only when none of them exists")
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"MSETNX", "c", "3", "user:dict", "4", "1h"}))
+		assert.EqualValues(t, "(nil)\n", cache.ProcessCommand([]string{"GET", "c"}))
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"MSETNX", "c", "3", "d", "4", "1h"}))
+		assert.EqualValues(t, "3, 4\n", cache.ProcessCommand([]string{"MGET", "c", "d"}))
+	}
+
+	{
+		t.Log("Given a wrong number of arguments it should fail")
+		for _, args := range [][]string{{"MGET"}, {"MSET", "a", "1"}, {"MSET", "a", "1", "b", "1h"}, {"MSETNX", "a"}} {
+			assert.EqualValues(t, errorReply(wrongArgsNumber), cache.ProcessCommand(args), args)
+		}
+	}
+
+	{
+		t.Log("Given concurrent MSETNX of overlapping keys across shards only one should win")
+		won := make(chan int, 8)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				value := fmt.Sprint(i)
+				result := cache.ProcessCommand([]string{"MSETNX", "race:a", value, "race:b", value, "race:c", value, "1h"})
+				if result == "1\n" {
+					won <- i
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(won)
+
+		assert.Len(t, won, 1)
+		winner := fmt.Sprint(<-won)
+		assert.EqualValues(t, fmt.Sprintf("%s, %s, %s\n", winner, winner, winner), cache.ProcessCommand([]string{"MGET", "race:a", "race:b", "race:c"}))
+	}
+}
+
+func TestGlobalCache_DictFields(t *testing.T) {
+	cache := NewCache(32, false)
+	setupKeyspace(cache)
+
+	{
+		t.Log("Given fields set at once it should return some or all of them")
+		result := cache.ProcessCommand([]string{"HMSET", "user:dict", "city", "oslo", "age", "7", "1h"})
+		assert.EqualValues(t, "Success\n", result)
+		values := cache.Execute(&Session{}, []string{"HMGET", "user:dict", "name", "missing", "city"})
+		assert.Equal(t, reply.Array([]reply.Reply{reply.Value("elk"), reply.Nil, reply.Value("oslo")}), values)
+		all := cache.Execute(&Session{}, []string{"HGETALL", "user:dict"})
+		assert.Equal(t, []string{"age", "7", "city", "oslo", "name", "elk"}, all.Strings())
+		assert.Equal(t, []string{}, cache.Execute(&Session{}, []string{"HGETALL", "missing"}).Strings())
+	}
+
+	{
+		t.Log("Expired fields should be skipped by every read")
+		cache.ProcessCommand([]string{"HMSET", "user:dict", "token", "t", "otp", "o", "50ms"})
+		<-time.After(60 * time.Millisecond)
+		all := cache.Execute(&Session{}, []string{"HGETALL", "user:dict"})
+		assert.Equal(t, []string{"age", "7", "city", "oslo", "name", "elk"}, all.Strings())
+		assert.EqualValues(t, "(nil), (nil)\n", cache.ProcessCommand([]string{"HMGET", "user:dict", "token", "otp"}))
+		assert.EqualValues(t, "3\n", cache.ProcessCommand([]string{"DLEN", "user:dict"}))
+		assert.NotContains(t, cache.ProcessCommand([]string{"DKEYS", "user:dict"}), "token")
+	}
+
+	{
+		t.Log("Given a key of another family or wrong arguments it should fail")
+		assert.EqualValues(t, errorReply(wrongType), cache.ProcessCommand([]string{"HGETALL", "user:1"}))
+		assert.EqualValues(t, errorReply(wrongType), cache.ProcessCommand([]string{"HMSET", "user:list", "f", "v", "1h"}))
+		assert.EqualValues(t, errorReply(wrongArgsNumber), cache.ProcessCommand([]string{"HMGET", "user:dict"}))
+		assert.Contains(t, cache.ProcessCommand([]string{"HMSET", "user:dict", "f", "1h"}), "wrong arguments number")
+	}
+
+	{
+		t.Log("Scripts should get nil fields as false")
+		result := cache.ProcessCommand([]string{"EVAL", `return redis.call("HMGET", KEYS[1], "name", "missing")[2] == false`, "1", "user:dict"})
+		assert.EqualValues(t, "1\n", result)
+	}
+
+	{
+		t.Log("Given concurrent MSET MGET should see all keys of one of them")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				value := fmt.Sprint(i)
+				cache.ProcessCommand([]string{"MSET", "race:a", value, "race:b", value, "race:c", value, "1h"})
+			}
+		}()
+
+		for running := true; running; {
+			select {
+			case <-done:
+				running = false
+			default:
+			}
+			values := strings.Split(strings.TrimSpace(cache.ProcessCommand([]string{"MGET", "race:a", "race:b", "race:c"})), ", ")
+			assert.Len(t, values, 3)
+			assert.True(t, values[0] == values[1] && values[1] == values[2], values)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package global_cache
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"redis_like_in_memory_db/internal/glob"
+	"redis_like_in_memory_db/internal/reply"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Elements of a shard are visited in order of a 48 bit hash of their name and
+// the cursor holds the shard index in the upper 16 bits and the smallest hash
+// which has not been returned yet in the lower 48 bits. Elements present
+// during the whole iteration keep their hash and are therefore returned at
+// least once, whatever is added or removed meanwhile. The cursor alone is
+// enough to continue, elements ordered by a previous call are only kept for a
+// while to save ordering them again, see scanSnapshots.
+const (
+	scanHashBits     = 48
+	scanHashMask     = 1<<scanHashBits - 1
+	defaultScanCount = 10
+	// limits of scans continued from a snapshot per database
+	maxScanSnapshots       = 64
+	maxScanSnapshotEntries = 1 << 16
+	scanSnapshotTTL        = time.Minute
+)
+
+var invalidCursor = reply.ErrInvalidCursor
+
+type scanOptions struct {
+	match    string
+	count    int
+	typeName string
+}
+
+func scanHash(name string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return hash.Sum64() & scanHashMask
+}
+
+// parseScanOptions parses [MATCH pattern] [COUNT count] [TYPE type], TYPE is
+// accepted only when allowType is set
+func parseScanOptions(args []string, allowType bool) (scanOptions, error) {
+	options := scanOptions{match: "*", count: defaultScanCount}
+	if len(args)%2 != 0 {
+		return options, wrongArgsNumber
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		switch {
+		case args[i] == "MATCH":
+			options.match = args[i+1]
+		case args[i] == "COUNT":
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				return options, errors.New("COUNT should be a positive integer")
+			}
+			options.count = count
+		case args[i] == "TYPE" && allowType:
+			options.typeName = args[i+1]
+		default:
+			return options, fmt.Errorf("unknown scan option %s", args[i])
+		}
+	}
+
+	return options, nil
+}
+
+// scanEntry is an element of a shard or a collection in cursor order
+type scanEntry struct {
+	hash uint64
+	name string
+}
+
+// sortScanEntries orders elements by hash, only those starting from 'from'
+// are kept
+func sortScanEntries(entries []scanEntry, from uint64) []scanEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.hash >= from {
+			kept = append(kept, entry)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].hash < kept[j].hash
+	})
+
+	return kept
+}
+
+// scanPage splits at least count elements off the ordered ones unless they
+// run out, equal hashes are never split. It returns the page, the rest and
+// the cursor continuing after the page
+func scanPage(entries []scanEntry, count int) ([]scanEntry, []scanEntry, uint64) {
+	if count >= len(entries) {
+		return entries, nil, 0
+	}
+	end := count
+	for end < len(entries) && entries[end].hash == entries[end-1].hash {
+		end++
+	}
+	if end == len(entries) {
+		return entries, nil, 0
+	}
+
+	return entries[:end], entries[end:], entries[end-1].hash + 1
+}
+
+// scanSnapshotKey names a scan continued by the cursor, collection is empty
+// for SCAN since its cursor holds the shard
+type scanSnapshotKey struct {
+	collection string
+	cursor     uint64
+}
+
+// scanSnapshots keeps ordered elements which were not returned yet, so that
+// a scan continues from its cursor without walking the shard or collection
+// again. Elements added after a snapshot was taken are not returned, which
+// SCAN allows for elements not present during the whole iteration. Snapshots
+// of abandoned scans are dropped after ttl and the oldest ones are dropped
+// over the limits of count and elements. Without a snapshot the elements are
+// ordered again from the cursor
+type scanSnapshots struct {
+	mu        sync.Mutex
+	snapshots map[scanSnapshotKey]scanSnapshot
+	// insertion order of keys, the oldest snapshots are dropped first
+	order []scanSnapshotKey
+	// elements held by all snapshots
+	size       int
+	maxEntries int
+	ttl        time.Duration
+}
+
+type scanSnapshot struct {
+	entries []scanEntry
+	taken   time.Time
+}
+
+func newScanSnapshots() *scanSnapshots {
+	return &scanSnapshots{
+		snapshots:  make(map[scanSnapshotKey]scanSnapshot),
+		maxEntries: maxScanSnapshotEntries,
+		ttl:        scanSnapshotTTL,
+	}
+}
+
+// take returns the snapshot continued by the key and forgets it
+func (snapshots *scanSnapshots) take(key scanSnapshotKey) ([]scanEntry, bool) {
+	snapshots.mu.Lock()
+	defer snapshots.mu.Unlock()
+
+	snapshot, ok := snapshots.snapshots[key]
+	if !ok {
+		return nil, false
+	}
+	delete(snapshots.snapshots, key)
+	snapshots.size -= len(snapshot.entries)
+	if time.Since(snapshot.taken) > snapshots.ttl {
+		return nil, false
+	}
+
+	return snapshot.entries, true
+}
+
+// put keeps the snapshot unless it is larger than all snapshots may be
+func (snapshots *scanSnapshots) put(key scanSnapshotKey, entries []scanEntry) {
+	snapshots.mu.Lock()
+	defer snapshots.mu.Unlock()
+
+	if len(entries) > snapshots.maxEntries {
+		return
+	}
+	now := time.Now()
+	if previous, ok := snapshots.snapshots[key]; ok {
+		snapshots.size -= len(previous.entries)
+	} else {
+		snapshots.order = append(snapshots.order, key)
+	}
+	snapshots.snapshots[key] = scanSnapshot{entries: entries, taken: now}
+	snapshots.size += len(entries)
+
+	// taken snapshots leave their keys behind, they are dropped on the way
+	for len(snapshots.order) != 0 {
+		oldest := snapshots.order[0]
+		snapshot, ok := snapshots.snapshots[oldest]
+		if ok && len(snapshots.snapshots) <= maxScanSnapshots && snapshots.size <= snapshots.maxEntries &&
+			now.Sub(snapshot.taken) <= snapshots.ttl {
+			break
+		}
+		snapshots.order = snapshots.order[1:]
+		if ok {
+			delete(snapshots.snapshots, oldest)
+			snapshots.size -= len(snapshot.entries)
+		}
+	}
+	if len(snapshots.order) > 2*maxScanSnapshots {
+		order := make([]scanSnapshotKey, 0, len(snapshots.snapshots))
+		for _, key := range snapshots.order {
+			if _, ok := snapshots.snapshots[key]; ok {
+				order = append(order, key)
+			}
+		}
+		snapshots.order = order
+	}
+}
+
+// shardEntries returns keys of the shard starting from the hash in order
+func (db *database) shardEntries(shard int, from uint64) []scanEntry {
+	entries := make([]scanEntry, 0)
+	db.rangeShard(shard, func(key, _ string) {
+		entries = append(entries, scanEntry{hash: scanHash(key), name: key})
+	})
+
+	return sortScanEntries(entries, from)
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func (db *database) scanCommand(args []string) reply.Reply {
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return reply.Err(invalidCursor)
+	}
+	options, err := parseScanOptions(args[2:], true)
+	if err != nil {
+		return reply.Err(err)
+	}
+
+	shard := int(cursor >> scanHashBits)
+	from := cursor & scanHashMask
+	if shard >= len(db.buckets) {
+		return reply.Err(invalidCursor)
+	}
+
+	keys := make([]string, 0)
+	examined := 0
+	for examined < options.count {
+		entries, ok := db.scans.take(scanSnapshotKey{cursor: uint64(shard)<<scanHashBits | from})
+		if !ok {
+			entries = db.shardEntries(shard, from)
+		}
+		page, rest, next := scanPage(entries, options.count-examined)
+		examined += len(page)
+
+		for _, entry := range page {
+			// keys removed since the snapshot are skipped
+			typeName := db.keyType(entry.name)
+			if typeName == "" || options.typeName != "" && options.typeName != typeName {
+				continue
+			}
+			if glob.Match(options.match, entry.name) {
+				keys = append(keys, entry.name)
+			}
+		}
+
+		if len(rest) != 0 {
+			from = next
+			db.scans.put(scanSnapshotKey{cursor: uint64(shard)<<scanHashBits | from}, rest)
+			break
+		}
+
+		shard++
+		from = 0
+		if shard == len(db.buckets) {
+			break
+		}
+	}
+
+	next := uint64(shard)<<scanHashBits | from
+	if shard == len(db.buckets) {
+		next = 0
+	}
+
+	return reply.Values(append([]string{strconv.FormatUint(next, 10)}, keys...))
+}
+
+// DSCAN dictKey cursor [MATCH pattern] [COUNT count] returns field value pairs
+// ZSCAN listKey cursor [MATCH pattern] [COUNT count] returns values
+func (db *database) memberScanCommand(args []string) reply.Reply {
+	if len(args) < 3 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	key := args[1]
+	from, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil || from > scanHashMask {
+		return reply.Err(invalidCursor)
+	}
+	options, err := parseScanOptions(args[3:], false)
+	if err != nil {
+		return reply.Err(err)
+	}
+
+	shard := db.hashFunc(key)
+	collection := args[0] + " " + key
+	entries, ok := db.scans.take(scanSnapshotKey{collection: collection, cursor: from})
+	if !ok {
+		entries = make([]scanEntry, 0)
+		if args[0] == "DSCAN" {
+			db.dictBuckets[shard].RangeFields(key, func(field, _ string) {
+				entries = append(entries, scanEntry{hash: scanHash(field), name: field})
+			})
+		} else {
+			db.listBuckets[shard].RangeValues(key, func(value string) {
+				entries = append(entries, scanEntry{hash: scanHash(value), name: value})
+			})
+		}
+		entries = sortScanEntries(entries, from)
+	}
+	page, rest, next := scanPage(entries, options.count)
+	if len(rest) != 0 {
+		db.scans.put(scanSnapshotKey{collection: collection, cursor: next}, rest)
+	}
+
+	items := make([]string, 0)
+	for _, entry := range page {
+		if !glob.Match(options.match, entry.name) {
+			continue
+		}
+		if args[0] != "DSCAN" {
+			items = append(items, entry.name)
+			continue
+		}
+		// fields removed since the snapshot are skipped, the others are
+		// returned with their current values
+		if value, ok := db.dictBuckets[shard].Get(key, entry.name); ok {
+			items = append(items, entry.name, value)
+		}
+	}
+
+	return reply.Values(append([]string{strconv.FormatUint(next, 10)}, items...))
+}
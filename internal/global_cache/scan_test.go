@@ -0,0 +1,181 @@
+package global_cache
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scanAll iterates with the given command until the cursor returns to 0
+func scanAll(t *testing.T, cache *GlobalCache, command []string, options ...string) []string {
+	items := make([]string, 0)
+	cursor := "0"
+	for i := 0; ; i++ {
+		if i > 10000 {
+			t.Fatal("scan did not terminate")
+		}
+
+		args := append(append(append([]string{}, command...), cursor), options...)
+		reply := strings.Split(strings.TrimSuffix(cache.ProcessCommand(args), "\n"), ", ")
+		cursor = reply[0]
+		items = append(items, reply[1:]...)
+		if cursor == "0" {
+			return items
+		}
+	}
+}
+
+func TestGlobalCache_Scan(t *testing.T) {
+	cache := NewCache(8, false)
+	for i := 0; i < 100; i++ {
+		cache.ProcessCommand([]string{"SET", fmt.Sprintf("user:%d", i), "v", "1h"})
+	}
+	cache.ProcessCommand([]string{"ZSET", "list:1", "v", "1h"})
+	cache.ProcessCommand([]string{"DSET", "dict:1", "f", "v", "1h"})
+	cache.ProcessCommand([]string{"JSON.SET", "json:1", "$", "{}", "1h"})
+
+	{
+		t.Log("It should return every key of every family")
+		keys := scanAll(t, cache, []string{"SCAN"}, "COUNT", "7")
+		assert.Len(t, keys, 103)
+		assert.Contains(t, keys, "user:42")
+		assert.Contains(t, keys, "list:1")
+		assert.Contains(t, keys, "dict:1")
+		assert.Contains(t, keys, "json:1")
+	}
+
+	{
+		t.Log("It should filter by pattern and type")
+		keys := scanAll(t, cache, []string{"SCAN"}, "MATCH", "user:1?")
+		assert.Len(t, keys, 10)
+		keys = scanAll(t, cache, []string{"SCAN"}, "TYPE", "dict")
+		assert.EqualValues(t, []string{"dict:1"}, keys)
+	}
+
+	{
+		t.Log("Given modifications during the scan it should return keys present the whole time")
+		seen := make(map[string]bool)
+		cursor := "0"
+		for step := 0; ; step++ {
+			reply := strings.Split(strings.TrimSuffix(cache.ProcessCommand([]string{"SCAN", cursor, "COUNT", "5"}), "\n"), ", ")
+			for _, key := range reply[1:] {
+				seen[key] = true
+			}
+			// churn keys which are not present for the whole scan
+			cache.ProcessCommand([]string{"SET", fmt.Sprintf("temp:%d", step), "v", "1h"})
+			cache.ProcessCommand([]string{"REM", fmt.Sprintf("temp:%d", step-1)})
+
+			cursor = reply[0]
+			if cursor == "0" {
+				break
+			}
+		}
+
+		for i := 0; i < 100; i++ {
+			assert.True(t, seen[fmt.Sprintf("user:%d", i)])
+		}
+	}
+
+	{
+		t.Log("Given forgotten snapshots it should order the rest of the shard again")
+		db := cache.databases[0]
+		keys := make([]string, 0)
+		cursor := "0"
+		for {
+			reply := strings.Split(strings.TrimSuffix(cache.ProcessCommand([]string{"SCAN", cursor, "COUNT", "3"}), "\n"), ", ")
+			keys = append(keys, reply[1:]...)
+			if cursor = reply[0]; cursor == "0" {
+				break
+			}
+			// none is kept when the page ends a shard
+			assert.True(t, len(db.scans.snapshots) <= 1)
+			db.scans = newScanSnapshots()
+		}
+		// with the key left by the churn above
+		assert.Len(t, keys, 104)
+		assert.Len(t, db.scans.snapshots, 0)
+	}
+
+	{
+		reply := cache.ProcessCommand([]string{"SCAN", "not a cursor"})
+		assert.EqualValues(t, errorReply(invalidCursor), reply)
+	}
+}
+
+func TestGlobalCache_MemberScan(t *testing.T) {
+	cache := NewCache(8, false)
+	for i := 0; i < 30; i++ {
+		cache.ProcessCommand([]string{"DSET", "dict", fmt.Sprintf("field:%d", i), fmt.Sprintf("value:%d", i), "1h"})
+		cache.ProcessCommand([]string{"ZSET", "list", fmt.Sprintf("member:%d", i), "1h"})
+	}
+
+	{
+		t.Log("DSCAN should return field value pairs")
+		items := scanAll(t, cache, []string{"DSCAN", "dict"}, "COUNT", "4")
+		assert.Len(t, items, 60)
+		assert.Len(t, cache.databases[0].scans.snapshots, 0)
+		for i := 0; i < len(items); i += 2 {
+			assert.EqualValues(t, strings.Replace(items[i], "field", "value", 1), items[i+1])
+		}
+
+		items = scanAll(t, cache, []string{"DSCAN", "dict"}, "MATCH", "field:2*")
+		assert.Len(t, items, 22)
+	}
+
+	{
+		t.Log("ZSCAN should return list members")
+		items := scanAll(t, cache, []string{"ZSCAN", "list"}, "COUNT", "4")
+		assert.Len(t, items, 30)
+		assert.Contains(t, items, "member:17")
+	}
+}
+
+func TestGlobalCache_ScanSnapshotLimits(t *testing.T) {
+	cache := NewCache(8, false)
+	for i := 0; i < 30; i++ {
+		cache.ProcessCommand([]string{"DSET", "dict", fmt.Sprintf("field:%d", i), "value", "1h"})
+	}
+	firstPage := func(key string) string {
+		return strings.SplitN(cache.ProcessCommand([]string{"DSCAN", key, "0", "COUNT", "2"}), ", ", 2)[0]
+	}
+
+	{
+		t.Log("Snapshots of abandoned scans should be dropped after ttl and continued from the cursor")
+		db := cache.databases[0]
+		db.scans.ttl = 10 * time.Millisecond
+		cursor := firstPage("dict")
+		assert.Len(t, db.scans.snapshots, 1)
+		time.Sleep(20 * time.Millisecond)
+		items := scanAll(t, cache, []string{"DSCAN", "dict"}, "COUNT", "100")
+		assert.Len(t, items, 60)
+		reply := cache.ProcessCommand([]string{"DSCAN", "dict", cursor, "COUNT", "100"})
+		assert.True(t, strings.HasPrefix(reply, "0, "))
+		assert.Len(t, strings.Split(reply, ", "), 1+2*28)
+		assert.Len(t, db.scans.snapshots, 0)
+		assert.EqualValues(t, 0, db.scans.size)
+	}
+
+	{
+		t.Log("Snapshots should hold no more elements than the limit")
+		db := cache.databases[0]
+		db.scans.maxEntries = 40
+		for i := 0; i < 3; i++ {
+			cache.ProcessCommand([]string{"DSET", fmt.Sprintf("dict:%d", i), "a", "1", "1h"})
+			for j := 0; j < 20; j++ {
+				cache.ProcessCommand([]string{"DSET", fmt.Sprintf("dict:%d", i), fmt.Sprintf("f:%d", j), "1", "1h"})
+			}
+			firstPage(fmt.Sprintf("dict:%d", i))
+		}
+		assert.Len(t, db.scans.snapshots, 2)
+		assert.True(t, db.scans.size <= 40)
+	}
+
+	{
+		t.Log("FLUSHDB should drop the snapshots with the keys")
+		firstPage("dict:0")
+		cache.ProcessCommand([]string{"FLUSHDB"})
+		assert.Len(t, cache.databases[0].scans.snapshots, 0)
+	}
+}
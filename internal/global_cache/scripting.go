@@ -0,0 +1,554 @@
+package global_cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"redis_like_in_memory_db/internal/acl"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultScriptTimeLimit = 5 * time.Second
+
+var (
+	noScript          = reply.ErrNoScript
+	noRunningScript   = errors.New("no scripts in execution right now")
+	scriptUnkillable  = errors.New("script has already executed write commands and can not be killed")
+	scriptKilled      = reply.ErrScriptKilled
+	scriptTimedOut    = reply.ErrScriptTimedOut
+	wrongNumKeys      = errors.New("number of keys can't be greater than number of args")
+	invalidNumKeys    = errors.New("number of keys should be a positive integer")
+	notAllowedCommand = errors.New("this command is not allowed from scripts")
+	keyspaceCommand   = errors.New("commands without declared keys are not allowed from scripts")
+	readOnlyScript    = errors.New("write commands are not allowed from read-only scripts")
+)
+
+// scriptEngine keeps compiled scripts by their SHA1 and tracks the script
+// being executed, so that it can be killed from another connection
+type scriptEngine struct {
+	mu        sync.Mutex
+	scripts   map[string]*lua.FunctionProto
+	running   *runningScript
+	timeLimit time.Duration
+}
+
+type runningScript struct {
+	mu     sync.Mutex
+	keys   map[string]bool
+	cancel context.CancelFunc
+	wrote  bool
+	killed bool
+	// the time limit passed before the script wrote
+	timedOut bool
+	// stopped for shutdown, possibly after it wrote
+	aborted bool
+	// index of the database redis.call works with
+	db int
+	// permissions of the caller, nil when commands are not restricted
+	user *acl.User
+	// write commands are rejected, set for functions flagged no-writes
+	readOnly bool
+}
+
+func newScriptEngine() *scriptEngine {
+	engine := new(scriptEngine)
+	engine.scripts = make(map[string]*lua.FunctionProto)
+	engine.timeLimit = defaultScriptTimeLimit
+
+	return engine
+}
+
+func (engine *scriptEngine) load(body string) (string, *lua.FunctionProto, error) {
+	hash := sha1.Sum([]byte(body))
+	sha := hex.EncodeToString(hash[:])
+
+	engine.mu.Lock()
+	proto, ok := engine.scripts[sha]
+	engine.mu.Unlock()
+	if ok {
+		return sha, proto, nil
+	}
+
+	proto, err := compileScript(body, "@user_script")
+	if err != nil {
+		return "", nil, err
+	}
+
+	engine.mu.Lock()
+	engine.scripts[sha] = proto
+	engine.mu.Unlock()
+
+	return sha, proto, nil
+}
+
+func (engine *scriptEngine) lookup(sha string) (*lua.FunctionProto, bool) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	proto, ok := engine.scripts[strings.ToLower(sha)]
+	return proto, ok
+}
+
+func (engine *scriptEngine) setRunning(script *runningScript) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	engine.running = script
+}
+
+func (engine *scriptEngine) kill() error {
+	engine.mu.Lock()
+	script := engine.running
+	engine.mu.Unlock()
+
+	if script == nil {
+		return noRunningScript
+	}
+
+	return script.kill()
+}
+
+// abort stops the running script even if it has written, it reports whether
+// a script was running
+func (engine *scriptEngine) abort() bool {
+	engine.mu.Lock()
+	script := engine.running
+	engine.mu.Unlock()
+
+	if script == nil {
+		return false
+	}
+
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	script.aborted = true
+	script.cancel()
+	return true
+}
+
+func (script *runningScript) kill() error {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	if script.wrote {
+		return scriptUnkillable
+	}
+
+	script.killed = true
+	script.cancel()
+	return nil
+}
+
+// timeout aborts the script at the time limit unless it has written, a
+// script which has modified the dataset runs to the end to stay atomic
+func (script *runningScript) timeout() {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	if script.wrote {
+		return
+	}
+
+	script.timedOut = true
+	script.cancel()
+}
+
+// markWrite has to be called before every write so that a script is never
+// killed after it has modified the dataset
+func (script *runningScript) markWrite() bool {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	if script.killed || script.timedOut || script.aborted {
+		return false
+	}
+
+	script.wrote = true
+	return true
+}
+
+func (script *runningScript) isKilled() bool {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	return script.killed
+}
+
+func (script *runningScript) isTimedOut() bool {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	return script.timedOut
+}
+
+func (script *runningScript) isAborted() bool {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	return script.aborted
+}
+
+// EVAL script numkeys [key ...] [arg ...]
+// EVALSHA sha numkeys [key ...] [arg ...]
+func (cache *GlobalCache) evalCommand(index int, user *acl.User, args []string) reply.Reply {
+	if len(args) < 3 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	var proto *lua.FunctionProto
+	if args[0] == "EVALSHA" {
+		var ok bool
+		if proto, ok = cache.scripts.lookup(args[1]); !ok {
+			return reply.Err(noScript)
+		}
+	} else {
+		var err error
+		if _, proto, err = cache.scripts.load(args[1]); err != nil {
+			return reply.Err(err)
+		}
+	}
+
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || numKeys < 0 {
+		return reply.Err(invalidNumKeys)
+	}
+	if numKeys > len(args)-3 {
+		return reply.Err(wrongNumKeys)
+	}
+
+	keys := args[3 : 3+numKeys]
+	argv := args[3+numKeys:]
+
+	// scripts are executed exclusively, every other command waits
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.runScript(newRunningScript(index, user, keys), proto, keys, argv)
+}
+
+// SCRIPT LOAD|EXISTS|FLUSH|KILL
+func (cache *GlobalCache) scriptCommand(args []string) reply.Reply {
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	switch args[1] {
+	case "LOAD":
+		if len(args) != 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		sha, _, err := cache.scripts.load(args[2])
+		if err != nil {
+			return reply.Err(err)
+		}
+		return reply.Value(sha)
+
+	case "EXISTS":
+		result := make([]string, 0, len(args)-2)
+		for _, sha := range args[2:] {
+			if _, ok := cache.scripts.lookup(sha); ok {
+				result = append(result, "1")
+			} else {
+				result = append(result, "0")
+			}
+		}
+		return reply.Values(result)
+
+	case "FLUSH":
+		cache.scripts.mu.Lock()
+		cache.scripts.scripts = make(map[string]*lua.FunctionProto)
+		cache.scripts.mu.Unlock()
+
+	case "KILL":
+		if err := cache.scripts.kill(); err != nil {
+			return reply.Err(err)
+		}
+
+	default:
+		return reply.Err(commandNotFound)
+	}
+
+	return reply.OK
+}
+
+// runScript has to be called with cache.mu held exclusively
+func (cache *GlobalCache) runScript(script *runningScript, proto *lua.FunctionProto, keys, argv []string) reply.Reply {
+	return cache.runLua(script, func(state *lua.LState) (lua.LValue, error) {
+		state.SetGlobal("KEYS", stringsToTable(state, keys))
+		state.SetGlobal("ARGV", stringsToTable(state, argv))
+
+		state.Push(state.NewFunctionFromProto(proto))
+		if err := state.PCall(0, 1, nil); err != nil {
+			return nil, err
+		}
+
+		result := state.Get(-1)
+		state.Pop(1)
+		return result, nil
+	})
+}
+
+func newRunningScript(index int, user *acl.User, keys []string) *runningScript {
+	script := &runningScript{keys: make(map[string]bool), db: index, user: user}
+	for _, key := range keys {
+		script.keys[key] = true
+	}
+
+	return script
+}
+
+// runLua registers script as the running one and executes run on a fresh
+// interpreter. Scripts which have not written are aborted at the time limit
+func (cache *GlobalCache) runLua(script *runningScript, run func(*lua.LState) (lua.LValue, error)) reply.Reply {
+	// scripts which waited for the lock while the cache was closing are not started
+	if atomic.LoadInt32(&cache.closed) != 0 {
+		return reply.Err(shuttingDown)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	script.cancel = cancel
+	timer := time.AfterFunc(cache.scripts.timeLimit, script.timeout)
+	defer timer.Stop()
+
+	cache.scripts.setRunning(script)
+	defer cache.scripts.setRunning(nil)
+
+	state := cache.newScriptState(script)
+	defer state.Close()
+	state.SetContext(ctx)
+
+	result, err := run(state)
+	if err != nil {
+		switch {
+		case script.isKilled():
+			return reply.Err(scriptKilled)
+		case script.isTimedOut():
+			return reply.Err(scriptTimedOut)
+		case script.isAborted():
+			return reply.Err(shuttingDown)
+		}
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if table, ok := apiErr.Object.(*lua.LTable); ok {
+				return luaToReply(table)
+			}
+		}
+
+		return reply.Err(fmt.Errorf("error running script: %s", err))
+	}
+
+	return luaToReply(result)
+}
+
+// newLuaState returns an interpreter with a sandboxed subset of libraries
+func newLuaState() *lua.LState {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+	libs := []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+	// scripts must not touch the filesystem or load code at runtime
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		state.SetGlobal(name, lua.LNil)
+	}
+
+	return state
+}
+
+func (cache *GlobalCache) newScriptState(script *runningScript) *lua.LState {
+	state := newLuaState()
+
+	redis := state.NewTable()
+	state.SetField(redis, "call", state.NewFunction(func(state *lua.LState) int {
+		return cache.scriptCall(state, script, true)
+	}))
+	state.SetField(redis, "pcall", state.NewFunction(func(state *lua.LState) int {
+		return cache.scriptCall(state, script, false)
+	}))
+	state.SetField(redis, "sha1hex", state.NewFunction(func(state *lua.LState) int {
+		hash := sha1.Sum([]byte(state.CheckString(1)))
+		state.Push(lua.LString(hex.EncodeToString(hash[:])))
+		return 1
+	}))
+	state.SetField(redis, "error_reply", state.NewFunction(func(state *lua.LState) int {
+		reply := state.NewTable()
+		state.SetField(reply, "err", lua.LString(state.CheckString(1)))
+		state.Push(reply)
+		return 1
+	}))
+	state.SetField(redis, "status_reply", state.NewFunction(func(state *lua.LState) int {
+		reply := state.NewTable()
+		state.SetField(reply, "ok", lua.LString(state.CheckString(1)))
+		state.Push(reply)
+		return 1
+	}))
+	state.SetGlobal("redis", redis)
+
+	return state
+}
+
+// scriptCall implements redis.call and redis.pcall: the first one raises
+// errors, the second one returns them as {err = "CODE message"} tables
+func (cache *GlobalCache) scriptCall(state *lua.LState, script *runningScript, raise bool) int {
+	args := make([]string, 0, state.GetTop())
+	for i := 1; i <= state.GetTop(); i++ {
+		switch value := state.Get(i).(type) {
+		case lua.LString, lua.LNumber:
+			args = append(args, value.String())
+		default:
+			state.RaiseError("command arguments must be strings or integers")
+			return 0
+		}
+	}
+
+	var result reply.Reply
+	if err := cache.checkScriptCommand(script, args); err != nil {
+		result = reply.Err(err)
+	} else {
+		cache.feedMonitors(script.db, "lua", args)
+		result = cache.processCommand(script.db, args)
+	}
+
+	switch {
+	case result.IsError():
+		table := state.NewTable()
+		state.SetField(table, "err", lua.LString(result.Code+" "+result.Value))
+		if raise {
+			// the table becomes the reply of the script unless it is caught
+			state.Error(table, 1)
+			return 0
+		}
+		state.Push(table)
+	default:
+		state.Push(replyToLua(state, result))
+	}
+	return 1
+}
+
+// replyToLua converts a reply of a command called by a script following
+// conversion rules of redis: nil is false and arrays are tables
+func replyToLua(state *lua.LState, result reply.Reply) lua.LValue {
+	switch result.Kind {
+	case reply.NilKind:
+		return lua.LFalse
+	case reply.ArrayKind:
+		table := state.CreateTable(len(result.Items), 0)
+		for _, item := range result.Items {
+			table.Append(replyToLua(state, item))
+		}
+		return table
+	}
+
+	return lua.LString(result.Value)
+}
+
+func (cache *GlobalCache) checkScriptCommand(script *runningScript, args []string) error {
+	if len(args) == 0 {
+		return errors.New("please specify at least one argument for redis.call()")
+	}
+
+	info, ok := commandTable[args[0]]
+	if !ok {
+		return commandNotFound
+	}
+	if info.noScript {
+		return notAllowedCommand
+	}
+
+	keys := commandKeys(args)
+	if len(keys) == 0 {
+		return keyspaceCommand
+	}
+	for _, key := range keys {
+		if !script.keys[key] {
+			return fmt.Errorf("script tried accessing undeclared key: %s", key)
+		}
+	}
+
+	if script.user != nil {
+		if err := cache.checkUser(script.user, args); err != nil {
+			return err
+		}
+	}
+	if info.write && script.readOnly {
+		return readOnlyScript
+	}
+	if info.write && !script.markWrite() {
+		return scriptKilled
+	}
+
+	return nil
+}
+
+func compileScript(body, name string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(body), name)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling script: %s", strings.TrimSpace(err.Error()))
+	}
+
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling script: %s", err)
+	}
+
+	return proto, nil
+}
+
+func stringsToTable(state *lua.LState, values []string) *lua.LTable {
+	table := state.CreateTable(len(values), 0)
+	for _, value := range values {
+		table.Append(lua.LString(value))
+	}
+
+	return table
+}
+
+// luaToReply converts a script result into a reply, following conversion
+// rules of redis: numbers are truncated to integers, false and nil are nil
+func luaToReply(value lua.LValue) reply.Reply {
+	switch value := value.(type) {
+	case lua.LString:
+		return reply.Value(string(value))
+	case lua.LNumber:
+		return reply.Integer(int64(value))
+	case lua.LBool:
+		if value {
+			return reply.Integer(1)
+		}
+		return reply.Nil
+	case *lua.LTable:
+		if err, ok := value.RawGetString("err").(lua.LString); ok {
+			return reply.ParseError(string(err))
+		}
+		if status, ok := value.RawGetString("ok").(lua.LString); ok {
+			return reply.Status(string(status))
+		}
+
+		items := make([]reply.Reply, 0, value.Len())
+		for i := 1; i <= value.Len(); i++ {
+			items = append(items, luaToReply(value.RawGetInt(i)))
+		}
+		return reply.Array(items)
+	}
+
+	return reply.Nil
+}
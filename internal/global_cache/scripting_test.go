@@ -0,0 +1,177 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlobalCache_Eval(t *testing.T) {
+	cache := NewCache(32, false)
+
+	{
+		t.Log("Given a script it should call commands on declared keys")
+		script := `
+			local current = redis.call("GET", KEYS[1])
+			if current == ARGV[1] then
+				return redis.call("SET", KEYS[1], ARGV[2], "1h")
+			end
+			return current`
+		cache.ProcessCommand([]string{"SET", "lock", "owner-1", "1h"})
+
+		reply := cache.ProcessCommand([]string{"EVAL", script, "1", "lock", "owner-2", "owner-3"})
+		assert.EqualValues(t, "owner-1\n", reply)
+		reply = cache.ProcessCommand([]string{"EVAL", script, "1", "lock", "owner-1", "owner-3"})
+		assert.EqualValues(t, "Success\n", reply)
+		reply = cache.ProcessCommand([]string{"GET", "lock"})
+		assert.EqualValues(t, "owner-3\n", reply)
+	}
+
+	{
+		t.Log("It should convert lua values to replies")
+		reply := cache.ProcessCommand([]string{"EVAL", `return {1, "two", 3.7}`, "0"})
+		assert.EqualValues(t, "1, two, 3\n", reply)
+		reply = cache.ProcessCommand([]string{"EVAL", `return redis.error_reply("boom")`, "0"})
+		assert.EqualValues(t, "-ERR boom\n", reply)
+		reply = cache.ProcessCommand([]string{"EVAL", `return redis.call("GET", KEYS[1]) == false`, "1", "missing"})
+		assert.EqualValues(t, "1\n", reply)
+		reply = cache.ProcessCommand([]string{"EVAL", `return redis.call("GET", KEYS[1])`, "1", "missing"})
+		assert.EqualValues(t, "(nil)\n", reply)
+	}
+
+	{
+		t.Log("Arrays should be tables in scripts and the other way round")
+		cache.ProcessCommand([]string{"ZSET", "queue", "a", "1h"})
+		cache.ProcessCommand([]string{"ZSET", "queue", "b", "1h"})
+		reply := cache.ProcessCommand([]string{"EVAL", `return #redis.call("ZKEYS", KEYS[1])`, "1", "queue"})
+		assert.EqualValues(t, "2\n", reply)
+		result := cache.Execute(&Session{}, []string{"EVAL", `return redis.call("ZKEYS", KEYS[1])`, "1", "queue"})
+		assert.Equal(t, []string{"a", "b"}, result.Strings())
+	}
+
+	{
+		t.Log("Errors of commands should keep their codes")
+		reply := cache.ProcessCommand([]string{"EVAL", `return redis.call("ZGET", KEYS[1], "0")`, "1", "lock"})
+		assert.EqualValues(t, errorReply(wrongType), reply)
+		reply = cache.ProcessCommand([]string{"EVAL", `return redis.pcall("ZGET", KEYS[1], "0")["err"]`, "1", "lock"})
+		assert.EqualValues(t, "WRONGTYPE "+wrongType.Error()+"\n", reply)
+	}
+
+	{
+		t.Log("It should reject keys which were not declared")
+		reply := cache.ProcessCommand([]string{"EVAL", `return redis.call("GET", "other")`, "1", "lock"})
+		assert.Contains(t, reply, "undeclared key")
+		reply = cache.ProcessCommand([]string{"EVAL", `return redis.pcall("KEYS")["err"]`, "0"})
+		assert.EqualValues(t, "ERR "+keyspaceCommand.Error()+"\n", reply)
+	}
+
+	{
+		t.Log("It should return an error for wrong number of keys")
+		reply := cache.ProcessCommand([]string{"EVAL", `return 1`, "2", "a"})
+		assert.EqualValues(t, errorReply(wrongNumKeys), reply)
+	}
+}
+
+func TestGlobalCache_EvalSha(t *testing.T) {
+	cache := NewCache(32, false)
+
+	sha := strings.TrimSpace(cache.ProcessCommand([]string{"SCRIPT", "LOAD", `return ARGV[1]`}))
+	assert.Len(t, sha, 40)
+
+	reply := cache.ProcessCommand([]string{"EVALSHA", sha, "0", "hello"})
+	assert.EqualValues(t, "hello\n", reply)
+
+	reply = cache.ProcessCommand([]string{"SCRIPT", "EXISTS", sha, "ffff"})
+	assert.EqualValues(t, "1, 0\n", reply)
+
+	cache.ProcessCommand([]string{"SCRIPT", "FLUSH"})
+	reply = cache.ProcessCommand([]string{"EVALSHA", sha, "0", "hello"})
+	assert.EqualValues(t, errorReply(noScript), reply)
+}
+
+func TestGlobalCache_ScriptKill(t *testing.T) {
+	cache := NewCache(32, false)
+
+	{
+		t.Log("Given a read only script it should be killed")
+		done := make(chan string)
+		go func() {
+			done <- cache.ProcessCommand([]string{"EVAL", `while true do end`, "0"})
+		}()
+
+		assert.True(t, waitFor(func() bool {
+			return cache.ProcessCommand([]string{"SCRIPT", "KILL"}) == "Success\n"
+		}))
+		assert.EqualValues(t, errorReply(scriptKilled), <-done)
+	}
+
+	{
+		t.Log("Given a read only script it should be aborted at the time limit")
+		cache.scripts.timeLimit = 50 * time.Millisecond
+		reply := cache.ProcessCommand([]string{"EVAL", `while true do end`, "0"})
+		assert.EqualValues(t, errorReply(scriptTimedOut), reply)
+	}
+
+	{
+		t.Log("Given a script which has written it should be neither killed nor aborted at the time limit")
+		cache.scripts.timeLimit = 20 * time.Millisecond
+		started := time.Now()
+		reply := cache.ProcessCommand([]string{"EVAL", `
+			redis.call("SET", KEYS[1], "value", "1h")
+			local n = 0
+			for i = 1, 300000 do n = n + i end
+			return "done"`, "1", "key"})
+		assert.EqualValues(t, "done\n", reply)
+		assert.True(t, time.Since(started) > cache.scripts.timeLimit)
+		assert.EqualValues(t, "value\n", cache.ProcessCommand([]string{"GET", "key"}))
+	}
+
+	{
+		t.Log("Given a running script which has written SCRIPT KILL should be refused")
+		done := make(chan string)
+		go func() {
+			done <- cache.ProcessCommand([]string{"EVAL", `
+				redis.call("SET", KEYS[1], "value", "1h")
+				local n = 0
+				for i = 1, 3000000 do n = n + i end
+				return "done"`, "1", "key"})
+		}()
+
+		assert.True(t, waitFor(func() bool {
+			return cache.ProcessCommand([]string{"SCRIPT", "KILL"}) == errorReply(scriptUnkillable)
+		}))
+		assert.EqualValues(t, "done\n", <-done)
+	}
+
+	{
+		reply := cache.ProcessCommand([]string{"SCRIPT", "KILL"})
+		assert.EqualValues(t, errorReply(noRunningScript), reply)
+	}
+
+	{
+		t.Log("Given a running script which has written AbortScript should stop it")
+		done := make(chan string)
+		go func() {
+			done <- cache.ProcessCommand([]string{"EVAL", `
+				redis.call("SET", KEYS[1], "value", "1h")
+				while true do end`, "1", "key"})
+		}()
+
+		assert.True(t, waitFor(cache.AbortScript))
+		assert.EqualValues(t, errorReply(shuttingDown), <-done)
+		assert.False(t, cache.AbortScript())
+	}
+}
+
+// waitFor polls condition for up to a second
+func waitFor(condition func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if condition() {
+			return true
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+package global_cache
+
+import (
+	"errors"
+	"fmt"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var invalidSlowlogCount = errors.New("count should be a positive number or -1")
+
+const (
+	DefaultSlowlogThreshold = 10 * time.Millisecond
+	DefaultSlowlogMaxLen    = 128
+
+	// arguments of a slow command are truncated to keep the log small
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+)
+
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string
+	addr     string
+	name     string
+}
+
+func (entry slowlogEntry) String() string {
+	return fmt.Sprintf("id=%d time=%d duration=%d addr=%s name=%s args=%s", entry.id, entry.time.Unix(),
+		int64(entry.duration/time.Microsecond), entry.addr, entry.name, strings.Join(entry.args, " "))
+}
+
+// slowlog keeps the latest commands slower than the threshold, newest first
+type slowlog struct {
+	// nanoseconds read atomically so that fast commands skip the lock, negative
+	// disables the log, 0 logs every command
+	threshold int64
+
+	mu      sync.Mutex
+	maxLen  int
+	entries []slowlogEntry
+	nextID  int64
+}
+
+func newSlowlog(threshold time.Duration, maxLen int) *slowlog {
+	return &slowlog{threshold: int64(threshold), maxLen: maxLen, entries: make([]slowlogEntry, 0)}
+}
+
+// SetSlowlog sets the duration above which commands are logged and the number
+// of kept entries, a negative threshold disables the log
+func (cache *GlobalCache) SetSlowlog(threshold time.Duration, maxLen int) {
+	log := cache.slowlog
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	atomic.StoreInt64(&log.threshold, int64(threshold))
+	log.maxLen = maxLen
+	if len(log.entries) > maxLen {
+		log.entries = log.entries[:maxLen]
+	}
+}
+
+// Slowlog returns the slowlog threshold and length
+func (cache *GlobalCache) Slowlog() (time.Duration, int) {
+	cache.slowlog.mu.Lock()
+	defer cache.slowlog.mu.Unlock()
+
+	return time.Duration(atomic.LoadInt64(&cache.slowlog.threshold)), cache.slowlog.maxLen
+}
+
+func (log *slowlog) add(session *Session, args []string, duration time.Duration) {
+	threshold := atomic.LoadInt64(&log.threshold)
+	if threshold < 0 || int64(duration) < threshold {
+		return
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if log.maxLen <= 0 {
+		return
+	}
+
+	log.nextID++
+	entry := slowlogEntry{
+		id:       log.nextID,
+		time:     time.Now(),
+		duration: duration,
+		args:     truncateArgs(redactArgs(args)),
+		addr:     session.Addr,
+		name:     session.Name,
+	}
+	log.entries = append([]slowlogEntry{entry}, log.entries...)
+	if len(log.entries) > log.maxLen {
+		log.entries = log.entries[:log.maxLen]
+	}
+}
+
+// redactArgs hides passwords of AUTH and ACL SETUSER
+func redactArgs(args []string) []string {
+	switch {
+	case args[0] == "AUTH":
+		redacted := []string{args[0]}
+		for range args[1:] {
+			redacted = append(redacted, "(redacted)")
+		}
+		return redacted
+
+	case args[0] == "ACL" && len(args) > 1 && args[1] == "SETUSER":
+		redacted := make([]string, len(args))
+		for i, arg := range args {
+			if i > 2 && (strings.HasPrefix(arg, ">") || strings.HasPrefix(arg, "<")) {
+				arg = arg[:1] + "(redacted)"
+			}
+			redacted[i] = arg
+		}
+		return redacted
+	}
+
+	return args
+}
+
+func truncateArgs(args []string) []string {
+	truncated := make([]string, 0, len(args))
+	for i, arg := range args {
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			truncated = append(truncated, fmt.Sprintf("... (%d more arguments)", len(args)-i))
+			break
+		}
+		if len(arg) > slowlogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen)
+		}
+		truncated = append(truncated, arg)
+	}
+
+	return truncated
+}
+
+// SLOWLOG GET [count] | LEN | RESET
+func (cache *GlobalCache) slowlogCommand(args []string) reply.Reply {
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	log := cache.slowlog
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	switch args[1] {
+	case "GET":
+		count := 10
+		if len(args) > 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		if len(args) == 3 {
+			var err error
+			if count, err = strconv.Atoi(args[2]); err != nil || count < -1 {
+				return reply.Err(invalidSlowlogCount)
+			}
+		}
+		if count == -1 || count > len(log.entries) {
+			count = len(log.entries)
+		}
+
+		entries := make([]string, 0, count)
+		for _, entry := range log.entries[:count] {
+			entries = append(entries, entry.String())
+		}
+		return reply.Values(entries)
+
+	case "LEN":
+		return reply.Integer(int64(len(log.entries)))
+
+	case "RESET":
+		log.entries = make([]slowlogEntry, 0)
+		return reply.OK
+	}
+
+	return reply.Err(commandNotFound)
+}
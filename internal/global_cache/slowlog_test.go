@@ -0,0 +1,82 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlobalCache_Slowlog(t *testing.T) {
+	cache := NewCache(4, false)
+	cache.SetSlowlog(0, 3)
+	session := &Session{Addr: "127.0.0.1:5000", Name: "loader"}
+
+	cache.ProcessSessionCommand(session, []string{"SET", "user:1", strings.Repeat("a", 200), "1h"})
+	cache.ProcessSessionCommand(session, []string{"AUTH", "default", "secret"})
+
+	{
+		t.Log("Given a zero threshold it should log every command newest first")
+		entries := cache.Execute(&Session{}, []string{"SLOWLOG", "GET"}).Strings()
+		assert.Len(t, entries, 2)
+		assert.Contains(t, entries[0], "id=2 ")
+		assert.Contains(t, entries[0], "addr=127.0.0.1:5000 name=loader args=AUTH (redacted) (redacted)")
+		assert.Contains(t, entries[1], "args=SET user:1 "+strings.Repeat("a", 128)+"... (72 more bytes) 1h")
+	}
+
+	{
+		t.Log("It should keep only the configured number of entries")
+		cache.ProcessCommand([]string{"DBSIZE"})
+		cache.ProcessCommand([]string{"DBSIZE"})
+		assert.EqualValues(t, "3\n", cache.ProcessCommand([]string{"SLOWLOG", "LEN"}))
+		assert.Contains(t, cache.ProcessCommand([]string{"SLOWLOG", "GET", "1"}), "id=6 ")
+	}
+
+	{
+		cache.SetSlowlog(time.Hour, 3)
+		assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"SLOWLOG", "RESET"}))
+		cache.ProcessCommand([]string{"DBSIZE"})
+		assert.EqualValues(t, "0\n", cache.ProcessCommand([]string{"SLOWLOG", "LEN"}))
+	}
+}
+
+func TestTruncateArgs(t *testing.T) {
+	args := make([]string, 40)
+	for i := range args {
+		args[i] = "x"
+	}
+
+	truncated := truncateArgs(args)
+	assert.Len(t, truncated, slowlogMaxArgs)
+	assert.EqualValues(t, "... (9 more arguments)", truncated[slowlogMaxArgs-1])
+	assert.EqualValues(t, []string{"ACL", "SETUSER", "bob", ">(redacted)", "+@read"},
+		redactArgs([]string{"ACL", "SETUSER", "bob", ">secret", "+@read"}))
+}
+
+func TestGlobalCache_Latency(t *testing.T) {
+	cache := NewCache(4, false)
+
+	{
+		t.Log("Given a disabled monitor DOCTOR should tell how to enable it")
+		assert.Contains(t, cache.ProcessCommand([]string{"LATENCY", "DOCTOR"}), "disabled")
+	}
+
+	cache.SetLatencyThreshold(time.Nanosecond)
+	cache.ProcessCommand([]string{"FLUSHALL"})
+	cache.ProcessCommand([]string{"DBSIZE"})
+
+	{
+		t.Log("It should record events above the threshold")
+		events := cache.Execute(&Session{}, []string{"LATENCY", "LATEST"}).Strings()
+		assert.Len(t, events, 2)
+		assert.Contains(t, events[0], "event=command ")
+		assert.Contains(t, events[1], "event=flush ")
+		assert.Contains(t, cache.ProcessCommand([]string{"LATENCY", "HISTORY", "flush"}), "time=")
+		assert.Contains(t, cache.ProcessCommand([]string{"LATENCY", "DOCTOR"}), "flush: 1 spikes")
+	}
+
+	{
+		assert.EqualValues(t, "1\n", cache.ProcessCommand([]string{"LATENCY", "RESET", "flush", "missing"}))
+		assert.NotContains(t, cache.ProcessCommand([]string{"LATENCY", "LATEST"}), "flush")
+	}
+}
@@ -0,0 +1,216 @@
+package global_cache
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"redis_like_in_memory_db/internal/bucket"
+	"redis_like_in_memory_db/internal/dict_bucket"
+	"redis_like_in_memory_db/internal/json_bucket"
+	"redis_like_in_memory_db/internal/list_bucket"
+	"redis_like_in_memory_db/internal/reply"
+	"sync/atomic"
+	"time"
+)
+
+var noSnapshotFile = reply.ErrNoSnapshotFile
+
+// snapshotKey holds a key of any family, only the field of its family is set
+type snapshotKey struct {
+	Key    string
+	Family string
+	String bucket.Entry
+	List   []list_bucket.Entry
+	Dict   map[string]dict_bucket.Entry
+	JSON   json_bucket.Entry
+}
+
+type snapshot struct {
+	Created   time.Time
+	Databases [][]snapshotKey
+	// FUNCTION DUMP payload
+	Functions string
+}
+
+// SetSnapshotFile sets the file written by SAVE, an empty path disables it
+func (cache *GlobalCache) SetSnapshotFile(path string) {
+	cache.snapshotMu.Lock()
+	cache.snapshotFile = path
+	cache.snapshotMu.Unlock()
+}
+
+func (cache *GlobalCache) SnapshotFile() string {
+	cache.snapshotMu.Lock()
+	defer cache.snapshotMu.Unlock()
+
+	return cache.snapshotFile
+}
+
+// LastSave returns the time of the last successful snapshot
+func (cache *GlobalCache) LastSave() time.Time {
+	cache.snapshotMu.Lock()
+	defer cache.snapshotMu.Unlock()
+
+	return cache.lastSave
+}
+
+// Save writes the snapshot to the configured file
+func (cache *GlobalCache) Save() error {
+	path := cache.SnapshotFile()
+	if path == "" {
+		return noSnapshotFile
+	}
+
+	return cache.SaveSnapshot(path)
+}
+
+// SaveSnapshot writes every database and function library to the file. Other
+// commands wait meanwhile, so the snapshot is consistent. The file is
+// replaced only once the new one is written and synced, concurrent saves
+// wait for each other
+func (cache *GlobalCache) SaveSnapshot(path string) error {
+	defer cache.recordLatency(snapshotSaveEvent, time.Now())
+	cache.saveMu.Lock()
+	defer cache.saveMu.Unlock()
+
+	cache.mu.Lock()
+	data := snapshot{Created: time.Now(), Functions: cache.functions.dump()}
+	dirty := atomic.LoadInt64(&cache.stats.dirty)
+	for _, db := range cache.databases {
+		data.Databases = append(data.Databases, db.snapshotKeys())
+	}
+	cache.mu.Unlock()
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), "temp-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := gob.NewEncoder(temp).Encode(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+
+	// writes made while the file was written stay counted
+	atomic.AddInt64(&cache.stats.dirty, -dirty)
+	cache.snapshotMu.Lock()
+	cache.lastSave = data.Created
+	cache.snapshotMu.Unlock()
+	return nil
+}
+
+// LoadSnapshot replaces every database and function library with the ones
+// from the file, databases above the configured number are refused
+func (cache *GlobalCache) LoadSnapshot(path string) error {
+	defer cache.recordLatency(snapshotLoadEvent, time.Now())
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var data snapshot
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return fmt.Errorf("can not decode snapshot: %s", err)
+	}
+	if len(data.Databases) > len(cache.databases) {
+		return fmt.Errorf("snapshot has %d databases, only %d are configured", len(data.Databases), len(cache.databases))
+	}
+
+	databases := make([]*database, len(cache.databases))
+	for i := range databases {
+		databases[i] = newDatabase(cache.numBuckets)
+		if i >= len(data.Databases) {
+			continue
+		}
+		if err := databases[i].restoreSnapshotKeys(data.Databases[i]); err != nil {
+			return err
+		}
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if data.Functions != "" {
+		if err := cache.functions.restore(data.Functions, "FLUSH"); err != nil {
+			return fmt.Errorf("can not restore functions: %s", err)
+		}
+	}
+	cache.databases = databases
+
+	cache.snapshotMu.Lock()
+	cache.lastSave = data.Created
+	cache.snapshotMu.Unlock()
+	return nil
+}
+
+func (db *database) snapshotKeys() []snapshotKey {
+	keys := make([]snapshotKey, 0)
+	for shard := range db.buckets {
+		names := make([]string, 0)
+		db.rangeShard(shard, func(key, _ string) {
+			names = append(names, key)
+		})
+
+		for _, name := range names {
+			dumped, ok := db.dumpKey(name)
+			if !ok {
+				// expired meanwhile
+				continue
+			}
+
+			key := snapshotKey{Key: name, Family: dumped.family}
+			switch dumped.family {
+			case "string":
+				key.String = dumped.value.(bucket.Entry)
+			case "list":
+				key.List = dumped.value.([]list_bucket.Entry)
+			case "dict":
+				key.Dict = dumped.value.(map[string]dict_bucket.Entry)
+			case "json":
+				key.JSON = dumped.value.(json_bucket.Entry)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (db *database) restoreSnapshotKeys(keys []snapshotKey) error {
+	for _, key := range keys {
+		dumped := dumpedKey{family: key.Family}
+		switch key.Family {
+		case "string":
+			dumped.value = key.String
+		case "list":
+			dumped.value = key.List
+		case "dict":
+			dumped.value = key.Dict
+		case "json":
+			dumped.value = key.JSON
+		default:
+			return fmt.Errorf("unknown family %s of key %s in snapshot", key.Family, key.Key)
+		}
+
+		if err := db.restoreKey(key.Key, dumped); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
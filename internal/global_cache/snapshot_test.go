@@ -0,0 +1,79 @@
+package global_cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobalCache_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.snapshot")
+
+	cache := NewCacheWithDatabases(8, 4, false)
+	session := &Session{DB: 3}
+	cache.ProcessCommand([]string{"SET", "user:1", "moose", "1h"})
+	cache.ProcessCommand([]string{"ZSET", "colors", "red", "1h"})
+	cache.ProcessCommand([]string{"ZSET", "colors", "green", "1h"})
+	cache.ProcessSessionCommand(session, []string{"DSET", "user:dict", "name", "elk", "1h"})
+	cache.ProcessSessionCommand(session, []string{"JSON.SET", "doc", "$", `{"a":[1,2]}`, "1h"})
+
+	{
+		t.Log("Given no snapshot file SAVE should fail")
+		assert.EqualValues(t, errorReply(noSnapshotFile), cache.ProcessCommand([]string{"SAVE"}))
+		assert.True(t, cache.LastSave().IsZero())
+	}
+
+	cache.SetSnapshotFile(path)
+	cache.ProcessCommand([]string{"FUNCTION", "LOAD", counterLibrary})
+	assert.EqualValues(t, "Success\n", cache.ProcessCommand([]string{"SAVE"}))
+	assert.False(t, cache.LastSave().IsZero())
+
+	{
+		t.Log("It should restore every database, family and function")
+		restored := NewCacheWithDatabases(8, 4, false)
+		assert.NoError(t, restored.LoadSnapshot(path))
+
+		assert.EqualValues(t, "moose\n", restored.ProcessCommand([]string{"GET", "user:1"}))
+		assert.EqualValues(t, "green\n", restored.ProcessCommand([]string{"ZGET", "colors", "1"}))
+		assert.EqualValues(t, "elk\n", restored.ProcessSessionCommand(session, []string{"DGET", "user:dict", "name"}))
+		assert.EqualValues(t, `{"a":[1,2]}`+"\n", restored.ProcessSessionCommand(session, []string{"JSON.GET", "doc"}))
+		assert.EqualValues(t, "0\n", restored.ProcessCommand([]string{"EXISTS", "doc"}))
+		assert.Contains(t, restored.ProcessCommand([]string{"FUNCTION", "LIST"}), "counter")
+		assert.EqualValues(t, cache.LastSave().Unix(), restored.LastSave().Unix())
+	}
+
+	{
+		t.Log("Concurrent saves should leave a whole snapshot and no temporary files")
+		errs := make(chan error)
+		for i := 0; i < 4; i++ {
+			go func() { errs <- cache.Save() }()
+		}
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, <-errs)
+		}
+		restored := NewCacheWithDatabases(8, 4, false)
+		assert.NoError(t, restored.LoadSnapshot(path))
+		files, err := ioutil.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+	}
+
+	{
+		t.Log("Given fewer databases it should refuse the snapshot")
+		small := NewCacheWithDatabases(8, 2, false)
+		assert.Error(t, small.LoadSnapshot(path))
+	}
+}
+
+func TestGlobalCache_Close(t *testing.T) {
+	cache := NewCache(8, false)
+	cache.ProcessCommand([]string{"SET", "key", "value", "1h"})
+
+	assert.NoError(t, cache.Close())
+	assert.EqualValues(t, errorReply(shuttingDown), cache.ProcessCommand([]string{"GET", "key"}))
+}
@@ -0,0 +1,483 @@
+package json_bucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cast"
+	"math"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	wrongArgNum       = reply.ErrWrongArgsNumber
+	documentNotExists = reply.NewError(reply.CodeErr, "document does not exist")
+	pathNotFound      = reply.NewError(reply.CodeErr, "path does not exist")
+	ttlRequired       = reply.NewError(reply.CodeErr, "ttl is required to create a new document")
+	rootRequired      = reply.NewError(reply.CodeErr, "new document can only be created at the root path")
+	invalidJSON       = reply.NewError(reply.CodeErr, "value is not a valid json")
+	notANumber        = reply.NewError(reply.CodeErr, "value at path is not a number")
+	notAnArray        = reply.NewError(reply.CodeErr, "value at path is not an array")
+)
+
+type JSONBucket struct {
+	mu      sync.Mutex
+	entries map[string]*jsonNode
+	// entries removed on access after their ttl passed
+	expired uint64
+}
+
+// jsonNode keeps the document parsed so that partial updates do not require
+// rewriting the whole serialized value
+type jsonNode struct {
+	value interface{}
+	ttl   time.Time
+}
+
+// Entry is an exported copy of a document used to move keys around, the
+// value is serialized so that copies never share nested objects
+type Entry struct {
+	Value string
+	TTL   time.Time
+}
+
+func NewBucket() *JSONBucket {
+	bucket := new(JSONBucket)
+	bucket.entries = make(map[string]*jsonNode)
+	return bucket
+}
+
+// Set key path value [ttl]
+func (b *JSONBucket) Set(args ...string) error {
+	if len(args) != 3 && len(args) != 4 {
+		return wrongArgNum
+	}
+
+	key := args[0]
+	path, err := parsePath(args[1])
+	if err != nil {
+		return err
+	}
+
+	value, err := decode(args[2])
+	if err != nil {
+		return err
+	}
+
+	var expiration time.Duration
+	if len(args) == 4 {
+		expiration = cast.ToDuration(args[3])
+	}
+	return b.set(key, path, value, expiration, len(args) == 4)
+}
+
+func (b *JSONBucket) set(key string, path []pathSegment, value interface{}, expiration time.Duration, hasTTL bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node, ok := b.getWithoutLock(key)
+	if !ok {
+		if len(path) != 0 {
+			return rootRequired
+		}
+		if !hasTTL {
+			return ttlRequired
+		}
+
+		b.entries[key] = &jsonNode{value: value, ttl: time.Now().Add(expiration)}
+		return nil
+	}
+
+	newValue, err := update(node.value, path, func(interface{}, bool) (interface{}, error) {
+		return value, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	node.value = newValue
+	if hasTTL {
+		node.ttl = time.Now().Add(expiration)
+	}
+
+	return nil
+}
+
+// Get key [path] returns serialized value at path
+func (b *JSONBucket) Get(args ...string) (string, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", false
+	}
+
+	path := ""
+	if len(args) == 2 {
+		path = args[1]
+	}
+	segments, err := parsePath(path)
+	if err != nil {
+		return "", false
+	}
+
+	return b.get(args[0], segments)
+}
+
+func (b *JSONBucket) get(key string, path []pathSegment) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node, ok := b.getWithoutLock(key)
+	if !ok {
+		return "", false
+	}
+
+	value, ok := lookup(node.value, path)
+	if !ok {
+		return "", false
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+
+	return string(encoded), true
+}
+
+// Type key [path] returns json type name of the value at path
+func (b *JSONBucket) Type(args ...string) (string, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", false
+	}
+
+	path := ""
+	if len(args) == 2 {
+		path = args[1]
+	}
+	segments, err := parsePath(path)
+	if err != nil {
+		return "", false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node, ok := b.getWithoutLock(args[0])
+	if !ok {
+		return "", false
+	}
+
+	value, ok := lookup(node.value, segments)
+	if !ok {
+		return "", false
+	}
+
+	return typeName(value), true
+}
+
+// ArrAppend key path value [value ...] returns new length of the array
+func (b *JSONBucket) ArrAppend(args ...string) (int, error) {
+	if len(args) < 3 {
+		return 0, wrongArgNum
+	}
+
+	path, err := parsePath(args[1])
+	if err != nil {
+		return 0, err
+	}
+
+	values := make([]interface{}, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		value, err := decode(arg)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, value)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node, ok := b.getWithoutLock(args[0])
+	if !ok {
+		return 0, documentNotExists
+	}
+
+	length := 0
+	newValue, err := update(node.value, path, func(current interface{}, exists bool) (interface{}, error) {
+		array, ok := current.([]interface{})
+		if !exists || !ok {
+			return nil, notAnArray
+		}
+
+		array = append(array, values...)
+		length = len(array)
+		return array, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	node.value = newValue
+	return length, nil
+}
+
+// NumIncrBy key path number returns the incremented value
+func (b *JSONBucket) NumIncrBy(args ...string) (string, error) {
+	if len(args) != 3 {
+		return "", wrongArgNum
+	}
+
+	path, err := parsePath(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	increment := json.Number(args[2])
+	if value, err := increment.Float64(); err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", notANumber
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node, ok := b.getWithoutLock(args[0])
+	if !ok {
+		return "", documentNotExists
+	}
+
+	var result json.Number
+	newValue, err := update(node.value, path, func(current interface{}, exists bool) (interface{}, error) {
+		number, ok := current.(json.Number)
+		if !exists || !ok {
+			return nil, notANumber
+		}
+
+		result, ok = addNumbers(number, increment)
+		if !ok {
+			return nil, notANumber
+		}
+		return result, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	node.value = newValue
+	return result.String(), nil
+}
+
+// Remove key [path] deletes the whole document or the value at path
+func (b *JSONBucket) Remove(args ...string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgNum
+	}
+
+	path := ""
+	if len(args) == 2 {
+		path = args[1]
+	}
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	return b.remove(args[0], segments)
+}
+
+func (b *JSONBucket) remove(key string, path []pathSegment) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node, ok := b.getWithoutLock(key)
+	if !ok {
+		return documentNotExists
+	}
+
+	if len(path) == 0 {
+		delete(b.entries, key)
+		return nil
+	}
+
+	newValue, err := removePath(node.value, path)
+	if err != nil {
+		return err
+	}
+
+	node.value = newValue
+	return nil
+}
+
+// Range calls fn for every document key which has not expired. fn is called
+// with the bucket locked and must not call the bucket back
+func (b *JSONBucket) Range(fn func(key string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for key, node := range b.entries {
+		if node.ttl.Before(now) {
+			continue
+		}
+		fn(key)
+	}
+}
+
+// RandomKeys returns up to n keys which have not expired, they start at a
+// random position of the map iteration
+func (b *JSONBucket) RandomKeys(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, n)
+	for key, node := range b.entries {
+		if len(keys) == n {
+			break
+		}
+		if node.ttl.Before(now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// getWithoutLock returns a live document removing it if it has expired
+func (b *JSONBucket) getWithoutLock(key string) (*jsonNode, bool) {
+	node, ok := b.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if node.ttl.Before(time.Now()) {
+		atomic.AddUint64(&b.expired, 1)
+		delete(b.entries, key)
+		return nil, false
+	}
+
+	return node, true
+}
+
+// Expired returns the number of entries removed because their ttl has passed
+func (b *JSONBucket) Expired() uint64 {
+	return atomic.LoadUint64(&b.expired)
+}
+
+// Size returns the number of stored keys without walking them, expired keys
+// are counted until they are removed
+func (b *JSONBucket) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.entries)
+}
+
+// Exists reports whether the document is stored and has not expired
+func (b *JSONBucket) Exists(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.getWithoutLock(key)
+	return ok
+}
+
+// Delete removes the document and reports whether it has been stored
+func (b *JSONBucket) Delete(key string) bool {
+	return b.remove(key, nil) == nil
+}
+
+// Dump returns a serialized copy of the document
+func (b *JSONBucket) Dump(key string) (Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node, ok := b.getWithoutLock(key)
+	if !ok {
+		return Entry{}, false
+	}
+
+	encoded, err := json.Marshal(node.value)
+	if err != nil {
+		return Entry{}, false
+	}
+
+	return Entry{Value: string(encoded), TTL: node.ttl}, true
+}
+
+// Restore replaces the document with entry keeping its expiration time
+func (b *JSONBucket) Restore(key string, entry Entry) error {
+	value, err := decode(entry.Value)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[key] = &jsonNode{value: value, ttl: entry.TTL}
+	return nil
+}
+
+func decode(raw string) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, invalidJSON
+	}
+	// trailing garbage after the first value
+	if decoder.More() {
+		return nil, invalidJSON
+	}
+
+	return value, nil
+}
+
+// addNumbers keeps integer arithmetic when both operands are integers, ok is
+// false when the sum overflows, such a value could not be stored as JSON
+func addNumbers(a, b json.Number) (json.Number, bool) {
+	x, errX := a.Int64()
+	y, errY := b.Int64()
+	if errX == nil && errY == nil {
+		if y > 0 && x > math.MaxInt64-y || y < 0 && x < math.MinInt64-y {
+			return "", false
+		}
+		return json.Number(strconv.FormatInt(x+y, 10)), true
+	}
+
+	fx, _ := a.Float64()
+	fy, _ := b.Float64()
+	sum := fx + fy
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return "", false
+	}
+	return json.Number(strconv.FormatFloat(sum, 'f', -1, 64)), true
+}
+
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
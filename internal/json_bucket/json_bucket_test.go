@@ -0,0 +1,160 @@
+package json_bucket
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestJSONBucket_Set(t *testing.T) {
+	bucket := NewBucket()
+
+	{
+		t.Log("Given a new document it should require ttl and root path")
+		assert.Error(t, bucket.Set("doc", "$", `{"a":1}`))
+		assert.Error(t, bucket.Set("doc", "$.a", `1`, "10m"))
+		assert.Error(t, bucket.Set("doc", "$", `{"a":`, "10m"))
+		assert.NoError(t, bucket.Set("doc", "$", `{"a":1,"b":{"c":[1,2]}}`, "10m"))
+		assert.NotNil(t, bucket.entries["doc"])
+	}
+
+	{
+		t.Log("Given an existing document it should update value at path without ttl")
+		oldTTL := bucket.entries["doc"].ttl
+		assert.NoError(t, bucket.Set("doc", "$.b.c[1]", `"two"`))
+		assert.NoError(t, bucket.Set("doc", "$.b.d", `true`))
+		assert.EqualValues(t, oldTTL, bucket.entries["doc"].ttl)
+
+		value, ok := bucket.Get("doc", "$.b")
+		assert.True(t, ok)
+		assert.EqualValues(t, `{"c":[1,"two"],"d":true}`, value)
+	}
+
+	{
+		t.Log("Given a path with missing parent it should return an error")
+		assert.Error(t, bucket.Set("doc", "$.x.y", `1`))
+		assert.Error(t, bucket.Set("doc", "$.b.c[5]", `1`))
+	}
+}
+
+func TestJSONBucket_Get(t *testing.T) {
+	bucket := NewBucket()
+	assert.NoError(t, bucket.Set("doc", ".", `{"name":"moose","tags":["a","b"],"n":1.5}`, "10m"))
+
+	testCases := []struct {
+		path, expected string
+	}{
+		{"$", `{"n":1.5,"name":"moose","tags":["a","b"]}`},
+		{"$.name", `"moose"`},
+		{".tags[0]", `"a"`},
+		{"tags[-1]", `"b"`},
+		{"$['name']", `"moose"`},
+		{"$.n", `1.5`},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase // preserve variable copy within current closure
+		t.Run(testCase.path, func(t *testing.T) {
+			t.Parallel()
+			value, ok := bucket.Get("doc", testCase.path)
+			assert.True(t, ok)
+			assert.EqualValues(t, testCase.expected, value)
+		})
+	}
+
+	{
+		t.Log("It should not return value if document has expired")
+		bucket.Set("expiring", "$", `{}`, "50ms")
+		<-time.After(51 * time.Millisecond)
+		_, ok := bucket.Get("expiring")
+		assert.False(t, ok)
+	}
+}
+
+func TestJSONBucket_ArrAppend(t *testing.T) {
+	bucket := NewBucket()
+	assert.NoError(t, bucket.Set("doc", "$", `{"list":[1]}`, "10m"))
+
+	length, err := bucket.ArrAppend("doc", "$.list", `2`, `{"three":3}`)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, length)
+
+	value, _ := bucket.Get("doc", "$.list")
+	assert.EqualValues(t, `[1,2,{"three":3}]`, value)
+
+	_, err = bucket.ArrAppend("doc", "$.list[0]", `1`)
+	assert.Error(t, err)
+}
+
+func TestJSONBucket_NumIncrBy(t *testing.T) {
+	bucket := NewBucket()
+	assert.NoError(t, bucket.Set("doc", "$", `{"int":9007199254740993,"float":1.5,"str":"1"}`, "10m"))
+
+	{
+		t.Log("Given integers it should not lose precision")
+		value, err := bucket.NumIncrBy("doc", "$.int", "1")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "9007199254740994", value)
+	}
+
+	{
+		value, err := bucket.NumIncrBy("doc", "$.float", "0.25")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "1.75", value)
+	}
+
+	{
+		_, err := bucket.NumIncrBy("doc", "$.str", "1")
+		assert.Error(t, err)
+	}
+
+	{
+		t.Log("Given an overflowing result it should fail and keep the document")
+		assert.NoError(t, bucket.Set("doc", "$", `{"int":9223372036854775807,"float":1e308}`, "10m"))
+		_, err := bucket.NumIncrBy("doc", "$.int", "1")
+		assert.Equal(t, notANumber, err)
+		_, err = bucket.NumIncrBy("doc", "$.float", "1e308")
+		assert.Equal(t, notANumber, err)
+		_, err = bucket.NumIncrBy("doc", "$.float", "NaN")
+		assert.Equal(t, notANumber, err)
+		value, ok := bucket.Get("doc")
+		assert.True(t, ok)
+		assert.EqualValues(t, `{"float":1e308,"int":9223372036854775807}`, value)
+	}
+}
+
+func TestJSONBucket_Remove(t *testing.T) {
+	bucket := NewBucket()
+	assert.NoError(t, bucket.Set("doc", "$", `{"a":{"b":1,"c":2},"arr":[1,2,3]}`, "10m"))
+
+	assert.NoError(t, bucket.Remove("doc", "$.a.b"))
+	assert.NoError(t, bucket.Remove("doc", "$.arr[1]"))
+	assert.Error(t, bucket.Remove("doc", "$.missing"))
+
+	value, _ := bucket.Get("doc")
+	assert.EqualValues(t, `{"a":{"c":2},"arr":[1,3]}`, value)
+
+	assert.NoError(t, bucket.Remove("doc"))
+	assert.NotContains(t, bucket.entries, "doc")
+}
+
+func TestJSONBucket_Type(t *testing.T) {
+	bucket := NewBucket()
+	assert.NoError(t, bucket.Set("doc", "$", `{"o":{},"a":[],"s":"","i":1,"f":1.1,"b":false,"n":null}`, "10m"))
+
+	expected := map[string]string{
+		"$":   "object",
+		"$.o": "object",
+		"$.a": "array",
+		"$.s": "string",
+		"$.i": "integer",
+		"$.f": "number",
+		"$.b": "boolean",
+		"$.n": "null",
+	}
+	for path, typeName := range expected {
+		value, ok := bucket.Type("doc", path)
+		assert.True(t, ok)
+		assert.EqualValues(t, typeName, value, path)
+	}
+}
@@ -0,0 +1,221 @@
+package json_bucket
+
+import (
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+	"strings"
+)
+
+var invalidPath = reply.NewError(reply.CodeErr, "invalid path")
+
+// pathSegment is either an object member name or an array index
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath accepts JSONPath-like paths: "$", "$.a.b[0]", ".a['b c']", "a.b"
+// An empty path, "$" and "." address the document root.
+func parsePath(path string) ([]pathSegment, error) {
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(path, "$") {
+		path = path[1:]
+	}
+
+	segments := make([]pathSegment, 0)
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+			start := i
+			for i < len(path) && path[i] != '.' && path[i] != '[' {
+				i++
+			}
+			if start == i {
+				// "." alone addresses the root
+				if i == len(path) && len(segments) == 0 {
+					return segments, nil
+				}
+				return nil, invalidPath
+			}
+			segments = append(segments, pathSegment{key: path[start:i]})
+
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end == -1 {
+				return nil, invalidPath
+			}
+			inner := path[i+1 : i+end]
+			i += end + 1
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, invalidPath
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+
+		default:
+			// legacy path without leading dot, e.g. "a.b"
+			if len(segments) != 0 || i != 0 {
+				return nil, invalidPath
+			}
+			path = "." + path
+		}
+	}
+
+	return segments, nil
+}
+
+func lookup(node interface{}, path []pathSegment) (interface{}, bool) {
+	for _, segment := range path {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			if segment.isIndex {
+				return nil, false
+			}
+			child, ok := container[segment.key]
+			if !ok {
+				return nil, false
+			}
+			node = child
+
+		case []interface{}:
+			index, ok := arrayIndex(container, segment)
+			if !ok {
+				return nil, false
+			}
+			node = container[index]
+
+		default:
+			return nil, false
+		}
+	}
+
+	return node, true
+}
+
+// updateFunc receives the current value at path (exists is false when a new
+// object member is about to be created) and returns the value to store
+type updateFunc func(current interface{}, exists bool) (interface{}, error)
+
+// update rewrites the value at path in place and returns the new node, which
+// has to be stored by the caller since arrays may be reallocated
+func update(node interface{}, path []pathSegment, fn updateFunc) (interface{}, error) {
+	if len(path) == 0 {
+		return fn(node, true)
+	}
+
+	segment := path[0]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if segment.isIndex {
+			return nil, pathNotFound
+		}
+		child, ok := container[segment.key]
+		if !ok {
+			if len(path) > 1 {
+				return nil, pathNotFound
+			}
+			value, err := fn(nil, false)
+			if err != nil {
+				return nil, err
+			}
+			container[segment.key] = value
+
+			return container, nil
+		}
+
+		value, err := update(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[segment.key] = value
+
+		return container, nil
+
+	case []interface{}:
+		index, ok := arrayIndex(container, segment)
+		if !ok {
+			return nil, pathNotFound
+		}
+
+		value, err := update(container[index], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+
+		return container, nil
+	}
+
+	return nil, pathNotFound
+}
+
+// removePath deletes the value at path and returns the new node
+func removePath(node interface{}, path []pathSegment) (interface{}, error) {
+	segment := path[0]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if segment.isIndex {
+			return nil, pathNotFound
+		}
+		child, ok := container[segment.key]
+		if !ok {
+			return nil, pathNotFound
+		}
+		if len(path) == 1 {
+			delete(container, segment.key)
+			return container, nil
+		}
+
+		value, err := removePath(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		container[segment.key] = value
+
+		return container, nil
+
+	case []interface{}:
+		index, ok := arrayIndex(container, segment)
+		if !ok {
+			return nil, pathNotFound
+		}
+		if len(path) == 1 {
+			return append(container[:index], container[index+1:]...), nil
+		}
+
+		value, err := removePath(container[index], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+
+		return container, nil
+	}
+
+	return nil, pathNotFound
+}
+
+// arrayIndex resolves negative indexes counting from the end of the array
+func arrayIndex(array []interface{}, segment pathSegment) (int, bool) {
+	if !segment.isIndex {
+		return 0, false
+	}
+
+	index := segment.index
+	if index < 0 {
+		index += len(array)
+	}
+	if index < 0 || index >= len(array) {
+		return 0, false
+	}
+
+	return index, true
+}
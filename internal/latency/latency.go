@@ -0,0 +1,146 @@
+package latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxHistoryLen bounds samples kept for every event
+const maxHistoryLen = 160
+
+// Sample is the maximum latency of an event within a second
+type Sample struct {
+	Time     time.Time
+	Duration time.Duration
+}
+
+// Event describes latency spikes of a single internal operation
+type Event struct {
+	Name    string
+	Latest  Sample
+	Max     time.Duration
+	Count   int
+	Total   time.Duration
+	History []Sample
+}
+
+// Monitor records operations slower than its threshold. Record does nothing
+// on a nil Monitor, so reporting components may keep it unset
+type Monitor struct {
+	mu sync.Mutex
+	// 0 disables the monitor
+	threshold time.Duration
+	events    map[string]*Event
+}
+
+func NewMonitor(threshold time.Duration) *Monitor {
+	return &Monitor{threshold: threshold, events: make(map[string]*Event)}
+}
+
+func (m *Monitor) SetThreshold(threshold time.Duration) {
+	m.mu.Lock()
+	m.threshold = threshold
+	m.mu.Unlock()
+}
+
+func (m *Monitor) Threshold() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.threshold
+}
+
+// Record adds the latency of the event if it reaches the threshold, samples
+// of the same second are merged keeping the maximum
+func (m *Monitor) Record(name string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.threshold <= 0 || duration < m.threshold {
+		return
+	}
+
+	event, ok := m.events[name]
+	if !ok {
+		event = &Event{Name: name}
+		m.events[name] = event
+	}
+
+	now := time.Now().Truncate(time.Second)
+	event.Latest = Sample{Time: now, Duration: duration}
+	event.Count++
+	event.Total += duration
+	if duration > event.Max {
+		event.Max = duration
+	}
+
+	if last := len(event.History) - 1; last >= 0 && event.History[last].Time.Equal(now) {
+		if duration > event.History[last].Duration {
+			event.History[last].Duration = duration
+		}
+		return
+	}
+	event.History = append(event.History, event.Latest)
+	if len(event.History) > maxHistoryLen {
+		event.History = event.History[1:]
+	}
+}
+
+// Events returns copies of recorded events sorted by name
+func (m *Monitor) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make([]Event, 0, len(m.events))
+	for _, event := range m.events {
+		copied := *event
+		copied.History = append([]Sample{}, event.History...)
+		events = append(events, copied)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+
+	return events
+}
+
+// Event returns a copy of the event
+func (m *Monitor) Event(name string) (Event, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, ok := m.events[name]
+	if !ok {
+		return Event{}, false
+	}
+	copied := *event
+	copied.History = append([]Sample{}, event.History...)
+	return copied, true
+}
+
+// Reset removes the events or all of them when no name is given and returns
+// the number of removed events
+func (m *Monitor) Reset(names ...string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(names) == 0 {
+		count := len(m.events)
+		m.events = make(map[string]*Event)
+		return count
+	}
+
+	count := 0
+	for _, name := range names {
+		if _, ok := m.events[name]; ok {
+			delete(m.events, name)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,38 @@
+package latency
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMonitor_Record(t *testing.T) {
+	monitor := NewMonitor(10 * time.Millisecond)
+	monitor.Record("tx-log-write", time.Millisecond)
+
+	{
+		t.Log("Given a latency below the threshold it should not record it")
+		assert.Empty(t, monitor.Events())
+	}
+
+	{
+		t.Log("Given several spikes within a second it should keep the maximum in history")
+		monitor.Record("tx-log-write", 20*time.Millisecond)
+		monitor.Record("tx-log-write", 50*time.Millisecond)
+		monitor.Record("tx-log-write", 30*time.Millisecond)
+
+		event, ok := monitor.Event("tx-log-write")
+		assert.True(t, ok)
+		assert.EqualValues(t, 3, event.Count)
+		assert.EqualValues(t, 50*time.Millisecond, event.Max)
+		assert.EqualValues(t, 30*time.Millisecond, event.Latest.Duration)
+		assert.True(t, len(event.History) <= 2)
+		assert.EqualValues(t, 100*time.Millisecond, event.Total)
+	}
+
+	{
+		t.Log("A nil monitor should ignore records")
+		var monitor *Monitor
+		monitor.Record("tx-log-write", time.Second)
+	}
+}
@@ -1,16 +1,18 @@
 package list_bucket
 
 import (
-	"errors"
 	"github.com/spf13/cast"
-	"strings"
+	"redis_like_in_memory_db/internal/reply"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type ListBucket struct {
 	mu      sync.Mutex
 	entries map[string]*listNode
+	// entries removed on access after their ttl passed
+	expired uint64
 }
 
 type listNode struct {
@@ -19,7 +21,17 @@ type listNode struct {
 	ttl        time.Time
 }
 
-var wrongArgsNum = errors.New("wrong number of arguments")
+var (
+	wrongArgsNum  = reply.ErrWrongArgsNumber
+	listNotExists = reply.ErrListNotExists
+	outOfRange    = reply.ErrIndexOutOfRange
+)
+
+// Entry is an exported copy of a list value used to move keys around
+type Entry struct {
+	Value string
+	TTL   time.Time
+}
 
 func NewBucket() *ListBucket {
 	bucket := new(ListBucket)
@@ -106,6 +118,7 @@ func (b *ListBucket) get(key string, indx int) (string, bool) {
 	}
 	// key has only one list at all and it has expired
 	if indx == 0 && firstList.ttl.Before(time.Now()) {
+		atomic.AddUint64(&b.expired, 1)
 		b.removeWithoutLock(key, firstList.value)
 		return "", false
 	}
@@ -123,6 +136,7 @@ func (b *ListBucket) get(key string, indx int) (string, bool) {
 	}
 
 	if listNeeded.ttl.Before(time.Now()) {
+		atomic.AddUint64(&b.expired, 1)
 		b.removeWithoutLock(key, listNeeded.value)
 		return "", false
 	}
@@ -130,6 +144,20 @@ func (b *ListBucket) get(key string, indx int) (string, bool) {
 	return listNeeded.value, true
 }
 
+// Expired returns the number of entries removed because their ttl has passed
+func (b *ListBucket) Expired() uint64 {
+	return atomic.LoadUint64(&b.expired)
+}
+
+// Size returns the number of stored keys without walking them, expired keys
+// are counted until they are removed
+func (b *ListBucket) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.entries)
+}
+
 //  len for interface impl
 func (b *ListBucket) Len(args ...string) int {
 	if len(args) != 1 {
@@ -157,19 +185,19 @@ func (b *ListBucket) len(key string) int {
 	return count
 }
 
-func (b *ListBucket) Keys(args ...string) string {
+func (b *ListBucket) Keys(args ...string) []string {
 	if len(args) != 1 {
-		return ""
+		return nil
 	}
 
 	key := args[0]
 	return b.keys(key)
 }
 
-func (b *ListBucket) keys(key string) string {
+func (b *ListBucket) keys(key string) []string {
 	listLen := b.Len(key)
 	if listLen == -1 {
-		return ""
+		return []string{}
 	}
 
 	b.mu.Lock()
@@ -181,13 +209,57 @@ func (b *ListBucket) keys(key string) string {
 	values = append(values, firstList.value)
 	for list := firstList.next; list != nil; list = list.next {
 		if list.ttl.Before(time.Now()) {
+			atomic.AddUint64(&b.expired, 1)
 			b.removeWithoutLock(key, list.value)
 			continue
 		}
 		values = append(values, list.value)
 	}
 
-	return strings.Join(values, ", ")
+	return values
+}
+
+// Range calls fn for every list key. fn is called with the bucket locked and
+// must not call the bucket back
+func (b *ListBucket) Range(fn func(key string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key := range b.entries {
+		fn(key)
+	}
+}
+
+// RandomKeys returns up to n keys, they start at a random position of the
+// map iteration
+func (b *ListBucket) RandomKeys(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0, n)
+	for key := range b.entries {
+		if len(keys) == n {
+			break
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// RangeValues calls fn for every value of the list which has not expired.
+// fn is called with the bucket locked and must not call the bucket back
+func (b *ListBucket) RangeValues(key string, fn func(value string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for list := b.entries[key]; list != nil; list = list.next {
+		if list.ttl.Before(now) {
+			continue
+		}
+		fn(list.value)
+	}
 }
 
 func (b *ListBucket) Remove(args ...string) error {
@@ -203,11 +275,11 @@ func (b *ListBucket) Remove(args ...string) error {
 func (b *ListBucket) remove(key string, indx int) error {
 	listLen := b.Len(key)
 	if listLen == -1 {
-		return errors.New("key does not exits or has been deleted already")
+		return listNotExists
 	}
 
 	if indx >= listLen {
-		return errors.New("index out of range")
+		return outOfRange
 	}
 
 	b.mu.Lock()
@@ -261,3 +333,82 @@ func (b *ListBucket) removeWithoutLock(key, value string) {
 		list.next.prev = list.prev
 	}
 }
+
+// Exists reports whether the list has a value which has not expired, a list
+// with expired values only is removed
+func (b *ListBucket) Exists(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	firstList, ok := b.entries[key]
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	count := uint64(0)
+	for list := firstList; list != nil; list = list.next {
+		if !list.ttl.Before(now) {
+			return true
+		}
+		count++
+	}
+	atomic.AddUint64(&b.expired, count)
+	delete(b.entries, key)
+
+	return false
+}
+
+// Delete removes the whole list and reports whether it has been stored
+func (b *ListBucket) Delete(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.entries[key]; !ok {
+		return false
+	}
+
+	delete(b.entries, key)
+	return true
+}
+
+// Dump returns a copy of the list values which have not expired
+func (b *ListBucket) Dump(key string) ([]Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	firstList, ok := b.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entries := make([]Entry, 0)
+	now := time.Now()
+	for list := firstList; list != nil; list = list.next {
+		if list.ttl.Before(now) {
+			continue
+		}
+		entries = append(entries, Entry{Value: list.value, TTL: list.ttl})
+	}
+
+	return entries, len(entries) != 0
+}
+
+// Restore replaces the list by key with entries keeping their expiration time
+func (b *ListBucket) Restore(key string, entries []Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.entries, key)
+
+	var last *listNode
+	for _, entry := range entries {
+		node := &listNode{value: entry.Value, ttl: entry.TTL, prev: last}
+		if last == nil {
+			b.entries[key] = node
+		} else {
+			last.next = node
+		}
+		last = node
+	}
+}
@@ -3,7 +3,6 @@ package list_bucket
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
-	"strings"
 	"testing"
 	"time"
 )
@@ -52,7 +51,7 @@ func TestListBucket_Get(t *testing.T) {
 		values := bucket.Keys("test")
 		for index, testCase := range testCases {
 			testCase := testCase // preserve variable copy within current closure
-			index := string(index)
+			index := string(rune(index))
 			t.Run(testCase.value, func(t *testing.T) {
 				t.Parallel()
 				value, ok := bucket.Get(testCase.key, index)
@@ -78,7 +77,7 @@ func TestListBucket_List(t *testing.T) {
 
 	{
 		t.Log("It should return all values")
-		values := strings.Split(bucket.Keys("test"), ", ")
+		values := bucket.Keys("test")
 		for _, testCase := range testCases {
 			assert.Contains(t, values, testCase.value)
 		}
@@ -117,7 +116,7 @@ func TestListBucket_Remove(t *testing.T) {
 
 	for index, testCase := range testCases {
 		testCase := testCase
-		index := string(index)
+		index := string(rune(index))
 		t.Run(testCase.value, func(t *testing.T) {
 			t.Parallel()
 
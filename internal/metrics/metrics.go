@@ -0,0 +1,267 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are upper bounds of latency histograms in seconds
+var LatencyBuckets = []float64{.00001, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .05, .1, .5, 1}
+
+// ExponentialBuckets returns count bounds, the first one is start and every
+// next one is factor times the previous
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+
+	return bounds
+}
+
+// Histogram counts durations in buckets. Observe only does atomic additions,
+// so it is cheap enough for every command
+type Histogram struct {
+	bounds []float64
+	// counts[i] is the number of observations in (bounds[i-1], bounds[i]],
+	// the last one holds observations above every bound
+	counts []uint64
+	count  uint64
+	// nanoseconds
+	sum uint64
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(duration time.Duration) {
+	seconds := duration.Seconds()
+	i := sort.SearchFloat64s(h.bounds, seconds)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, uint64(duration))
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum returns the total of observed durations
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(atomic.LoadUint64(&h.sum))
+}
+
+// Merge adds observations of other, which has to have the same bounds
+func (h *Histogram) Merge(other *Histogram) {
+	for i := range other.counts {
+		atomic.AddUint64(&h.counts[i], atomic.LoadUint64(&other.counts[i]))
+	}
+	atomic.AddUint64(&h.count, atomic.LoadUint64(&other.count))
+	atomic.AddUint64(&h.sum, atomic.LoadUint64(&other.sum))
+}
+
+// Quantile estimates the duration not exceeded by the share q of observations,
+// it is interpolated within the bucket holding it. Observations above every
+// bound are given the highest bound
+func (h *Histogram) Quantile(q float64) time.Duration {
+	count := h.Count()
+	if count == 0 || len(h.bounds) == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	cumulative := uint64(0)
+	for i, bound := range h.bounds {
+		n := atomic.LoadUint64(&h.counts[i])
+		if cumulative+n >= rank {
+			lower := 0.0
+			if i > 0 {
+				lower = h.bounds[i-1]
+			}
+			seconds := lower + (bound-lower)*float64(rank-cumulative)/float64(n)
+			return time.Duration(math.Round(seconds * float64(time.Second)))
+		}
+		cumulative += n
+	}
+
+	return time.Duration(math.Round(h.bounds[len(h.bounds)-1] * float64(time.Second)))
+}
+
+// Label formats a label pair escaping the value
+func Label(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return fmt.Sprintf(`%s="%s"`, name, value)
+}
+
+// Sample is a single value of a metric, labels are formatted with Label and
+// joined with commas
+type Sample struct {
+	Labels string
+	Value  float64
+}
+
+// Writer writes metrics in the Prometheus text format, the first error is
+// kept and returned by Err
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+func (w *Writer) header(name, help, kind string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (w *Writer) sample(name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	w.printf("%s %s\n", name, formatFloat(value))
+}
+
+func (w *Writer) Counter(name, help string, samples ...Sample) {
+	w.header(name, help, "counter")
+	for _, sample := range samples {
+		w.sample(name, sample.Labels, sample.Value)
+	}
+}
+
+func (w *Writer) Gauge(name, help string, samples ...Sample) {
+	w.header(name, help, "gauge")
+	for _, sample := range samples {
+		w.sample(name, sample.Labels, sample.Value)
+	}
+}
+
+// Histograms writes histograms keyed by values of the label, an empty label
+// name writes a single histogram without labels. Histograms without
+// observations are skipped
+func (w *Writer) Histograms(name, help, label string, histograms map[string]*Histogram) {
+	values := make([]string, 0, len(histograms))
+	for value, histogram := range histograms {
+		if histogram.Count() != 0 {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+
+	w.header(name, help, "histogram")
+	for _, value := range values {
+		labels := ""
+		if label != "" {
+			labels = Label(label, value)
+		}
+		w.histogram(name, labels, histograms[value])
+	}
+}
+
+func (w *Writer) histogram(name, labels string, h *Histogram) {
+	prefix := ""
+	if labels != "" {
+		prefix = labels + ","
+	}
+
+	cumulative := uint64(0)
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		w.sample(name+"_bucket", prefix+Label("le", formatFloat(bound)), float64(cumulative))
+	}
+	cumulative += atomic.LoadUint64(&h.counts[len(h.bounds)])
+	w.sample(name+"_bucket", prefix+Label("le", "+Inf"), float64(cumulative))
+	w.sample(name+"_sum", labels, time.Duration(atomic.LoadUint64(&h.sum)).Seconds())
+	// the count matches the +Inf bucket even if observations arrive meanwhile
+	w.sample(name+"_count", labels, float64(cumulative))
+}
+
+// Err flushes the output and returns the first error
+func (w *Writer) Err() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return fmt.Sprintf("%g", value)
+}
+
+// Registry serves metrics of every registered collector, collectors run on
+// each scrape in order of registration
+type Registry struct {
+	mu         sync.Mutex
+	collectors []func(*Writer)
+}
+
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+func (r *Registry) Register(collector func(*Writer)) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, collector)
+	r.mu.Unlock()
+}
+
+// Write runs every collector writing their metrics to w
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]func(*Writer){}, r.collectors...)
+	r.mu.Unlock()
+
+	writer := NewWriter(w)
+	for _, collector := range collectors {
+		collector(writer)
+	}
+	return writer.Err()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// CollectRuntime writes Go runtime metrics. Reading memory statistics stops
+// the world for a moment, so it is done once per scrape
+func CollectRuntime(w *Writer) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	w.Gauge("go_goroutines", "Number of goroutines.", Sample{Value: float64(runtime.NumGoroutine())})
+	w.Gauge("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", Sample{Value: float64(memStats.HeapAlloc)})
+	w.Gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", Sample{Value: float64(memStats.HeapInuse)})
+	w.Gauge("go_memstats_sys_bytes", "Bytes obtained from the OS.", Sample{Value: float64(memStats.Sys)})
+	w.Counter("go_gc_cycles_total", "Completed GC cycles.", Sample{Value: float64(memStats.NumGC)})
+	w.Counter("go_gc_pause_seconds_total", "Total time the world was stopped by GC.",
+		Sample{Value: time.Duration(memStats.PauseTotalNs).Seconds()})
+}
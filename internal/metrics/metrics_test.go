@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	histograms := map[string]*Histogram{
+		"GET":  NewHistogram([]float64{.001, .01}),
+		"SET":  NewHistogram([]float64{.001, .01}),
+		"DSET": NewHistogram([]float64{.001, .01}),
+	}
+	histograms["GET"].Observe(500 * time.Microsecond)
+	histograms["GET"].Observe(5 * time.Millisecond)
+	histograms["GET"].Observe(time.Second)
+	histograms["SET"].Observe(time.Millisecond)
+
+	registry := NewRegistry()
+	registry.Register(func(w *Writer) {
+		w.Counter("hits_total", "Hits.", Sample{Value: 3})
+		w.Gauge("keys", "Keys.", Sample{Labels: Label("family", `say "hi"`), Value: 1.5})
+		w.Histograms("latency_seconds", "Latency.", "command", histograms)
+	})
+
+	output := &bytes.Buffer{}
+	assert.NoError(t, registry.Write(output))
+	assert.EqualValues(t, `# HELP hits_total Hits.
+# TYPE hits_total counter
+hits_total 3
+# HELP keys Keys.
+# TYPE keys gauge
+keys{family="say \"hi\""} 1.5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{command="GET",le="0.001"} 1
+latency_seconds_bucket{command="GET",le="0.01"} 2
+latency_seconds_bucket{command="GET",le="+Inf"} 3
+latency_seconds_sum{command="GET"} 1.0055
+latency_seconds_count{command="GET"} 3
+latency_seconds_bucket{command="SET",le="0.001"} 1
+latency_seconds_bucket{command="SET",le="0.01"} 1
+latency_seconds_bucket{command="SET",le="+Inf"} 1
+latency_seconds_sum{command="SET"} 0.001
+latency_seconds_count{command="SET"} 1
+`, output.String())
+}
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := NewHistogram([]float64{.1, .2, .3, .4, .5, .6, .7, .8, .9, 1})
+	for i := 1; i <= 1000; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	{
+		t.Log("Quantiles should be interpolated within buckets")
+		assert.Equal(t, 500*time.Millisecond, h.Quantile(0.5))
+		assert.Equal(t, 990*time.Millisecond, h.Quantile(0.99))
+		assert.Equal(t, 999*time.Millisecond, h.Quantile(0.999))
+	}
+
+	{
+		t.Log("Merged histograms should add counts and sums")
+		merged := NewHistogram([]float64{.1, .2, .3, .4, .5, .6, .7, .8, .9, 1})
+		merged.Observe(2 * time.Second)
+		merged.Merge(h)
+		assert.EqualValues(t, 1001, merged.Count())
+		assert.Equal(t, h.Sum()+2*time.Second, merged.Sum())
+		assert.Equal(t, time.Second, merged.Quantile(1))
+	}
+
+	{
+		t.Log("Exponential buckets should grow by the factor")
+		assert.Equal(t, []float64{1, 2, 4, 8}, ExponentialBuckets(1, 2, 4))
+	}
+}
@@ -0,0 +1,57 @@
+package reply
+
+// Errors replied by commands which clients return as values. The server
+// replies them and clients match error replies against them, so a message is
+// defined once
+var (
+	ErrAuthRequired    = NewError(CodeNoAuth, "authentication required")
+	ErrWrongPassword   = NewError(CodeWrongPass, "invalid username-password pair or user is disabled")
+	ErrWrongType       = NewError(CodeWrongType, "operation against a key holding the wrong kind of value")
+	ErrNoSuchKey       = NewError(CodeErr, "no such key")
+	ErrSameKeys        = NewError(CodeErr, "source and destination keys are the same")
+	ErrSyntax          = NewError(CodeErr, "syntax error")
+	ErrWrongArgsNumber = NewError(CodeErr, "wrong arguments number")
+	ErrUnknownCommand  = NewError(CodeErr, "Command not found")
+	ErrOutOfMemory     = NewError(CodeOOM, "command not allowed when used memory > 'maxmemory'")
+	ErrShuttingDown    = NewError(CodeErr, "server is shutting down")
+	ErrMaxClients      = NewError(CodeErr, "max number of clients reached")
+	ErrRequestTooLarge = NewError(CodeErr, "request is too large")
+	ErrInvalidDBIndex  = NewError(CodeErr, "invalid DB index")
+	ErrDBOutOfRange    = NewError(CodeErr, "DB index is out of range")
+	ErrInvalidCursor   = NewError(CodeErr, "invalid cursor")
+	ErrKeyNotExists    = NewError(CodeErr, "key does not exist")
+	ErrListNotExists   = NewError(CodeErr, "key does not exits or has been deleted already")
+	ErrIndexOutOfRange = NewError(CodeErr, "index out of range")
+	ErrDictNotExists   = NewError(CodeErr, "dictionary does not exist")
+	ErrDictKeyNotFound = NewError(CodeErr, "key not found")
+	ErrDictKeyExpired  = NewError(CodeErr, "key has expired")
+	ErrNoScript        = NewError(CodeNoScript, "no matching script, please use EVAL")
+	ErrScriptKilled    = NewError(CodeErr, "script killed by user with SCRIPT KILL")
+	ErrScriptTimedOut  = NewError(CodeErr, "script exceeded the time limit and was aborted")
+	ErrNoSnapshotFile  = NewError(CodeErr, "snapshot file is not configured")
+	ErrTXLogDisabled   = NewError(CodeErr, "transaction log is disabled")
+)
+
+var knownErrors = make(map[Error]*Error)
+
+func init() {
+	for _, err := range []*Error{
+		ErrAuthRequired, ErrWrongPassword, ErrWrongType, ErrNoSuchKey, ErrSameKeys, ErrSyntax,
+		ErrWrongArgsNumber, ErrUnknownCommand, ErrOutOfMemory, ErrShuttingDown, ErrMaxClients,
+		ErrRequestTooLarge, ErrInvalidDBIndex, ErrDBOutOfRange, ErrInvalidCursor, ErrKeyNotExists,
+		ErrListNotExists, ErrIndexOutOfRange, ErrDictNotExists, ErrDictKeyNotFound, ErrDictKeyExpired,
+		ErrNoScript, ErrScriptKilled, ErrScriptTimedOut, ErrNoSnapshotFile, ErrTXLogDisabled,
+	} {
+		knownErrors[*err] = err
+	}
+}
+
+// KnownError returns the error above with the code and message of the error
+// reply, ok is false for other replies
+func KnownError(r Reply) (err *Error, ok bool) {
+	if r.Kind != ErrorKind {
+		return nil, false
+	}
+	err, ok = knownErrors[Error{Code: r.Code, Message: r.Value}]
+	return err, ok
+}
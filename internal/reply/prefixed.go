@@ -0,0 +1,171 @@
+package reply
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// ErrProtocol is returned by Read when the stream is not a reply
+var ErrProtocol = errors.New("protocol error")
+
+// lengths of headers are not trusted, buffers start at most this large and
+// grow as bytes arrive
+const (
+	initialValueSize = 64 * 1024
+	initialItems     = 1024
+)
+
+// Write encodes the reply for the length prefixed protocol, which every
+// line of ends with "\r\n":
+//
+//	+status  -CODE message  :integer  $-1 for nil
+//	$length followed by the value, it may contain any bytes
+//	*count followed by the items
+//
+// Requests are arrays of values. The writer is not flushed
+func Write(w *bufio.Writer, r Reply) error {
+	switch r.Kind {
+	case StatusKind:
+		w.WriteByte('+')
+		w.WriteString(oneLine(r.Value))
+	case ValueKind:
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(r.Value)))
+		w.WriteString("\r\n")
+		w.WriteString(r.Value)
+	case IntegerKind:
+		w.WriteByte(':')
+		w.WriteString(r.Value)
+	case NilKind:
+		w.WriteString("$-1")
+	case ErrorKind:
+		w.WriteByte('-')
+		w.WriteString(r.Code)
+		w.WriteByte(' ')
+		w.WriteString(oneLine(r.Value))
+	case ArrayKind:
+		w.WriteByte('*')
+		w.WriteString(strconv.Itoa(len(r.Items)))
+		w.WriteString("\r\n")
+		for _, item := range r.Items {
+			if err := Write(w, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err := w.WriteString("\r\n")
+
+	return err
+}
+
+func oneLine(text string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+}
+
+// Read decodes a reply of the length prefixed protocol
+func Read(r *bufio.Reader) (Reply, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return Reply{}, err
+	}
+	if line == "" {
+		return Reply{}, ErrProtocol
+	}
+
+	switch line[0] {
+	case '+':
+		return Status(line[1:]), nil
+	case '-':
+		return ParseError(line[1:]), nil
+	case ':':
+		if _, err := strconv.ParseInt(line[1:], 10, 64); err != nil {
+			return Reply{}, ErrProtocol
+		}
+		return Reply{Kind: IntegerKind, Value: line[1:]}, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		switch {
+		case err != nil || size < -1:
+			return Reply{}, ErrProtocol
+		case size == -1:
+			return Nil, nil
+		}
+		value, err := ReadValue(r, size)
+		if err != nil {
+			return Reply{}, err
+		}
+		return Value(value), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return Reply{}, ErrProtocol
+		}
+		items := make([]Reply, 0, minInt(count, initialItems))
+		for i := 0; i < count; i++ {
+			item, err := Read(r)
+			if err != nil {
+				return Reply{}, err
+			}
+			items = append(items, item)
+		}
+		return Array(items), nil
+	}
+
+	return Reply{}, ErrProtocol
+}
+
+// ReadValue reads a value of the given length followed by "\r\n". The
+// buffer grows as bytes arrive, so a header alone can not make it allocate
+// the whole length, and becomes the string without a copy
+func ReadValue(r *bufio.Reader, size int) (string, error) {
+	value := make([]byte, 0, minInt(size, initialValueSize))
+	for len(value) < size {
+		if len(value) == cap(value) {
+			grown := make([]byte, len(value), minInt(size, 2*cap(value)))
+			copy(grown, value)
+			value = grown
+		}
+		n, err := r.Read(value[len(value):cap(value)])
+		value = value[:len(value)+n]
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var end [2]byte
+	if _, err := io.ReadFull(r, end[:]); err != nil {
+		return "", err
+	}
+	if end[0] != '\r' || end[1] != '\n' {
+		return "", ErrProtocol
+	}
+
+	// the buffer is not referenced anywhere else, strings.Builder does the same
+	return *(*string)(unsafe.Pointer(&value)), nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// readLine reads a line ending with "\r\n" or "\n" and returns it without
+// the line end
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(line[:len(line)-1], "\r"), nil
+}
@@ -0,0 +1,225 @@
+// Package reply describes results of commands. A reply is a status, a
+// value, an integer, nil for missing values, an error with a code or an
+// array of replies, and is encoded by the protocol of the connection.
+//
+// The text protocol writes a reply per line: errors as "-CODE message", nil
+// as "(nil)", arrays as items joined with ", " and other replies as they
+// are. Statuses and values starting with '-' or '+' or equal to "(nil)" get
+// an extra '+' in front, so they can not be taken for an error or nil.
+//
+// The length prefixed protocol is binary safe, see Write.
+package reply
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Codes of error replies, the code is the first word of the error
+const (
+	CodeErr       = "ERR"
+	CodeWrongType = "WRONGTYPE"
+	CodeNoAuth    = "NOAUTH"
+	CodeWrongPass = "WRONGPASS"
+	CodeNoPerm    = "NOPERM"
+	CodeOOM       = "OOM"
+	CodeNoScript  = "NOSCRIPT"
+)
+
+const (
+	nilText = "(nil)"
+	// escapes statuses and values which look like errors or nil
+	escape = '+'
+)
+
+// Error is an error of a command with the code it is replied with
+type Error struct {
+	Code    string
+	Message string
+}
+
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+type Kind int
+
+const (
+	StatusKind Kind = iota
+	ValueKind
+	IntegerKind
+	NilKind
+	ErrorKind
+	ArrayKind
+)
+
+type Reply struct {
+	Kind Kind
+	// text of statuses and values, decimal integers and messages of errors
+	Value string
+	// code of errors
+	Code string
+	// replies of arrays
+	Items []Reply
+}
+
+// Nil is the reply of a value which does not exist or has expired
+var Nil = Reply{Kind: NilKind}
+
+// OK is the status of commands which have nothing to return
+var OK = Status("Success")
+
+func Status(status string) Reply {
+	return Reply{Kind: StatusKind, Value: status}
+}
+
+func Value(value string) Reply {
+	return Reply{Kind: ValueKind, Value: value}
+}
+
+func Integer(value int64) Reply {
+	return Reply{Kind: IntegerKind, Value: strconv.FormatInt(value, 10)}
+}
+
+func Array(items []Reply) Reply {
+	if items == nil {
+		items = []Reply{}
+	}
+
+	return Reply{Kind: ArrayKind, Items: items}
+}
+
+// Values returns the array of the values
+func Values(values []string) Reply {
+	items := make([]Reply, 0, len(values))
+	for _, value := range values {
+		items = append(items, Value(value))
+	}
+
+	return Array(items)
+}
+
+// Err returns the error reply of err, errors which are not an *Error have
+// the ERR code
+func Err(err error) Reply {
+	var replyErr *Error
+	if errors.As(err, &replyErr) {
+		return Reply{Kind: ErrorKind, Value: err.Error(), Code: replyErr.Code}
+	}
+
+	return Reply{Kind: ErrorKind, Value: err.Error(), Code: CodeErr}
+}
+
+// IsError reports whether the reply is an error
+func (r Reply) IsError() bool {
+	return r.Kind == ErrorKind
+}
+
+// Err returns the *Error of error replies and nil for others
+func (r Reply) Err() error {
+	if r.Kind != ErrorKind {
+		return nil
+	}
+
+	return NewError(r.Code, r.Value)
+}
+
+// Strings returns values of array items, nested arrays are joined and nil
+// items are "(nil)" the way the text protocol does it
+func (r Reply) Strings() []string {
+	values := make([]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		values = append(values, item.text())
+	}
+
+	return values
+}
+
+// text returns the value of the reply, arrays are joined with ", "
+func (r Reply) text() string {
+	switch r.Kind {
+	case ArrayKind:
+		return strings.Join(r.Strings(), ", ")
+	case NilKind:
+		return nilText
+	}
+
+	return r.Value
+}
+
+// String encodes the reply for the text protocol without the line end
+func (r Reply) String() string {
+	switch r.Kind {
+	case NilKind:
+		return nilText
+	case ErrorKind:
+		// errors of scripts may span lines
+		return "-" + r.Code + " " + strings.Replace(r.Value, "\n", " ", -1)
+	case ArrayKind:
+		return Value(r.text()).String()
+	case StatusKind, ValueKind:
+		if r.escaped() {
+			return string(escape) + r.Value
+		}
+	}
+
+	return r.Value
+}
+
+// escaped reports whether the text protocol writes the escape in front of
+// the value
+func (r Reply) escaped() bool {
+	return r.Value == nilText || strings.HasPrefix(r.Value, "-") || strings.HasPrefix(r.Value, string(escape))
+}
+
+// WriteText encodes the reply for the text protocol with the line end.
+// Statuses and values are written as they are after the escape, so large
+// values are not copied. The writer is not flushed
+func WriteText(w *bufio.Writer, r Reply) error {
+	if r.Kind == StatusKind || r.Kind == ValueKind {
+		if r.escaped() {
+			w.WriteByte(escape)
+		}
+		w.WriteString(r.Value)
+	} else {
+		w.WriteString(r.String())
+	}
+
+	return w.WriteByte('\n')
+}
+
+// Parse decodes a line of the text protocol without the line end. Statuses,
+// values and integers can not be told apart and are returned as values
+func Parse(line string) Reply {
+	switch {
+	case line == nilText:
+		return Nil
+	case strings.HasPrefix(line, string(escape)):
+		return Value(line[1:])
+	// negative integers are not escaped
+	case strings.HasPrefix(line, "-") && (len(line) == 1 || line[1] < '0' || line[1] > '9'):
+		return ParseError(line[1:])
+	}
+
+	return Value(line)
+}
+
+// ParseError returns the error reply of "CODE message", the text is taken
+// for a message with the ERR code when its first word is not upper case
+func ParseError(text string) Reply {
+	code, message := text, ""
+	if i := strings.IndexByte(text, ' '); i != -1 {
+		code, message = text[:i], text[i+1:]
+	}
+	if code == "" || strings.TrimLeft(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return Reply{Kind: ErrorKind, Value: text, Code: CodeErr}
+	}
+
+	return Reply{Kind: ErrorKind, Value: message, Code: code}
+}
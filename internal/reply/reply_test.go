@@ -0,0 +1,101 @@
+package reply
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReply_String(t *testing.T) {
+	{
+		t.Log("Errors should be prefixed with their code")
+		assert.Equal(t, "-ERR boom", Err(errors.New("boom")).String())
+		assert.Equal(t, "-WRONGTYPE wrong kind", Err(NewError(CodeWrongType, "wrong kind")).String())
+		wrapped := fmt.Errorf("running: %w", NewError(CodeNoPerm, "denied"))
+		assert.Equal(t, "-NOPERM running: denied", Err(wrapped).String())
+		assert.Equal(t, "-ERR line one line two", Err(errors.New("line one\nline two")).String())
+	}
+
+	{
+		t.Log("Values looking like errors or nil should be escaped")
+		assert.Equal(t, "(nil)", Nil.String())
+		assert.Equal(t, "+(nil)", Value("(nil)").String())
+		assert.Equal(t, "+-ERR fake", Value("-ERR fake").String())
+		assert.Equal(t, "++plus", Status("+plus").String())
+		assert.Equal(t, "Success", OK.String())
+		assert.Equal(t, "-12", Integer(-12).String())
+	}
+}
+
+func TestReply_Parse(t *testing.T) {
+	{
+		t.Log("Encoded replies should be parsed back")
+		for _, r := range []Reply{Nil, Value("moose"), Value("-1 moose"), Value("(nil)"), Value("++"), Value("")} {
+			assert.Equal(t, r, Parse(r.String()))
+		}
+		assert.Equal(t, Value("-12"), Parse(Integer(-12).String()))
+		assert.Equal(t, Reply{Kind: ErrorKind, Value: "wrong kind", Code: CodeWrongType}, Parse("-WRONGTYPE wrong kind"))
+	}
+
+	{
+		t.Log("Errors without a code should get ERR")
+		assert.Equal(t, Reply{Kind: ErrorKind, Value: "value is not a number", Code: CodeErr}, ParseError("value is not a number"))
+		assert.Equal(t, Reply{Kind: ErrorKind, Value: " BUSY", Code: CodeErr}, ParseError(" BUSY"))
+		assert.Equal(t, Reply{Kind: ErrorKind, Value: "", Code: "BUSY"}, ParseError("BUSY"))
+		assert.Equal(t, NewError(CodeOOM, "full"), ParseError("OOM full").Err())
+		assert.Nil(t, Value("-").Err())
+	}
+}
+
+func TestReply_WriteText(t *testing.T) {
+	t.Log("It should write what String does with the line end")
+	for _, r := range []Reply{Nil, OK, Value("(nil)"), Value("-1 moose"), Integer(-12), Err(errors.New("boom")), Values([]string{"-a", "b"})} {
+		buffer := &strings.Builder{}
+		w := bufio.NewWriter(buffer)
+		assert.NoError(t, WriteText(w, r))
+		w.Flush()
+		assert.Equal(t, r.String()+"\n", buffer.String())
+	}
+}
+
+func TestReply_ReadValue(t *testing.T) {
+	{
+		t.Log("Given a large value it should be read whole")
+		value := strings.Repeat("0123456789", 1024*1024)
+		r := bufio.NewReader(strings.NewReader(value + "\r\nnext"))
+		result, err := ReadValue(r, len(value))
+		assert.NoError(t, err)
+		assert.True(t, result == value)
+		rest, _ := r.ReadString('\n')
+		assert.Equal(t, "next", rest)
+	}
+
+	{
+		t.Log("Given a truncated or unterminated value it should fail")
+		_, err := ReadValue(bufio.NewReader(strings.NewReader("abc")), 5)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		_, err = ReadValue(bufio.NewReader(strings.NewReader("abcde\n\n")), 5)
+		assert.Equal(t, ErrProtocol, err)
+	}
+}
+
+func TestReply_KnownError(t *testing.T) {
+	{
+		t.Log("Given an error reply of a known error it should return the same value")
+		err, ok := KnownError(Err(ErrWrongType))
+		assert.True(t, ok)
+		assert.True(t, err == ErrWrongType)
+	}
+
+	{
+		t.Log("Given the same message with another code it should not match")
+		_, ok := KnownError(Err(NewError(CodeErr, ErrWrongType.Message)))
+		assert.False(t, ok)
+		_, ok = KnownError(Value(ErrSyntax.Message))
+		assert.False(t, ok)
+	}
+}
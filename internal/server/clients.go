@@ -0,0 +1,345 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"redis_like_in_memory_db/internal/global_cache"
+	"redis_like_in_memory_db/internal/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultMaxClients = 10000
+
+var (
+	maxClientsReached = reply.ErrMaxClients
+	noSuchClient      = errors.New("no such client")
+	invalidClientName = errors.New("client names can not contain spaces")
+	invalidClientID   = errors.New("invalid client id")
+	invalidTimeout    = errors.New("timeout should be a positive number of milliseconds")
+)
+
+// client describes a connection for CLIENT LIST and friends
+type client struct {
+	id      int64
+	conn    net.Conn
+	addr    string
+	created time.Time
+
+	mu          sync.Mutex
+	name        string
+	lastActive  time.Time
+	lastCommand string
+	db          int
+	user        string
+	// set by CLIENT KILL of the own connection, it is closed after the reply
+	killed bool
+}
+
+func newClient(id int64, conn net.Conn) *client {
+	addr := conn.RemoteAddr().String()
+	if addr == "" || addr == "@" {
+		// unix socket clients have no address of their own
+		addr = conn.LocalAddr().String() + ":0"
+	}
+
+	now := time.Now()
+	return &client{id: id, conn: conn, addr: addr, created: now, lastActive: now}
+}
+
+// begin records the command the client executes now
+func (c *client) begin(command string) {
+	c.mu.Lock()
+	c.lastCommand = strings.ToLower(command)
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+}
+
+// finish copies the session state changed by the command
+func (c *client) finish(session *global_cache.Session) {
+	c.mu.Lock()
+	c.db = session.DB
+	c.user = session.User
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *client) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d db=%d user=%s cmd=%s",
+		c.id, c.addr, c.name, int(now.Sub(c.created).Seconds()), int(now.Sub(c.lastActive).Seconds()),
+		c.db, c.user, c.lastCommand)
+}
+
+// track registers the connection unless the server is shutting down or the
+// client limit is reached
+func (s *Server) track(conn net.Conn) (*client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return nil, reply.ErrShuttingDown
+	}
+	if s.MaxClients > 0 && len(s.clients) >= s.MaxClients {
+		s.rejectedClients++
+		return nil, maxClientsReached
+	}
+
+	s.nextClientID++
+	c := newClient(s.nextClientID, conn)
+	s.clients[c.id] = c
+	s.connections.Add(1)
+	return c, nil
+}
+
+func (s *Server) untrack(c *client) {
+	s.mu.Lock()
+	delete(s.clients, c.id)
+	s.mu.Unlock()
+
+	s.connections.Done()
+}
+
+// sortedClients returns clients in order of their ids
+func (s *Server) sortedClients() []*client {
+	s.mu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].id < clients[j].id
+	})
+	return clients
+}
+
+// armReadDeadline bounds the next read by the idle timeout, while shutting
+// down reads fail right away. Without the timeout the deadline armed before
+// is cleared
+func (s *Server) armReadDeadline(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.closing:
+		conn.SetReadDeadline(time.Now())
+	case s.IdleTimeout > 0:
+		conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+	default:
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// pause delays commands until the deadline, only write commands unless all is set
+func (s *Server) pause(deadline time.Time, all bool) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	s.unpauseLocked()
+	s.pausedUntil = deadline
+	s.pauseAll = all
+	s.unpaused = make(chan struct{})
+}
+
+func (s *Server) unpause() {
+	s.pauseMu.Lock()
+	s.unpauseLocked()
+	s.pauseMu.Unlock()
+}
+
+func (s *Server) unpauseLocked() {
+	if s.unpaused != nil {
+		close(s.unpaused)
+		s.unpaused = nil
+	}
+	s.pausedUntil = time.Time{}
+}
+
+// waitPause blocks a paused command until the pause ends, CLIENT commands
+// always go through so that the pause can be lifted
+func (s *Server) waitPause(command string) {
+	if command == "CLIENT" {
+		return
+	}
+
+	s.pauseMu.Lock()
+	deadline, all, unpaused := s.pausedUntil, s.pauseAll, s.unpaused
+	s.pauseMu.Unlock()
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 || (!all && !global_cache.IsWriteCommand(command)) {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-unpaused:
+	}
+}
+
+// clientCommand handles CLIENT LIST|INFO|SETNAME|GETNAME|KILL|PAUSE|UNPAUSE
+func (s *Server) clientCommand(c *client, session *global_cache.Session, args []string) reply.Reply {
+	if err := s.cache.Authorize(session, args); err != nil {
+		return reply.Err(err)
+	}
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	switch args[1] {
+	// CLIENT LIST [ID id ...]
+	case "LIST":
+		ids := make(map[int64]bool)
+		if len(args) > 2 {
+			if args[2] != "ID" || len(args) == 3 {
+				return reply.Err(syntaxError)
+			}
+			for _, arg := range args[3:] {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil {
+					return reply.Err(invalidClientID)
+				}
+				ids[id] = true
+			}
+		}
+
+		lines := make([]string, 0)
+		for _, other := range s.sortedClients() {
+			if len(ids) == 0 || ids[other.id] {
+				lines = append(lines, other.String())
+			}
+		}
+		return reply.Values(lines)
+
+	case "INFO":
+		return reply.Value(c.String())
+
+	// CLIENT SETNAME name
+	case "SETNAME":
+		if len(args) != 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		if strings.ContainsAny(args[2], " \n") {
+			return reply.Err(invalidClientName)
+		}
+		c.mu.Lock()
+		c.name = args[2]
+		c.mu.Unlock()
+		session.Name = args[2]
+		return reply.OK
+
+	case "GETNAME":
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return reply.Value(c.name)
+
+	// CLIENT KILL addr
+	// CLIENT KILL [ID id] [ADDR addr] [USER username] [SKIPME yes|no]
+	case "KILL":
+		return s.killClients(c, args[2:])
+
+	// CLIENT PAUSE timeout [WRITE|ALL]
+	case "PAUSE":
+		if len(args) != 3 && len(args) != 4 {
+			return reply.Err(wrongArgsNumber)
+		}
+		timeout, err := strconv.Atoi(args[2])
+		if err != nil || timeout < 0 {
+			return reply.Err(invalidTimeout)
+		}
+		all := true
+		if len(args) == 4 {
+			switch args[3] {
+			case "WRITE":
+				all = false
+			case "ALL":
+			default:
+				return reply.Err(syntaxError)
+			}
+		}
+		s.pause(time.Now().Add(time.Duration(timeout)*time.Millisecond), all)
+		return reply.OK
+
+	case "UNPAUSE":
+		s.unpause()
+		return reply.OK
+	}
+
+	return reply.Err(commandNotFound)
+}
+
+func (s *Server) killClients(self *client, args []string) reply.Reply {
+	// the legacy form kills a single client by address
+	if len(args) == 1 {
+		for _, other := range s.sortedClients() {
+			if other.addr == args[0] {
+				s.killClient(self, other)
+				return reply.OK
+			}
+		}
+		return reply.Err(noSuchClient)
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return reply.Err(syntaxError)
+	}
+
+	var id int64
+	addr, user, skipMe := "", "", true
+	for i := 0; i < len(args); i += 2 {
+		switch value := args[i+1]; args[i] {
+		case "ID":
+			var err error
+			if id, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return reply.Err(invalidClientID)
+			}
+		case "ADDR":
+			addr = value
+		case "USER":
+			user = value
+		case "SKIPME":
+			if value != "yes" && value != "no" {
+				return reply.Err(syntaxError)
+			}
+			skipMe = value == "yes"
+		default:
+			return reply.Err(syntaxError)
+		}
+	}
+
+	count := 0
+	for _, other := range s.sortedClients() {
+		other.mu.Lock()
+		matches := (id == 0 || other.id == id) && (addr == "" || other.addr == addr) && (user == "" || other.user == user)
+		other.mu.Unlock()
+
+		if !matches || (skipMe && other == self) {
+			continue
+		}
+		s.killClient(self, other)
+		count++
+	}
+
+	return reply.Integer(int64(count))
+}
+
+func (s *Server) killClient(self, other *client) {
+	if other == self {
+		// the reply is sent before the connection is closed
+		self.mu.Lock()
+		self.killed = true
+		self.mu.Unlock()
+		return
+	}
+	other.conn.Close()
+}
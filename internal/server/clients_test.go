@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"redis_like_in_memory_db/internal/reply"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// startTCPServer serves plain connections on a random port and returns its address
+func startTCPServer(t *testing.T, server *Server) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go server.Serve(listener)
+
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func connect(t *testing.T, address string) *testClient {
+	conn, err := net.Dial("tcp", address)
+	assert.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	client := &testClient{conn: conn, reader: bufio.NewReader(conn)}
+	greeting, _ := client.reader.ReadString('\n')
+	assert.EqualValues(t, "SSuccessful connection\n", greeting)
+	return client
+}
+
+func (client *testClient) do(command string) (string, error) {
+	if _, err := client.conn.Write([]byte(command + "\n")); err != nil {
+		return "", err
+	}
+	reply, err := client.reader.ReadString('\n')
+	return strings.TrimSuffix(reply, "\n"), err
+}
+
+// items sends the command length prefixed, so the reply keeps array items
+// as they are
+func (client *testClient) items(args ...string) ([]string, error) {
+	writer := bufio.NewWriter(client.conn)
+	reply.Write(writer, reply.Values(args))
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	r, err := reply.Read(client.reader)
+	return r.Strings(), err
+}
+
+func TestServer_ClientCommands(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 4, "")
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	first := connect(t, address)
+	defer first.conn.Close()
+	second := connect(t, address)
+	defer second.conn.Close()
+
+	{
+		t.Log("CLIENT LIST should describe every connection")
+		first.do("CLIENT SETNAME loader")
+		second.do("SELECT 2")
+
+		clients, _ := first.items("CLIENT", "LIST")
+		assert.Len(t, clients, 2)
+		assert.Contains(t, clients[0], "id=1 addr="+first.conn.LocalAddr().String()+" name=loader")
+		assert.Contains(t, clients[0], "cmd=client")
+		assert.Contains(t, clients[1], "id=2")
+		assert.Contains(t, clients[1], "db=2 user=default cmd=select")
+
+		reply, _ := second.do("CLIENT LIST ID 1")
+		assert.NotContains(t, reply, "id=2")
+	}
+
+	{
+		reply, _ := first.do("CLIENT GETNAME")
+		assert.EqualValues(t, "loader", reply)
+		reply, _ = second.do("CLIENT INFO")
+		assert.Contains(t, reply, "id=2")
+	}
+
+	{
+		t.Log("CLIENT KILL should close other connections and skip the caller by default")
+		reply, _ := first.do("CLIENT KILL USER default")
+		assert.EqualValues(t, "1", reply)
+		_, err := second.do("GET key")
+		assert.Error(t, err)
+
+		reply, _ = first.do("CLIENT KILL ID 1 SKIPME no")
+		assert.EqualValues(t, "1", reply)
+		_, err = first.do("GET key")
+		assert.Error(t, err)
+	}
+}
+
+func TestServer_ClientPause(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 2, "")
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	admin := connect(t, address)
+	defer admin.conn.Close()
+	loader := connect(t, address)
+	defer loader.conn.Close()
+
+	admin.do("CLIENT PAUSE 10000 WRITE")
+
+	{
+		t.Log("Given a write pause reads should go through and writes should wait")
+		reply, _ := loader.do("GET key")
+		assert.EqualValues(t, "(nil)", reply)
+
+		done := make(chan string)
+		go func() {
+			reply, _ := loader.do("SET key value 1h")
+			done <- reply
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("write was not paused")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		admin.do("CLIENT UNPAUSE")
+		assert.EqualValues(t, "Success", <-done)
+	}
+}
+
+func TestServer_ClientLimits(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 2, "")
+	server.MaxClients = 1
+	server.IdleTimeout = 100 * time.Millisecond
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	first := connect(t, address)
+	defer first.conn.Close()
+
+	{
+		t.Log("Given max clients connected it should refuse the next one")
+		conn, err := net.Dial("tcp", address)
+		assert.NoError(t, err)
+		defer conn.Close()
+		reply, _ := bufio.NewReader(conn).ReadString('\n')
+		assert.EqualValues(t, "-ERR "+maxClientsReached.Error()+"\n", reply)
+	}
+
+	{
+		t.Log("Given an idle connection it should be closed after the timeout")
+		reply, err := first.do("GET key")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "(nil)", reply)
+
+		time.Sleep(300 * time.Millisecond)
+		_, err = first.do("GET key")
+		assert.Error(t, err)
+	}
+
+	{
+		t.Log("Given the timeout turned off an armed deadline should be cleared")
+		client := connect(t, address)
+		defer client.conn.Close()
+		reply, _ := client.do("CONFIG SET timeout 0s")
+		assert.EqualValues(t, "Success", reply)
+
+		time.Sleep(300 * time.Millisecond)
+		reply, err := client.do("GET key")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "(nil)", reply)
+	}
+}
+
+func TestServer_Info(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 4, "")
+	server.MaxClients = 8
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	first := connect(t, address)
+	defer first.conn.Close()
+	second := connect(t, address)
+	defer second.conn.Close()
+
+	reply, _ := first.do("INFO server clients")
+	sections := strings.Split(reply, "; ")
+	assert.Len(t, sections, 2)
+	assert.Contains(t, sections[0], "# Server, go_version:")
+	assert.Contains(t, sections[0], "uptime_in_seconds:")
+	assert.EqualValues(t, "# Clients, connected_clients:2, maxclients:8, clients_paused:0", sections[1])
+}
+
+func TestServer_Slowlog(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 4, "")
+	server.cache.SetSlowlog(0, 10)
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	client := connect(t, address)
+	defer client.conn.Close()
+	client.do("CLIENT SETNAME loader")
+	client.do("DBSIZE")
+
+	reply, _ := client.do("SLOWLOG GET 1")
+	assert.Contains(t, reply, "addr="+client.conn.LocalAddr().String()+" name=loader args=DBSIZE")
+}
+
+func TestServer_Monitor(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 4, "")
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	monitor := connect(t, address)
+	defer monitor.conn.Close()
+	reply, _ := monitor.do("MONITOR")
+	assert.EqualValues(t, "Success", reply)
+
+	client := connect(t, address)
+	defer client.conn.Close()
+	client.do("SELECT 2")
+	client.do("SET user:1 moose 1h")
+
+	line, _ := monitor.reader.ReadString('\n')
+	assert.Contains(t, line, `[0 `+client.conn.LocalAddr().String()+`] "SELECT" "2"`)
+	line, _ = monitor.reader.ReadString('\n')
+	assert.Contains(t, line, `[2 `+client.conn.LocalAddr().String()+`] "SET" "user:1" "moose" "1h"`)
+
+	{
+		t.Log("Given QUIT the monitor should be closed")
+		monitor.conn.Write([]byte("QUIT\n"))
+		_, err := monitor.reader.ReadString('\n')
+		assert.Error(t, err)
+	}
+}
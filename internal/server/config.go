@@ -0,0 +1,429 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"redis_like_in_memory_db/internal/config"
+	"redis_like_in_memory_db/internal/glob"
+	"redis_like_in_memory_db/internal/global_cache"
+	"redis_like_in_memory_db/internal/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var noConfigFile = errors.New("the server is running without a config file")
+
+// configParam reads and changes a parameter of a running server, names match
+// flags of cmd/main.go and lines of the config file
+type configParam struct {
+	get func(s *Server) string
+	// set checks the value and returns the function applying it, so CONFIG SET
+	// changes nothing when one of its values is invalid. It is nil for
+	// parameters which are applied at startup only
+	set func(s *Server, value string) (func(), error)
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// locked reads a field guarded by the server mutex
+func locked(get func(s *Server) string) func(s *Server) string {
+	return func(s *Server) string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return get(s)
+	}
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+	return duration, nil
+}
+
+func parseCount(value string) (int, error) {
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid number %s", value)
+	}
+	return count, nil
+}
+
+// setDuration parses the value and stores it in the field under the server mutex
+func setDuration(field func(s *Server) *time.Duration) func(s *Server, value string) (func(), error) {
+	return func(s *Server, value string) (func(), error) {
+		duration, err := parseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			s.mu.Lock()
+			*field(s) = duration
+			s.mu.Unlock()
+		}, nil
+	}
+}
+
+var configParams = map[string]configParam{
+	"port":             {get: func(s *Server) string { return s.Port }},
+	"databases":        {get: func(s *Server) string { return strconv.Itoa(s.numDatabases) }},
+	"num_buckets":      {get: func(s *Server) string { return strconv.Itoa(s.numBuckets) }},
+	"aclfile":          {get: func(s *Server) string { return s.ACLFile }},
+	"logging":          {get: func(s *Server) string { return formatBool(s.TXLog != "") }},
+	"tx_log":           {get: func(s *Server) string { return s.TXLog }},
+	"unixsocket":       {get: func(s *Server) string { return s.UnixSocket }},
+	"unixsocketperm":   {get: func(s *Server) string { return fmt.Sprintf("%#o", s.UnixSocketPerm) }},
+	"tls_port":         {get: func(s *Server) string { return s.TLS.Port }},
+	"tls_cert":         {get: func(s *Server) string { return s.TLS.CertFile }},
+	"tls_key":          {get: func(s *Server) string { return s.TLS.KeyFile }},
+	"tls_ca":           {get: func(s *Server) string { return s.TLS.CAFile }},
+	"tls_auth_clients": {get: func(s *Server) string { return formatBool(s.TLS.AuthClients) }},
+	"metrics_addr":     {get: func(s *Server) string { return s.MetricsAddr }},
+
+	"requirepass": {
+		get: locked(func(s *Server) string {
+			if !s.PasswordRequired {
+				return ""
+			}
+			return s.Password
+		}),
+		set: func(s *Server, value string) (func(), error) {
+			rules := []string{"resetpass", ">" + value}
+			if value == "" {
+				rules = []string{"nopass"}
+			}
+			return func() {
+				// password rules are always valid
+				s.cache.SetUser("default", rules...)
+				s.mu.Lock()
+				s.Password, s.PasswordRequired = value, value != ""
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"maxclients": {
+		get: locked(func(s *Server) string { return strconv.Itoa(s.MaxClients) }),
+		set: func(s *Server, value string) (func(), error) {
+			count, err := parseCount(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() {
+				s.mu.Lock()
+				s.MaxClients = count
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"timeout": {
+		get: locked(func(s *Server) string { return s.IdleTimeout.String() }),
+		set: setDuration(func(s *Server) *time.Duration { return &s.IdleTimeout }),
+	},
+	"shutdown_timeout": {
+		get: locked(func(s *Server) string { return s.ShutdownTimeout.String() }),
+		set: setDuration(func(s *Server) *time.Duration { return &s.ShutdownTimeout }),
+	},
+	// applies to new connections
+	"max_request_size": {
+		get: locked(func(s *Server) string { return strconv.Itoa(s.MaxRequestSize) }),
+		set: func(s *Server, value string) (func(), error) {
+			size, err := config.ParseMemory(value)
+			if err != nil || size == 0 {
+				return nil, fmt.Errorf("invalid request size %s", value)
+			}
+			return func() {
+				s.mu.Lock()
+				s.MaxRequestSize = int(size)
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	// applies to new connections
+	"proto_max_bulk_len": {
+		get: locked(func(s *Server) string { return strconv.Itoa(s.ProtoMaxBulkLen) }),
+		set: func(s *Server, value string) (func(), error) {
+			size, err := config.ParseMemory(value)
+			if err != nil || size == 0 {
+				return nil, fmt.Errorf("invalid bulk length %s", value)
+			}
+			return func() {
+				s.mu.Lock()
+				s.ProtoMaxBulkLen = int(size)
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"snapshot": {
+		get: func(s *Server) string { return s.cache.SnapshotFile() },
+		set: func(s *Server, value string) (func(), error) {
+			return func() {
+				s.cache.SetSnapshotFile(value)
+				s.mu.Lock()
+				s.SnapshotFile = value
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"save_interval": {
+		get: locked(func(s *Server) string { return s.SaveInterval.String() }),
+		set: setDuration(func(s *Server) *time.Duration { return &s.SaveInterval }),
+	},
+	"save_min_changes": {
+		get: locked(func(s *Server) string { return strconv.FormatInt(s.SaveMinChanges, 10) }),
+		set: func(s *Server, value string) (func(), error) {
+			count, err := parseCount(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() {
+				s.mu.Lock()
+				s.SaveMinChanges = int64(count)
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"tx_log_fsync": {
+		get: locked(func(s *Server) string { return s.TXLogFsync }),
+		set: func(s *Server, value string) (func(), error) {
+			if err := s.cache.CheckTXLogFsync(value); err != nil {
+				return nil, err
+			}
+			return func() {
+				s.cache.SetTXLogFsync(value)
+				s.mu.Lock()
+				s.TXLogFsync = value
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"maxmemory": {
+		get: func(s *Server) string { return strconv.FormatInt(s.cache.MaxMemory(), 10) },
+		set: func(s *Server, value string) (func(), error) {
+			bytes, err := config.ParseMemory(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() {
+				s.cache.SetMaxMemory(bytes)
+				s.mu.Lock()
+				s.MaxMemory = bytes
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"maxmemory_policy": {
+		get: func(s *Server) string { return s.cache.EvictionPolicy() },
+		set: func(s *Server, value string) (func(), error) {
+			if err := global_cache.CheckEvictionPolicy(value); err != nil {
+				return nil, err
+			}
+			return func() {
+				s.cache.SetEvictionPolicy(value)
+				s.mu.Lock()
+				s.MaxMemoryPolicy = value
+				s.mu.Unlock()
+			}, nil
+		},
+	},
+	"slowlog_log_slower_than": {
+		get: func(s *Server) string {
+			threshold, _ := s.cache.Slowlog()
+			return threshold.String()
+		},
+		set: func(s *Server, value string) (func(), error) {
+			duration, err := parseDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() {
+				_, maxLen := s.cache.Slowlog()
+				s.cache.SetSlowlog(duration, maxLen)
+			}, nil
+		},
+	},
+	"slowlog_max_len": {
+		get: func(s *Server) string {
+			_, maxLen := s.cache.Slowlog()
+			return strconv.Itoa(maxLen)
+		},
+		set: func(s *Server, value string) (func(), error) {
+			count, err := parseCount(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() {
+				threshold, _ := s.cache.Slowlog()
+				s.cache.SetSlowlog(threshold, count)
+			}, nil
+		},
+	},
+	"latency_monitor_threshold": {
+		get: func(s *Server) string { return s.cache.LatencyThreshold().String() },
+		set: func(s *Server, value string) (func(), error) {
+			duration, err := parseDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() { s.cache.SetLatencyThreshold(duration) }, nil
+		},
+	},
+}
+
+// configCommand handles CONFIG GET pattern [pattern ...] | SET name value
+// [name value ...] | REWRITE
+func (s *Server) configCommand(session *global_cache.Session, args []string) reply.Reply {
+	if err := s.cache.Authorize(session, args); err != nil {
+		return reply.Err(err)
+	}
+	if len(args) < 2 {
+		return reply.Err(wrongArgsNumber)
+	}
+
+	switch args[1] {
+	case "GET":
+		if len(args) < 3 {
+			return reply.Err(wrongArgsNumber)
+		}
+		names := make([]string, 0)
+		for name := range configParams {
+			for _, pattern := range args[2:] {
+				if glob.Match(strings.ToLower(pattern), name) {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		sort.Strings(names)
+
+		pairs := make([]string, 0, len(names)*2)
+		for _, name := range names {
+			pairs = append(pairs, name, configParams[name].get(s))
+		}
+		return reply.Values(pairs)
+
+	case "SET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return reply.Err(wrongArgsNumber)
+		}
+		// every parameter and value is checked before any of them is changed
+		applies := make([]func(), 0, len(args)/2-1)
+		for i := 2; i < len(args); i += 2 {
+			name := strings.ToLower(args[i])
+			param, ok := configParams[name]
+			if !ok {
+				return reply.Err(fmt.Errorf("unknown parameter %s", args[i]))
+			}
+			if param.set == nil {
+				return reply.Err(fmt.Errorf("parameter %s can not be changed at runtime", args[i]))
+			}
+			apply, err := param.set(s, args[i+1])
+			if err != nil {
+				return reply.Err(fmt.Errorf("can not set %s: %s", name, err))
+			}
+			applies = append(applies, apply)
+		}
+		for i, apply := range applies {
+			apply()
+			s.mu.Lock()
+			s.configChanged[strings.ToLower(args[2+2*i])] = true
+			s.mu.Unlock()
+		}
+		return reply.OK
+
+	case "REWRITE":
+		if len(args) != 2 {
+			return reply.Err(wrongArgsNumber)
+		}
+		if err := s.rewriteConfig(); err != nil {
+			return reply.Err(err)
+		}
+		return reply.OK
+	}
+
+	return reply.Err(commandNotFound)
+}
+
+// rewriteConfig writes current values of parameters which are in the config
+// file or were changed by CONFIG SET
+func (s *Server) rewriteConfig() error {
+	if s.ConfigFile == "" {
+		return noConfigFile
+	}
+	file, err := config.Load(s.ConfigFile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("config file %s does not exist", s.ConfigFile)
+	}
+	if err != nil {
+		return err
+	}
+	params, err := file.Params()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.configChanged))
+	for name := range s.configChanged {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	for _, param := range params {
+		names = append(names, param.Name)
+	}
+
+	values := make(map[string]string)
+	for _, name := range names {
+		// unknown lines are kept as they are
+		if param, ok := configParams[name]; ok {
+			values[name] = param.get(s)
+		}
+	}
+	return file.Rewrite(values)
+}
+
+// autoSave writes the snapshot every SaveInterval when there were enough
+// writes, it returns once stop is closed
+func (s *Server) autoSave(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	// a failed save is retried after the interval rather than every tick
+	var failed time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		interval, minChanges := s.SaveInterval, s.SaveMinChanges
+		s.mu.Unlock()
+
+		lastSave := s.cache.LastSave()
+		if lastSave.IsZero() {
+			lastSave = time.Now().Add(-s.cache.Uptime())
+		}
+		if failed.After(lastSave) {
+			lastSave = failed
+		}
+		changes := s.cache.ChangesSinceSave()
+		if interval <= 0 || time.Since(lastSave) < interval || changes == 0 || changes < minChanges || s.cache.SnapshotFile() == "" {
+			continue
+		}
+		if err := s.cache.Save(); err != nil {
+			fmt.Println("Can not save snapshot: ", err)
+			failed = time.Now()
+		}
+	}
+}
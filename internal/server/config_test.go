@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServer_Config(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "server.conf")
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte("# limits\nmaxclients 10\n"), 0600))
+
+	server := NewServer("", false, false, "", 4, 2, "")
+	server.ConfigFile = configFile
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	client := connect(t, address)
+	defer client.conn.Close()
+
+	{
+		t.Log("get")
+		reply, _ := client.do("CONFIG GET maxclients databases")
+		assert.EqualValues(t, "databases, 2, maxclients, 10000", reply)
+		reply, _ = client.do("CONFIG GET slowlog*")
+		assert.EqualValues(t, "slowlog_log_slower_than, 10ms, slowlog_max_len, 128", reply)
+		reply, _ = client.do("CONFIG GET proto_max_bulk_len")
+		assert.EqualValues(t, "proto_max_bulk_len, 536870912", reply)
+	}
+
+	{
+		t.Log("set")
+		reply, _ := client.do("CONFIG SET maxclients 100 maxmemory 1mb")
+		assert.EqualValues(t, "Success", reply)
+		reply, _ = client.do("CONFIG GET maxclients maxmemory")
+		assert.EqualValues(t, "maxclients, 100, maxmemory, 1048576", reply)
+
+		reply, _ = client.do("CONFIG SET port :9000")
+		assert.EqualValues(t, "-ERR parameter port can not be changed at runtime", reply)
+		reply, _ = client.do("CONFIG SET maxclients 5 unknown 1")
+		assert.EqualValues(t, "-ERR unknown parameter unknown", reply)
+		reply, _ = client.do("CONFIG GET maxclients")
+		assert.EqualValues(t, "maxclients, 100", reply)
+		reply, _ = client.do("CONFIG SET timeout forever")
+		assert.EqualValues(t, "-ERR can not set timeout: invalid duration forever", reply)
+		reply, _ = client.do("CONFIG SET maxclients 10 timeout forever")
+		assert.EqualValues(t, "-ERR can not set timeout: invalid duration forever", reply)
+		reply, _ = client.do("CONFIG GET maxclients")
+		assert.EqualValues(t, "maxclients, 100", reply)
+
+		reply, _ = client.do("CONFIG SET maxmemory_policy allkeys-random")
+		assert.EqualValues(t, "Success", reply)
+		reply, _ = client.do("CONFIG GET maxmemory_policy")
+		assert.EqualValues(t, "maxmemory_policy, allkeys-random", reply)
+		reply, _ = client.do("CONFIG SET maxmemory_policy allkeys-lru")
+		assert.EqualValues(t, "-ERR can not set maxmemory_policy: eviction policy should be noeviction or allkeys-random", reply)
+	}
+
+	{
+		t.Log("rewrite")
+		reply, _ := client.do(`CONFIG SET requirepass "new secret"`)
+		assert.EqualValues(t, "Success", reply)
+		reply, _ = client.do("CONFIG REWRITE")
+		assert.EqualValues(t, "Success", reply)
+
+		content, err := ioutil.ReadFile(configFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "# limits\nmaxclients 100\nmaxmemory 1048576\nmaxmemory_policy allkeys-random\nrequirepass \"new secret\"\n", string(content))
+	}
+
+	{
+		t.Log("auth with the new password")
+		other := connect(t, address)
+		defer other.conn.Close()
+		reply, _ := other.reader.ReadString('\n')
+		assert.EqualValues(t, "Authorize to proceed with AUTH [username] password\n", reply)
+		reply, _ = other.do("GET user:1")
+		assert.EqualValues(t, "-NOAUTH authentication required", reply)
+		reply, _ = other.do(`AUTH "new secret"`)
+		assert.EqualValues(t, "Success", reply)
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"redis_like_in_memory_db/internal/reply"
+	"strconv"
+)
+
+const (
+	// DefaultMaxRequestSize bounds a single request including all its values
+	DefaultMaxRequestSize = 1024 * 1024 * 1024
+	// DefaultProtoMaxBulkLen bounds a single value of a request
+	DefaultProtoMaxBulkLen = 512 * 1024 * 1024
+	// bounds requests and their values until the session is authenticated
+	unauthenticatedMaxRequestSize = 16 * 1024
+	// lengths of headers are not trusted, arguments are allocated as they arrive
+	initialArgs = 1024
+)
+
+var (
+	requestTooLarge = reply.ErrRequestTooLarge
+	valueTooLarge   = errors.New("value is larger than proto_max_bulk_len")
+)
+
+// request is a command read from the connection
+type request struct {
+	args []string
+	// length prefixed requests are replied with the length prefixed protocol
+	prefixed bool
+}
+
+// requestReader splits the connection stream into requests. Text requests
+// end with a new line which is not inside a quoted argument, so values may
+// span lines. Requests starting with '*' are arrays of length prefixed
+// values, see reply.Write, and may hold any bytes. Several requests may
+// arrive in a single read
+type requestReader struct {
+	reader     *bufio.Reader
+	maxSize    int
+	maxBulkLen int
+	// splits text requests into arguments
+	parse func([]byte) []string
+}
+
+func newRequestReader(reader io.Reader, maxSize, maxBulkLen int, parse func([]byte) []string) *requestReader {
+	return &requestReader{reader: bufio.NewReader(reader), maxSize: maxSize, maxBulkLen: maxBulkLen, parse: parse}
+}
+
+// limit sets the limits of the following requests
+func (requests *requestReader) limit(maxSize, maxBulkLen int) {
+	requests.maxSize, requests.maxBulkLen = maxSize, maxBulkLen
+}
+
+// buffered reports whether the next request may be read without blocking
+func (requests *requestReader) buffered() bool {
+	return requests.reader.Buffered() != 0
+}
+
+// next returns the next request, blank lines are skipped. Requests above the
+// size limit and malformed length prefixed requests are refused since the
+// stream can not be resynced. Values above the bulk limit are refused before
+// they are read, text requests are read whole and may be followed by others
+func (requests *requestReader) next() (request, error) {
+	for {
+		first, err := requests.reader.Peek(1)
+		if err != nil {
+			return request{}, err
+		}
+		if first[0] == '*' {
+			args, err := requests.nextPrefixed()
+			return request{args: args, prefixed: true}, err
+		}
+
+		line, err := requests.nextLine()
+		if err != nil {
+			return request{}, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		args := requests.parse(line)
+		for _, arg := range args {
+			if len(arg) > requests.maxBulkLen {
+				return request{}, valueTooLarge
+			}
+		}
+		return request{args: args}, nil
+	}
+}
+
+// nextLine returns the next text request without the trailing new line
+func (requests *requestReader) nextLine() ([]byte, error) {
+	request := make([]byte, 0)
+	quotes := quoteState{fieldStart: true}
+	for {
+		chunk, err := requests.reader.ReadSlice('\n')
+		if len(request)+len(chunk) > requests.maxSize {
+			return nil, requestTooLarge
+		}
+		request = append(request, chunk...)
+		quotes.feed(chunk)
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(request) != 0:
+			// the last request of a closed stream may lack the new line
+			return request, nil
+		case err != nil:
+			return nil, err
+		case !quotes.quoted:
+			return bytes.TrimRight(request, "\r\n"), nil
+		}
+	}
+}
+
+// quoteState follows csv quoting of a text request across its chunks: only a
+// quote opening an argument starts a quoted one, which may hold new lines,
+// and quotes inside it are doubled
+type quoteState struct {
+	quoted bool
+	// a quote ended the quoted argument unless another one follows
+	closed     bool
+	fieldStart bool
+}
+
+func (state *quoteState) feed(chunk []byte) {
+	for _, c := range chunk {
+		switch {
+		case state.quoted:
+			if c == '"' {
+				state.quoted, state.closed = false, true
+			}
+		case state.closed && c == '"':
+			state.quoted, state.closed = true, false
+		case state.fieldStart && c == '"':
+			state.quoted, state.fieldStart = true, false
+		default:
+			state.closed = false
+			state.fieldStart = c == ' '
+		}
+	}
+}
+
+// nextPrefixed reads "*count" followed by count values
+func (requests *requestReader) nextPrefixed() ([]string, error) {
+	count, err := requests.readHeader('*')
+	if err != nil {
+		return nil, err
+	}
+	// every value takes at least "$0\r\n\r\n"
+	if count > requests.maxSize/6 {
+		return nil, requestTooLarge
+	}
+
+	capacity := count
+	if capacity > initialArgs {
+		capacity = initialArgs
+	}
+	args := make([]string, 0, capacity)
+	size := 0
+	for i := 0; i < count; i++ {
+		length, err := requests.readHeader('$')
+		if err != nil {
+			return nil, err
+		}
+		if length > requests.maxBulkLen {
+			return nil, valueTooLarge
+		}
+		if length > requests.maxSize-size {
+			return nil, requestTooLarge
+		}
+		size += length
+		value, err := reply.ReadValue(requests.reader, length)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	return args, nil
+}
+
+// readHeader reads a line of the prefix followed by a non negative number
+func (requests *requestReader) readHeader(prefix byte) (int, error) {
+	line, err := requests.reader.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return 0, reply.ErrProtocol
+		}
+		return 0, err
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) < 2 || line[0] != prefix {
+		return 0, reply.ErrProtocol
+	}
+	number, err := strconv.Atoi(string(line[1:]))
+	if err != nil || number < 0 {
+		return 0, reply.ErrProtocol
+	}
+
+	return number, nil
+}
+
+// writeReply encodes the reply with the protocol of the request
+func writeReply(w *bufio.Writer, r reply.Reply, prefixed bool) {
+	if prefixed {
+		reply.Write(w, r)
+		return
+	}
+
+	reply.WriteText(w, r)
+}
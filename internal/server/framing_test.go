@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"redis_like_in_memory_db/internal/global_cache"
+	"redis_like_in_memory_db/internal/reply"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRequestReader_Next(t *testing.T) {
+	parse := global_cache.NewCache(1, false).ParseRequest
+	testCases := []struct {
+		name     string
+		input    string
+		expected [][]string
+	}{
+		{
+			name:     "pipelined requests in one read",
+			input:    "SET a 1 1h\r\nSET b 2 1h\n\nGET a\n",
+			expected: [][]string{{"SET", "a", "1", "1h"}, {"SET", "b", "2", "1h"}, {"GET", "a"}},
+		},
+		{
+			name:     "quoted value spanning lines",
+			input:    "SET a \"first\nsecond \"\"quoted\"\"\" 1h\nGET a\n",
+			expected: [][]string{{"SET", "a", "first\nsecond \"quoted\"", "1h"}, {"GET", "a"}},
+		},
+		{
+			name:     "quotes inside unquoted values",
+			input:    "SET k 5\" 1h\nGET k\nSET q \"a \"\"b\"\"\" 1h\nGET q\n",
+			expected: [][]string{nil, {"GET", "k"}, {"SET", "q", "a \"b\"", "1h"}, {"GET", "q"}},
+		},
+		{
+			name:     "last request without new line",
+			input:    "GET a\nGET b",
+			expected: [][]string{{"GET", "a"}, {"GET", "b"}},
+		},
+		{
+			name:     "length prefixed values with any bytes",
+			input:    "*3\r\n$3\r\nGET\r\n$0\r\n\r\n$5\r\na\r\n\x00\"\r\nGET b\n",
+			expected: [][]string{{"GET", "", "a\r\n\x00\""}, {"GET", "b"}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			// a byte per read makes every request span reads
+			requests := newRequestReader(iotest.OneByteReader(strings.NewReader(testCase.input)), 1024, 1024, parse)
+			result := make([][]string, 0)
+			for {
+				request, err := requests.next()
+				if err != nil {
+					break
+				}
+				result = append(result, request.args)
+			}
+
+			assert.EqualValues(t, testCase.expected, result)
+		})
+	}
+
+	{
+		t.Log("Given a request above the limit it should be refused")
+		value := strings.Repeat("v", 10000)
+		requests := newRequestReader(strings.NewReader("SET a "+value+" 1h\n"), 20000, 20000, parse)
+		request, err := requests.next()
+		assert.NoError(t, err)
+		assert.Len(t, request.args[2], 10000)
+
+		requests = newRequestReader(strings.NewReader("SET a "+value+" 1h\n"), 5000, 20000, parse)
+		_, err = requests.next()
+		assert.EqualValues(t, requestTooLarge, err)
+
+		requests = newRequestReader(strings.NewReader("*1\r\n$10000\r\n"+value+"\r\n"), 5000, 20000, parse)
+		request, err = requests.next()
+		assert.EqualValues(t, requestTooLarge, err)
+		assert.True(t, request.prefixed)
+	}
+
+	{
+		t.Log("Given a value above the bulk limit it should be refused")
+		value := strings.Repeat("v", 10000)
+		requests := newRequestReader(strings.NewReader("SET a "+value+" 1h\nGET a\n"), 20000, 5000, parse)
+		_, err := requests.next()
+		assert.EqualValues(t, valueTooLarge, err)
+		request, err := requests.next()
+		assert.NoError(t, err)
+		assert.EqualValues(t, []string{"GET", "a"}, request.args)
+
+		// the header is enough, the value is never sent
+		requests = newRequestReader(strings.NewReader("*1\r\n$10000\r\n"), 20000, 5000, parse)
+		request, err = requests.next()
+		assert.EqualValues(t, valueTooLarge, err)
+		assert.True(t, request.prefixed)
+	}
+
+	{
+		t.Log("Given large lengths without the bytes it should not allocate them")
+		for _, input := range []string{"*1\r\n$536870000\r\nabc", "*178000000\r\n$3\r\nGET\r\n"} {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := newRequestReader(strings.NewReader(input), DefaultMaxRequestSize, DefaultProtoMaxBulkLen, parse).next()
+			runtime.ReadMemStats(&after)
+			assert.Error(t, err)
+			assert.True(t, after.TotalAlloc-before.TotalAlloc < 1024*1024, after.TotalAlloc-before.TotalAlloc)
+		}
+	}
+
+	{
+		t.Log("Given a malformed length prefixed request it should fail")
+		for _, input := range []string{"*x\r\n", "*1\r\nGET\r\n", "*1\r\n$-2\r\n", "*1\r\n$3\r\nGETX\r\n"} {
+			_, err := newRequestReader(strings.NewReader(input), 1024, 1024, parse).next()
+			assert.EqualValues(t, reply.ErrProtocol, err, input)
+		}
+	}
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	server := NewServer(":0", false, false, "", 4, 2, "")
+	client, conn := net.Pipe()
+	defer client.Close()
+	go handleConn(conn, server)
+
+	reader := bufio.NewReader(client)
+	reply, _ := reader.ReadString('\n')
+	assert.EqualValues(t, "SSuccessful connection\n", reply)
+
+	batch := &strings.Builder{}
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(batch, "SET key:%d value:%d 1h\n", i, i)
+		fmt.Fprintf(batch, "GET key:%d\n", i)
+	}
+	batch.WriteString("QUIT\nGET key:0\n")
+	go client.Write([]byte(batch.String()))
+
+	{
+		t.Log("Replies should come back in order of requests")
+		for i := 0; i < 2000; i++ {
+			reply, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			assert.EqualValues(t, "Success\n", reply)
+			reply, err = reader.ReadString('\n')
+			assert.NoError(t, err)
+			assert.EqualValues(t, fmt.Sprintf("value:%d\n", i), reply)
+		}
+	}
+
+	{
+		t.Log("Requests after QUIT should not be executed")
+		_, err := reader.ReadString('\n')
+		assert.Error(t, err)
+	}
+}
+
+func TestServer_LengthPrefixed(t *testing.T) {
+	server := NewServer(":0", false, false, "", 4, 2, "")
+	client, conn := net.Pipe()
+	defer client.Close()
+	go handleConn(conn, server)
+
+	reader := bufio.NewReader(client)
+	greeting, _ := reader.ReadString('\n')
+	assert.EqualValues(t, "SSuccessful connection\n", greeting)
+
+	value := "line\r\nquote\" nul\x00 end"
+	request := bufio.NewWriter(client)
+	reply.Write(request, reply.Values([]string{"SET", "key", value, "1h"}))
+	reply.Write(request, reply.Values([]string{"GET", "key"}))
+	reply.Write(request, reply.Values([]string{"GET", "missing"}))
+	reply.Write(request, reply.Values([]string{"ZSET", "key", "v", "1h"}))
+	reply.Write(request, reply.Values([]string{"SCAN", "0"}))
+	request.WriteString("EXISTS key\n")
+	go request.Flush()
+
+	{
+		t.Log("Replies should be length prefixed and keep values as they are")
+		replies := make([]reply.Reply, 0)
+		for i := 0; i < 5; i++ {
+			r, err := reply.Read(reader)
+			assert.NoError(t, err)
+			replies = append(replies, r)
+		}
+		assert.Equal(t, reply.OK, replies[0])
+		assert.Equal(t, reply.Value(value), replies[1])
+		assert.Equal(t, reply.Nil, replies[2])
+		assert.Equal(t, reply.CodeWrongType, replies[3].Code)
+		assert.Equal(t, []string{"0", "key"}, replies[4].Strings())
+	}
+
+	{
+		t.Log("Text requests should get text replies on the same connection")
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "1\n", line)
+	}
+}
+
+func TestServer_UnauthenticatedLimits(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 2, "")
+	address, stop := startTCPServer(t, server)
+	defer stop()
+	admin := connect(t, address)
+	defer admin.conn.Close()
+	result, _ := admin.do("CONFIG SET requirepass secret")
+	assert.EqualValues(t, "Success", result)
+
+	{
+		t.Log("Before AUTH a large value should be refused by its header")
+		client := connect(t, address)
+		defer client.conn.Close()
+		client.reader.ReadString('\n')
+		client.conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$100000\r\n"))
+		r, err := reply.Read(client.reader)
+		assert.NoError(t, err)
+		assert.Equal(t, reply.Err(valueTooLarge), r)
+	}
+
+	{
+		t.Log("After AUTH the configured limits should apply")
+		client := connect(t, address)
+		defer client.conn.Close()
+		client.reader.ReadString('\n')
+		result, _ := client.do("AUTH secret")
+		assert.EqualValues(t, "Success", result)
+
+		request := bufio.NewWriter(client.conn)
+		reply.Write(request, reply.Values([]string{"SET", "k", strings.Repeat("v", 100000), "1h"}))
+		request.Flush()
+		r, err := reply.Read(client.reader)
+		assert.NoError(t, err)
+		assert.Equal(t, reply.OK, r)
+	}
+}
+
+func TestServer_LargeValues(t *testing.T) {
+	server := NewServer(":0", false, false, "", 4, 2, "")
+	server.ProtoMaxBulkLen = 8 * 1024 * 1024
+	client, conn := net.Pipe()
+	defer client.Close()
+	go handleConn(conn, server)
+
+	reader := bufio.NewReader(client)
+	greeting, _ := reader.ReadString('\n')
+	assert.EqualValues(t, "SSuccessful connection\n", greeting)
+	request := bufio.NewWriter(client)
+
+	{
+		t.Log("Given a value of several megabytes it should be stored and returned whole")
+		value := strings.Repeat("<div>fragment</div>\r\n", 300000)
+		written := make(chan struct{})
+		go func() {
+			reply.Write(request, reply.Values([]string{"SET", "page", value, "1h"}))
+			reply.Write(request, reply.Values([]string{"GET", "page"}))
+			request.Flush()
+			close(written)
+		}()
+		r, err := reply.Read(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, reply.OK, r)
+		r, err = reply.Read(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, len(value), len(r.Value))
+		assert.True(t, value == r.Value)
+		<-written
+	}
+
+	{
+		t.Log("Given a value above proto_max_bulk_len it should get an error and the connection should be closed")
+		go func() {
+			request.WriteString("*4\r\n$3\r\nSET\r\n$4\r\npage\r\n$9000000\r\n")
+			request.Flush()
+		}()
+		r, err := reply.Read(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, reply.Err(valueTooLarge), r)
+		_, err = reader.ReadByte()
+		assert.Error(t, err)
+	}
+}
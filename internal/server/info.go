@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// serverInfo returns the server section of INFO
+func (s *Server) serverInfo() []string {
+	uptime := s.cache.Uptime()
+	return []string{
+		fmt.Sprintf("go_version:%s", runtime.Version()),
+		fmt.Sprintf("process_id:%d", os.Getpid()),
+		fmt.Sprintf("tcp_port:%s", s.Port),
+		fmt.Sprintf("tls_port:%s", s.TLS.Port),
+		fmt.Sprintf("unixsocket:%s", s.UnixSocket),
+		fmt.Sprintf("uptime_in_seconds:%d", int64(uptime.Seconds())),
+		fmt.Sprintf("uptime_in_days:%d", int64(uptime.Hours()/24)),
+	}
+}
+
+// clientsInfo returns the clients section of INFO
+func (s *Server) clientsInfo() []string {
+	s.mu.Lock()
+	connected, maxClients := len(s.clients), s.MaxClients
+	s.mu.Unlock()
+
+	s.pauseMu.Lock()
+	paused := time.Until(s.pausedUntil) > 0
+	s.pauseMu.Unlock()
+
+	pausedFlag := 0
+	if paused {
+		pausedFlag = 1
+	}
+	return []string{
+		fmt.Sprintf("connected_clients:%d", connected),
+		fmt.Sprintf("maxclients:%d", maxClients),
+		fmt.Sprintf("clients_paused:%d", pausedFlag),
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"redis_like_in_memory_db/internal/metrics"
+)
+
+// listenMetrics serves the Prometheus /metrics endpoint on MetricsAddr, the
+// listener is closed on shutdown together with the others
+func (s *Server) listenMetrics() (net.Listener, error) {
+	listener, err := net.Listen("tcp", s.MetricsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.metrics)
+	go http.Serve(listener, mux)
+
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+	return listener, nil
+}
+
+// collectMetrics writes connection metrics
+func (s *Server) collectMetrics(w *metrics.Writer) {
+	s.mu.Lock()
+	connected, accepted, rejected, maxClients := len(s.clients), s.nextClientID, s.rejectedClients, s.MaxClients
+	s.mu.Unlock()
+
+	w.Gauge("server_uptime_seconds", "Time since the server started.", metrics.Sample{Value: s.cache.Uptime().Seconds()})
+	w.Gauge("server_connected_clients", "Currently connected clients.", metrics.Sample{Value: float64(connected)})
+	w.Gauge("server_max_clients", "Limit of connected clients, 0 when disabled.", metrics.Sample{Value: float64(maxClients)})
+	w.Counter("server_connections_total", "Accepted connections.", metrics.Sample{Value: float64(accepted)})
+	w.Counter("server_rejected_connections_total", "Connections refused because of maxclients.",
+		metrics.Sample{Value: float64(rejected)})
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	server := NewServer("", false, false, "", 4, 2, "")
+	server.MetricsAddr = "127.0.0.1:0"
+	metricsListener, err := server.listenMetrics()
+	assert.NoError(t, err)
+	defer metricsListener.Close()
+	address, stop := startTCPServer(t, server)
+	defer stop()
+
+	client := connect(t, address)
+	defer client.conn.Close()
+	client.do("SET user:1 moose 1h")
+	client.do("GET user:1")
+	client.do("GET user:2")
+
+	response, err := http.Get("http://" + metricsListener.Addr().String() + "/metrics")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+
+	metrics := string(body)
+	assert.Contains(t, metrics, `cache_command_duration_seconds_count{command="GET"} 2`)
+	assert.Contains(t, metrics, `cache_command_duration_seconds_count{command="SET"} 1`)
+	assert.NotContains(t, metrics, `command="DSET"`)
+	assert.Contains(t, metrics, "cache_keyspace_hits_total 1\n")
+	assert.Contains(t, metrics, "cache_keyspace_misses_total 1\n")
+	assert.Contains(t, metrics, `cache_shard_keys{shard="0",family="string"}`)
+	assert.Contains(t, metrics, "server_connected_clients 1\n")
+	assert.Contains(t, metrics, "go_goroutines ")
+}
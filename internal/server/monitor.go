@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bufio"
+	"redis_like_in_memory_db/internal/reply"
+	"time"
+)
+
+// monitor streams commands executed by other clients until the connection
+// sends QUIT or is closed, other requests are ignored meanwhile. Lines are
+// statuses of the protocol of the MONITOR request
+func (s *Server) monitor(c *client, requests *requestReader, replies *bufio.Writer, prefixed bool) {
+	lines, stop := s.cache.Monitor()
+	defer stop()
+
+	// a monitor does not send requests, so it is never idle
+	c.conn.SetReadDeadline(time.Time{})
+	if s.isClosing() {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			request, err := requests.next()
+			if err != nil {
+				return
+			}
+			if args := request.args; len(args) != 0 && (args[0] == "QUIT" || args[0] == "EXIT") {
+				return
+			}
+		}
+	}()
+
+	for {
+		if err := replies.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case line := <-lines:
+			writeReply(replies, reply.Status(line), prefixed)
+			// lines which are already queued are sent together
+			for pending := len(lines); pending > 0; pending-- {
+				writeReply(replies, reply.Status(<-lines), prefixed)
+			}
+		case <-done:
+			return
+		}
+	}
+}
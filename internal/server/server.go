@@ -1,95 +1,527 @@
 package server
 
 import (
-	"bytes"
+	"bufio"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
 	"redis_like_in_memory_db/internal/global_cache"
-	"strings"
+	"redis_like_in_memory_db/internal/metrics"
+	"redis_like_in_memory_db/internal/reply"
+	"redis_like_in_memory_db/internal/tx_logger"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	handshakeTimeout       = 10 * time.Second
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+var (
+	wrongArgsNumber = reply.ErrWrongArgsNumber
+	syntaxError     = reply.ErrSyntax
+	commandNotFound = reply.ErrUnknownCommand
+	noSnapshotFile  = reply.ErrNoSnapshotFile
+)
+
+// exit statuses returned by Run
+const (
+	ExitOK = iota
+	// the server could not start
+	ExitStartupFailed
+	// the transaction log or the snapshot could not be written on shutdown
+	ExitPersistenceFailed
 )
 
 type Server struct {
 	Port             string
 	PasswordRequired bool
 	Password         string
-	cache            *global_cache.GlobalCache
+	// users are loaded from the file at startup when it is set
+	ACLFile string
+	TLS     TLSOptions
+	// path of the unix socket listener, disabled while empty
+	UnixSocket     string
+	UnixSocketPerm os.FileMode
+	MaxRequestSize int
+	// values of requests above it are refused
+	ProtoMaxBulkLen int
+	// snapshot is loaded at startup and written on shutdown, disabled while empty
+	SnapshotFile string
+	// the snapshot is written every SaveInterval when there were at least
+	// SaveMinChanges writes, 0 interval disables it
+	SaveInterval   time.Duration
+	SaveMinChanges int64
+	// transaction log file, disabled while empty
+	TXLog      string
+	TXLogFsync string
+	// writes are refused or keys evicted by MaxMemoryPolicy once the heap is
+	// above it, 0 disables the limit
+	MaxMemory       int64
+	MaxMemoryPolicy string
+	// file rewritten by CONFIG REWRITE
+	ConfigFile string
+	// time given to in-flight commands on shutdown
+	ShutdownTimeout time.Duration
+	cache           *global_cache.GlobalCache
+
+	// connections above the limit are refused, 0 disables it
+	MaxClients int
+	// connections without requests are closed after it, 0 disables it
+	IdleTimeout time.Duration
+	// commands slower than it are kept in SLOWLOG, negative disables it
+	SlowlogThreshold time.Duration
+	SlowlogMaxLen    int
+	// internal operations slower than it are recorded by LATENCY, 0 disables it
+	LatencyThreshold time.Duration
+	// address of the HTTP /metrics endpoint, disabled while empty
+	MetricsAddr string
+	metrics     *metrics.Registry
+
+	numBuckets   int
+	numDatabases int
+	// parameters changed by CONFIG SET, REWRITE adds them to the file
+	configChanged map[string]bool
+
+	mu           sync.Mutex
+	listeners    []net.Listener
+	clients      map[int64]*client
+	nextClientID int64
+	// connections refused because of MaxClients
+	rejectedClients int64
+	connections     sync.WaitGroup
+	closing         bool
+
+	// CLIENT PAUSE state
+	pauseMu     sync.Mutex
+	pausedUntil time.Time
+	pauseAll    bool
+	unpaused    chan struct{}
+	// SHUTDOWN commands, the value tells whether to save the snapshot
+	shutdownRequests chan bool
 }
 
-func NewServer(port string, passwordRequired, enableLogging bool, password string, bucketNum int) *Server {
-	return &Server{
+func NewServer(port string, passwordRequired, enableLogging bool, password string, bucketNum, databasesNum int, aclFile string) *Server {
+	server := &Server{
 		Port:             port,
 		PasswordRequired: passwordRequired,
 		Password:         password,
-		cache:            global_cache.NewCache(bucketNum, enableLogging),
+		ACLFile:          aclFile,
+		UnixSocketPerm:   0700,
+		MaxRequestSize:   DefaultMaxRequestSize,
+		ProtoMaxBulkLen:  DefaultProtoMaxBulkLen,
+		ShutdownTimeout:  DefaultShutdownTimeout,
+		TXLogFsync:       tx_logger.FsyncNo,
+		cache:            global_cache.NewCacheWithDatabases(bucketNum, databasesNum, false),
+		numBuckets:       bucketNum,
+		numDatabases:     databasesNum,
+		MaxClients:       DefaultMaxClients,
+		clients:          make(map[int64]*client),
+		shutdownRequests: make(chan bool, 1),
+		configChanged:    make(map[string]bool),
+		metrics:          metrics.NewRegistry(),
+		SlowlogThreshold: global_cache.DefaultSlowlogThreshold,
+		SlowlogMaxLen:    global_cache.DefaultSlowlogMaxLen,
+		MaxMemoryPolicy:  global_cache.NoEviction,
 	}
+	if enableLogging {
+		server.TXLog = tx_logger.DefaultPath
+	}
+	server.cache.AddInfoSection("server", server.serverInfo)
+	server.cache.AddInfoSection("clients", server.clientsInfo)
+	server.metrics.Register(server.collectMetrics)
+	server.metrics.Register(server.cache.CollectMetrics)
+	server.metrics.Register(metrics.CollectRuntime)
+	return server
 }
 
-func (s *Server) Run() {
-	address, err := net.ResolveTCPAddr("tcp", s.Port)
-	if err != nil {
-		return
+// Run serves connections until SIGTERM, SIGINT or the SHUTDOWN command and
+// returns the exit status
+func (s *Server) Run() int {
+	if s.ACLFile != "" {
+		if err := s.cache.LoadACLFile(s.ACLFile); err != nil {
+			fmt.Println("Can not load ACL file: ", err)
+			return ExitStartupFailed
+		}
+	}
+	if s.PasswordRequired {
+		// the default user keeps its permissions but needs the password now
+		if err := s.cache.SetUser("default", "resetpass", ">"+s.Password); err != nil {
+			fmt.Println(err)
+			return ExitStartupFailed
+		}
+	}
+	if s.TXLog != "" {
+		s.cache.EnableTXLog(s.TXLog)
+		if err := s.cache.SetTXLogFsync(s.TXLogFsync); err != nil {
+			fmt.Println(err)
+			return ExitStartupFailed
+		}
+	}
+	s.cache.SetMaxMemory(s.MaxMemory)
+	if err := s.cache.SetEvictionPolicy(s.MaxMemoryPolicy); err != nil {
+		fmt.Println(err)
+		return ExitStartupFailed
+	}
+	s.cache.SetSlowlog(s.SlowlogThreshold, s.SlowlogMaxLen)
+	s.cache.SetLatencyThreshold(s.LatencyThreshold)
+	if s.SnapshotFile != "" {
+		s.cache.SetSnapshotFile(s.SnapshotFile)
+		if _, err := os.Stat(s.SnapshotFile); err == nil {
+			if err := s.cache.LoadSnapshot(s.SnapshotFile); err != nil {
+				fmt.Println("Can not load snapshot: ", err)
+				return ExitStartupFailed
+			}
+		}
 	}
 
-	listener, err := net.ListenTCP("tcp", address)
+	listeners, err := s.listen()
 	if err != nil {
 		fmt.Println(err)
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		return ExitStartupFailed
 	}
+	if s.MetricsAddr != "" {
+		if _, err := s.listenMetrics(); err != nil {
+			fmt.Println("Can not start metrics endpoint: ", err)
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return ExitStartupFailed
+		}
+	}
+	for _, listener := range listeners {
+		go s.Serve(listener)
+	}
+	stopSaving, savingDone := make(chan struct{}), make(chan struct{})
+	go s.autoSave(stopSaving, savingDone)
 
-	for {
-		conn, err := listener.Accept()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	// without an explicit option the snapshot is written when it is configured
+	save := s.SnapshotFile != ""
+	select {
+	case sig := <-signals:
+		fmt.Println("Received signal, shutting down: ", sig)
+	case save = <-s.shutdownRequests:
+		fmt.Println("SHUTDOWN requested")
+	}
+
+	// a periodic save must not race with the one on shutdown
+	close(stopSaving)
+	<-savingDone
+	return s.Shutdown(save)
+}
+
+// listen opens every configured listener, TCP can be disabled with an empty
+// port when clients use the unix socket only
+func (s *Server) listen() ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0)
+	if s.Port != "" {
+		address, err := net.ResolveTCPAddr("tcp", s.Port)
 		if err != nil {
-			continue
+			return listeners, err
 		}
 
-		conn.Write([]byte("SSuccessful connection\n"))
+		listener, err := net.ListenTCP("tcp", address)
+		if err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, listener)
+	}
+	if s.TLS.Port != "" {
+		listener, err := s.listenTLS()
+		if err != nil {
+			return listeners, fmt.Errorf("can not start TLS listener: %s", err)
+		}
+		listeners = append(listeners, listener)
+	}
+	if s.UnixSocket != "" {
+		listener, err := s.listenUnix()
+		if err != nil {
+			return listeners, fmt.Errorf("can not start unix socket listener: %s", err)
+		}
+		listeners = append(listeners, listener)
+	}
 
-		go handleConn(conn, s)
+	if len(listeners) == 0 {
+		return listeners, errors.New("no listeners configured")
 	}
+	return listeners, nil
 }
 
-func handleConn(conn net.Conn, server *Server) {
-	defer conn.Close()
-	if server.PasswordRequired {
-		authorizeConnection(conn, server.Password)
+// Shutdown stops accepting connections, lets in-flight commands finish within
+// ShutdownTimeout, flushes the transaction log to disk and writes the
+// snapshot when save is set. A running script is aborted right away without
+// save and after ShutdownTimeout otherwise, the snapshot is then not written
+// since it could hold a part of the script. It returns the exit status
+func (s *Server) Shutdown(save bool) int {
+	s.mu.Lock()
+	s.closing = true
+	timeout := s.ShutdownTimeout
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	// idle connections stop waiting for requests, busy ones do it after the current command
+	for _, c := range s.clients {
+		c.conn.SetReadDeadline(time.Now())
 	}
+	s.mu.Unlock()
 
-	// accept inputs
-	parseRequest(conn, server)
+	status := ExitOK
+	// the dataset is not saved, so a script which has written may be stopped
+	if !save {
+		s.cache.AbortScript()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+		fmt.Println("Connections did not finish in time, closing them")
+		s.mu.Lock()
+		for _, c := range s.clients {
+			c.conn.Close()
+		}
+		s.mu.Unlock()
+		// a script which never ends would keep the cache locked for good
+		if s.cache.AbortScript() && save {
+			fmt.Println("Aborted a running script, the snapshot is not saved")
+			save = false
+			status = ExitPersistenceFailed
+		}
+	}
+
+	if err := s.cache.Close(); err != nil {
+		fmt.Println("Can not flush transaction log: ", err)
+		status = ExitPersistenceFailed
+	}
+	if save {
+		if err := s.cache.Save(); err != nil {
+			fmt.Println("Can not save snapshot: ", err)
+			status = ExitPersistenceFailed
+		}
+	}
+
+	return status
 }
 
-func authorizeConnection(conn net.Conn, serverPassword string) {
-	conn.Write([]byte("Authorize to proceed\n"))
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closing
+}
+
+// shutdownCommand handles SHUTDOWN [SAVE|NOSAVE], it returns false and the
+// error reply when the server keeps running
+func (s *Server) shutdownCommand(session *global_cache.Session, args []string) (reply.Reply, bool) {
+	if err := s.cache.Authorize(session, args); err != nil {
+		return reply.Err(err), false
+	}
+
+	save := s.SnapshotFile != ""
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && args[1] == "SAVE":
+		if s.SnapshotFile == "" {
+			return reply.Err(noSnapshotFile), false
+		}
+		save = true
+	case len(args) == 2 && args[1] == "NOSAVE":
+		save = false
+	default:
+		return reply.Err(syntaxError), false
+	}
+
+	select {
+	case s.shutdownRequests <- save:
+	default:
+		// shutdown is already requested
+	}
+	return reply.OK, true
+}
+
+// listenUnix replaces a socket left by a previous run and applies permissions
+func (s *Server) listenUnix() (net.Listener, error) {
+	if info, err := os.Stat(s.UnixSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(s.UnixSocket)
+	}
+
+	listener, err := net.Listen("unix", s.UnixSocket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(s.UnixSocket, s.UnixSocketPerm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func (s *Server) listenTLS() (net.Listener, error) {
+	reloader, err := newCertReloader(s.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", s.TLS.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.NewListener(listener, reloader.tlsConfig()), nil
+}
+
+// Serve accepts connections until the listener is closed
+func (s *Server) Serve(listener net.Listener) {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		listener.Close()
+		return
+	}
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
 
-	var buf [512]byte
 	for {
-		n, err := conn.Read(buf[0:])
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
 			continue
 		}
 
-		password := strings.TrimSpace(string(buf[0:n]))
-		if password == serverPassword {
-			conn.Write([]byte("You have authorized  successfully\n"))
-			break
+		go handleConn(conn, s)
+	}
+}
+
+func handleConn(conn net.Conn, server *Server) {
+	defer conn.Close()
+	c, err := server.track(conn)
+	if err != nil {
+		conn.Write([]byte(reply.Err(err).String() + "\n"))
+		return
+	}
+	defer server.untrack(c)
+
+	session := server.cache.NewSession()
+	session.Addr = c.addr
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		conn.SetDeadline(time.Time{})
+
+		// a verified client certificate authenticates the user named by its CN
+		if state := tlsConn.ConnectionState(); len(state.VerifiedChains) != 0 {
+			server.cache.AuthenticateUser(session, state.VerifiedChains[0][0].Subject.CommonName)
 		}
+	}
 
-		conn.Write([]byte("Incorrect attempt of authorization\n"))
+	conn.Write([]byte("SSuccessful connection\n"))
+	if !session.Authenticated() {
+		conn.Write([]byte("Authorize to proceed with AUTH [username] password\n"))
 	}
+
+	// accept inputs
+	parseRequest(c, server, session)
 }
 
-func parseRequest(conn net.Conn, server *Server) {
-	var buf [512]byte
+func parseRequest(c *client, server *Server, session *global_cache.Session) {
+	server.mu.Lock()
+	maxRequestSize, maxBulkLen := server.MaxRequestSize, server.ProtoMaxBulkLen
+	server.mu.Unlock()
+
+	requests := newRequestReader(c.conn, maxRequestSize, maxBulkLen, server.cache.ParseRequest)
+	replies := bufio.NewWriter(c.conn)
+	defer replies.Flush()
+
 	for {
-		n, err := conn.Read(buf[0:])
-		if err != nil {
+		// replies of pipelined requests are sent together once the input is drained
+		if !requests.buffered() {
+			if err := replies.Flush(); err != nil {
+				return
+			}
+			server.armReadDeadline(c.conn)
+		}
+
+		// unauthenticated connections can not make the server allocate much
+		if session.Authenticated() {
+			requests.limit(maxRequestSize, maxBulkLen)
+		} else {
+			requests.limit(unauthenticatedMaxRequestSize, unauthenticatedMaxRequestSize)
+		}
+		request, err := requests.next()
+		if err == valueTooLarge && !request.prefixed {
+			writeReply(replies, reply.Err(err), false)
+			continue
+		}
+		if err == requestTooLarge || err == valueTooLarge || err == reply.ErrProtocol {
+			writeReply(replies, reply.Err(err), request.prefixed)
+			return
+		}
+		// requests which were not started before shutdown are not executed
+		if err != nil || server.isClosing() {
 			return
 		}
 
-		if bytes.HasPrefix(buf[:], []byte("QUIT")) || bytes.HasPrefix(buf[:], []byte("EXIT")) {
-			break
+		args := request.args
+		if len(args) == 0 {
+			writeReply(replies, reply.Err(wrongArgsNumber), request.prefixed)
+			continue
 		}
+		server.waitPause(args[0])
+		c.begin(args[0])
+		switch args[0] {
+		case "QUIT", "EXIT":
+			return
+		case "SHUTDOWN":
+			result, ok := server.shutdownCommand(session, args)
+			if ok {
+				return
+			}
+			writeReply(replies, result, request.prefixed)
+		case "CLIENT":
+			writeReply(replies, server.clientCommand(c, session, args), request.prefixed)
+		case "CONFIG":
+			writeReply(replies, server.configCommand(session, args), request.prefixed)
+		case "MONITOR":
+			if err := server.cache.Authorize(session, args); err != nil {
+				writeReply(replies, reply.Err(err), request.prefixed)
+				break
+			}
+			writeReply(replies, reply.OK, request.prefixed)
+			c.finish(session)
+			server.monitor(c, requests, replies, request.prefixed)
+			return
+		default:
+			writeReply(replies, server.cache.Execute(session, args), request.prefixed)
+		}
+		c.finish(session)
 
-		response := server.cache.PerformCommand(buf[0:n])
-		conn.Write([]byte(response))
+		c.mu.Lock()
+		killed := c.killed
+		c.mu.Unlock()
+		if killed {
+			return
+		}
 	}
 }
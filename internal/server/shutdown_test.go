@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// dialUnix waits for the server to listen on the socket and skips the greeting
+func dialUnix(t *testing.T, path string) (net.Conn, *bufio.Reader) {
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			reader := bufio.NewReader(conn)
+			reader.ReadString('\n')
+			return conn, reader
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("server did not start")
+	return nil, nil
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shutdown")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := NewServer("", false, false, "", 4, 2, "")
+	server.UnixSocket = filepath.Join(dir, "redis.sock")
+	server.SnapshotFile = filepath.Join(dir, "dump.snapshot")
+
+	status := make(chan int)
+	go func() {
+		status <- server.Run()
+	}()
+
+	idle, idleReader := dialUnix(t, server.UnixSocket)
+	defer idle.Close()
+	conn, reader := dialUnix(t, server.UnixSocket)
+	defer conn.Close()
+
+	{
+		t.Log("Given a wrong option the server should keep running")
+		conn.Write([]byte("SET key value 1h\nSHUTDOWN LATER\n"))
+		reply, _ := reader.ReadString('\n')
+		assert.EqualValues(t, "Success\n", reply)
+		reply, _ = reader.ReadString('\n')
+		assert.EqualValues(t, "-ERR syntax error\n", reply)
+	}
+
+	{
+		t.Log("SHUTDOWN SAVE should close connections, write the snapshot and exit with 0")
+		conn.Write([]byte("SHUTDOWN SAVE\n"))
+
+		select {
+		case code := <-status:
+			assert.EqualValues(t, ExitOK, code)
+		case <-time.After(5 * time.Second):
+			t.Fatal("server did not shut down")
+		}
+
+		_, err := idleReader.ReadString('\n')
+		assert.Error(t, err)
+		_, err = net.Dial("unix", server.UnixSocket)
+		assert.Error(t, err)
+	}
+
+	{
+		t.Log("The next start should load the snapshot")
+		restarted := NewServer("", false, false, "", 4, 2, "")
+		restarted.UnixSocket = server.UnixSocket
+		restarted.SnapshotFile = server.SnapshotFile
+		go func() {
+			status <- restarted.Run()
+		}()
+
+		conn, reader := dialUnix(t, restarted.UnixSocket)
+		defer conn.Close()
+		conn.Write([]byte("GET key\nSHUTDOWN NOSAVE\n"))
+		reply, _ := reader.ReadString('\n')
+		assert.EqualValues(t, "value\n", reply)
+		assert.EqualValues(t, ExitOK, <-status)
+	}
+}
+
+func TestServer_ShutdownRunawayScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shutdown")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the script has written, so neither SCRIPT KILL nor the time limit stop it
+	runaway := []byte("EVAL \"redis.call('SET', KEYS[1], 'value', '1h') while true do end\" 1 key\n")
+
+	for _, test := range []struct {
+		name     string
+		shutdown string
+		status   int
+	}{
+		{"SHUTDOWN NOSAVE should abort the script and exit with 0", "SHUTDOWN NOSAVE\n", ExitOK},
+		{"SHUTDOWN SAVE should abort the script after the timeout and not save", "SHUTDOWN SAVE\n", ExitPersistenceFailed},
+	} {
+		t.Log(test.name)
+		server := NewServer("", false, false, "", 4, 2, "")
+		server.UnixSocket = filepath.Join(dir, "redis.sock")
+		server.SnapshotFile = filepath.Join(dir, "dump.snapshot")
+		server.ShutdownTimeout = 100 * time.Millisecond
+
+		status := make(chan int)
+		go func() {
+			status <- server.Run()
+		}()
+
+		busy, _ := dialUnix(t, server.UnixSocket)
+		conn, reader := dialUnix(t, server.UnixSocket)
+		busy.Write(runaway)
+		for i := 0; i < 100; i++ {
+			conn.Write([]byte("SCRIPT KILL\n"))
+			if reply, _ := reader.ReadString('\n'); reply != "-ERR no scripts in execution right now\n" {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		conn.Write([]byte(test.shutdown))
+
+		select {
+		case code := <-status:
+			assert.EqualValues(t, test.status, code)
+		case <-time.After(5 * time.Second):
+			t.Fatal("server did not shut down")
+		}
+		_, err := os.Stat(server.SnapshotFile)
+		assert.True(t, os.IsNotExist(err))
+		busy.Close()
+		conn.Close()
+	}
+}
+
+func TestServer_FunctionsRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "functions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	load := []byte("FUNCTION LOAD \"#!lua name=lib\nredis.register_function('hello', function() return 'hi' end)\"\n")
+	start := func(snapshot bool) (chan int, net.Conn, *bufio.Reader) {
+		server := NewServer("", false, false, "", 4, 2, "")
+		server.UnixSocket = filepath.Join(dir, "redis.sock")
+		server.TXLog = filepath.Join(dir, "tx_log")
+		if snapshot {
+			server.SnapshotFile = filepath.Join(dir, "dump.snapshot")
+		}
+		status := make(chan int)
+		go func() {
+			status <- server.Run()
+		}()
+		conn, reader := dialUnix(t, server.UnixSocket)
+		return status, conn, reader
+	}
+
+	{
+		t.Log("Given only the transaction log libraries should not be loaded, they would be lost on restart")
+		status, conn, reader := start(false)
+		conn.Write(load)
+		reply, _ := reader.ReadString('\n')
+		assert.EqualValues(t, "-ERR snapshot file is not configured\n", reply)
+		conn.Write([]byte("SHUTDOWN\n"))
+		assert.EqualValues(t, ExitOK, <-status)
+		conn.Close()
+	}
+
+	{
+		t.Log("Given a snapshot file libraries should survive a restart")
+		status, conn, reader := start(true)
+		conn.Write(load)
+		reply, _ := reader.ReadString('\n')
+		assert.EqualValues(t, "lib\n", reply)
+		conn.Write([]byte("SHUTDOWN\n"))
+		assert.EqualValues(t, ExitOK, <-status)
+		conn.Close()
+
+		status, conn, reader = start(true)
+		conn.Write([]byte("FCALL hello 0\nSHUTDOWN NOSAVE\n"))
+		reply, _ = reader.ReadString('\n')
+		assert.EqualValues(t, "hi\n", reply)
+		assert.EqualValues(t, ExitOK, <-status)
+		conn.Close()
+	}
+}
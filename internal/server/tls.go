@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions configures the TLS listener, it is disabled while Port is empty
+type TLSOptions struct {
+	Port     string
+	CertFile string
+	KeyFile  string
+	// CA verifying client certificates, clients are not asked for one without it
+	CAFile string
+	// clients without a valid certificate are refused
+	AuthClients bool
+}
+
+var (
+	noCertificates  = errors.New("no certificates found in the CA file")
+	authClientsNoCA = errors.New("tls_auth_clients requires tls_ca to verify client certificates")
+)
+
+// certReloader keeps certificates loaded from files and reloads them when
+// the files change, so that renewed certificates are used without restart
+type certReloader struct {
+	mu      sync.Mutex
+	options TLSOptions
+	config  *tls.Config
+	// modification times of the loaded files
+	modTimes map[string]time.Time
+}
+
+func newCertReloader(options TLSOptions) (*certReloader, error) {
+	if options.AuthClients && options.CAFile == "" {
+		return nil, authClientsNoCA
+	}
+	reloader := &certReloader{options: options}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (reloader *certReloader) files() []string {
+	files := []string{reloader.options.CertFile, reloader.options.KeyFile}
+	if reloader.options.CAFile != "" {
+		files = append(files, reloader.options.CAFile)
+	}
+
+	return files
+}
+
+func (reloader *certReloader) changed() bool {
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(reloader.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reload reads every file again, the previous config is kept on failure
+func (reloader *certReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(reloader.options.CertFile, reloader.options.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.NoClientCert,
+	}
+	if reloader.options.CAFile != "" {
+		pem, err := ioutil.ReadFile(reloader.options.CAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return noCertificates
+		}
+
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if reloader.options.AuthClients {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	reloader.config = config
+	reloader.modTimes = modTimes
+	return nil
+}
+
+// configForClient is called on every handshake and picks up changed files
+func (reloader *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	if reloader.changed() {
+		if err := reloader.reload(); err != nil {
+			fmt.Println("Can not reload TLS certificates, keeping the previous ones: ", err)
+		}
+	}
+
+	return reloader.config, nil
+}
+
+func (reloader *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{GetConfigForClient: reloader.configForClient}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// newTestCert creates a certificate signed by parent or a self-signed CA when parent is nil
+func newTestCert(t *testing.T, commonName string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCert{cert: cert, key: key, tls: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+func (cert *testCert) write(t *testing.T, certFile, keyFile string) {
+	keyDer, err := x509.MarshalECPrivateKey(cert.key)
+	assert.NoError(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.cert.Raw})
+	assert.NoError(t, ioutil.WriteFile(certFile, certPem, 0600))
+	if keyFile != "" {
+		keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+		assert.NoError(t, ioutil.WriteFile(keyFile, keyPem, 0600))
+	}
+}
+
+// startTLSServer serves TLS connections on a random port and returns its address
+func startTLSServer(t *testing.T, server *Server) (string, func()) {
+	listener, err := server.listenTLS()
+	assert.NoError(t, err)
+	go server.Serve(listener)
+
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// tlsCommand connects, sends a single command and returns the reply
+func tlsCommand(address string, config *tls.Config, command string) (*tls.ConnectionState, string, error) {
+	conn, err := tls.Dial("tcp", address, config)
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString('\n'); err != nil {
+		return nil, "", err
+	}
+	if _, err := conn.Write([]byte(command + "\n")); err != nil {
+		return nil, "", err
+	}
+	reply, err := reader.ReadString('\n')
+	state := conn.ConnectionState()
+
+	return &state, reply, err
+}
+
+func TestServer_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "test ca", 1, nil)
+	serverCert := newTestCert(t, "server", 2, ca)
+	clientCert := newTestCert(t, "analytics", 3, ca)
+
+	options := TLSOptions{
+		Port:     "127.0.0.1:0",
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	ca.write(t, options.CAFile, "")
+	serverCert.write(t, options.CertFile, options.KeyFile)
+
+	server := NewServer(":0", false, false, "", 4, 2, "")
+	server.TLS = options
+	assert.NoError(t, server.cache.SetUser("analytics", "on", "~*", "+@read", "+acl"))
+	address, stop := startTLSServer(t, server)
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	{
+		t.Log("Given no client certificate it should work as the default user")
+		state, reply, err := tlsCommand(address, &tls.Config{RootCAs: roots}, "ACL WHOAMI")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "default\n", reply)
+		assert.EqualValues(t, big.NewInt(2), state.PeerCertificates[0].SerialNumber)
+	}
+
+	{
+		t.Log("Given a client certificate it should authenticate the user named by CN")
+		config := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert.tls}}
+		_, reply, err := tlsCommand(address, config, "ACL WHOAMI")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "analytics\n", reply)
+	}
+
+	{
+		t.Log("Given renewed certificate files it should use them without restart")
+		renewed := newTestCert(t, "server", 4, ca)
+		renewed.write(t, options.CertFile, options.KeyFile)
+		future := time.Now().Add(time.Minute)
+		os.Chtimes(options.CertFile, future, future)
+		os.Chtimes(options.KeyFile, future, future)
+
+		state, _, err := tlsCommand(address, &tls.Config{RootCAs: roots}, "ACL WHOAMI")
+		assert.NoError(t, err)
+		assert.EqualValues(t, big.NewInt(4), state.PeerCertificates[0].SerialNumber)
+	}
+}
+
+func TestServer_TLSAuthClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "test ca", 1, nil)
+	serverCert := newTestCert(t, "server", 2, ca)
+	clientCert := newTestCert(t, "default", 3, ca)
+	stranger := newTestCert(t, "default", 4, newTestCert(t, "other ca", 5, nil))
+
+	options := TLSOptions{
+		Port:        "127.0.0.1:0",
+		CertFile:    filepath.Join(dir, "server.crt"),
+		KeyFile:     filepath.Join(dir, "server.key"),
+		CAFile:      filepath.Join(dir, "ca.crt"),
+		AuthClients: true,
+	}
+	ca.write(t, options.CAFile, "")
+	serverCert.write(t, options.CertFile, options.KeyFile)
+
+	server := NewServer(":0", false, false, "", 4, 2, "")
+	server.TLS = options
+	address, stop := startTLSServer(t, server)
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	{
+		t.Log("Given no client certificate or one of another CA it should refuse the connection")
+		_, _, err := tlsCommand(address, &tls.Config{RootCAs: roots}, "ACL WHOAMI")
+		assert.Error(t, err)
+		_, _, err = tlsCommand(address, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{stranger.tls}}, "ACL WHOAMI")
+		assert.Error(t, err)
+	}
+
+	{
+		config := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert.tls}}
+		_, reply, err := tlsCommand(address, config, "ACL WHOAMI")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "default\n", reply)
+	}
+
+	{
+		t.Log("Given tls_auth_clients without tls_ca the listener should not start")
+		withoutCA := options
+		withoutCA.CAFile = ""
+		_, err := newCertReloader(withoutCA)
+		assert.Equal(t, authClientsNoCA, err)
+	}
+}
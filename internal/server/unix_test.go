@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServer_UnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := NewServer("", false, false, "", 4, 2, "")
+	server.UnixSocket = filepath.Join(dir, "redis.sock")
+	server.UnixSocketPerm = 0770
+	assert.NoError(t, server.cache.SetUser("default", "resetpass", ">secret"))
+
+	{
+		t.Log("Given a socket left by a previous run it should replace it")
+		stale, err := net.Listen("unix", server.UnixSocket)
+		assert.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+	}
+
+	listener, err := server.listenUnix()
+	assert.NoError(t, err)
+	defer listener.Close()
+	go server.Serve(listener)
+
+	{
+		info, err := os.Stat(server.UnixSocket)
+		assert.NoError(t, err)
+		assert.EqualValues(t, os.FileMode(0770), info.Mode().Perm())
+	}
+
+	{
+		t.Log("Clients of the unix socket should authenticate like TCP ones")
+		conn, err := net.Dial("unix", server.UnixSocket)
+		assert.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		reader := bufio.NewReader(conn)
+
+		reply, _ := reader.ReadString('\n')
+		assert.EqualValues(t, "SSuccessful connection\n", reply)
+		reply, _ = reader.ReadString('\n')
+		assert.EqualValues(t, "Authorize to proceed with AUTH [username] password\n", reply)
+
+		conn.Write([]byte("GET key\n"))
+		reply, _ = reader.ReadString('\n')
+		assert.EqualValues(t, "-NOAUTH authentication required\n", reply)
+
+		conn.Write([]byte("AUTH secret\n"))
+		reply, _ = reader.ReadString('\n')
+		assert.EqualValues(t, "Success\n", reply)
+	}
+}
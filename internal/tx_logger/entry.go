@@ -0,0 +1,66 @@
+package tx_logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"redis_like_in_memory_db/internal/reply"
+	"strings"
+	"time"
+)
+
+// Entry is a write command recorded by the log
+type Entry struct {
+	Time time.Time
+	// index of the database the command was executed against
+	DB   int
+	Args []string
+}
+
+// Format encodes the entry as a "unix-time db" line followed by the
+// arguments in the length prefixed protocol, so any bytes are kept
+func Format(entry Entry) string {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "%d %d\n", entry.Time.Unix(), entry.DB)
+	w := bufio.NewWriter(buf)
+	reply.Write(w, reply.Values(entry.Args))
+	w.Flush()
+
+	return buf.String()
+}
+
+// Reader reads entries of a log file
+type Reader struct {
+	reader *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReader(r)}
+}
+
+// Next returns the next entry, io.EOF is returned at the end of the log and
+// io.ErrUnexpectedEOF when the last entry has been written partially
+func (r *Reader) Next() (Entry, error) {
+	var unix int64
+	var entry Entry
+	if _, err := fmt.Fscanf(r.reader, "%d %d\n", &unix, &entry.DB); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return Entry{}, err
+		}
+		return Entry{}, reply.ErrProtocol
+	}
+
+	args, err := reply.Read(r.reader)
+	switch {
+	case err == io.EOF:
+		return Entry{}, io.ErrUnexpectedEOF
+	case err != nil:
+		return Entry{}, err
+	case args.Kind != reply.ArrayKind:
+		return Entry{}, reply.ErrProtocol
+	}
+	entry.Time = time.Unix(unix, 0)
+	entry.Args = args.Strings()
+
+	return entry, nil
+}
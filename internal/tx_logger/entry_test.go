@@ -0,0 +1,70 @@
+package tx_logger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntry_Format(t *testing.T) {
+	entries := []Entry{
+		{Time: time.Unix(1700000000, 0), DB: 0, Args: []string{"SET", "key", "line\r\n\"quote\" nul\x00", "1h"}},
+		{Time: time.Unix(1700000001, 0), DB: 3, Args: []string{"DSET", "dict", "", "[1 2]", "1h"}},
+	}
+
+	{
+		t.Log("Entries should be read back as they were written")
+		path := filepath.Join(t.TempDir(), "tx_log")
+		logger := NewTXLogger(path)
+		go logger.ProcessLogWrite()
+		for _, entry := range entries {
+			logger.Write(Format(entry))
+		}
+		assert.NoError(t, logger.Close())
+
+		file, err := os.Open(path)
+		assert.NoError(t, err)
+		defer file.Close()
+		reader := NewReader(file)
+		for _, expected := range entries {
+			entry, err := reader.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, expected, entry)
+		}
+		_, err = reader.Next()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	{
+		t.Log("Entries should be written in the order of Write calls")
+		path := filepath.Join(t.TempDir(), "tx_log")
+		logger := NewTXLogger(path)
+		go logger.ProcessLogWrite()
+		for i := 0; i < 1000; i++ {
+			logger.Write(Format(Entry{Time: time.Unix(int64(i), 0), Args: []string{"DEL", strconv.Itoa(i)}}))
+		}
+		assert.NoError(t, logger.Close())
+
+		file, err := os.Open(path)
+		assert.NoError(t, err)
+		defer file.Close()
+		reader := NewReader(file)
+		for i := 0; i < 1000; i++ {
+			entry, err := reader.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"DEL", strconv.Itoa(i)}, entry.Args)
+		}
+	}
+
+	{
+		t.Log("Given a partially written entry it should be reported")
+		log := Format(entries[0])
+		_, err := NewReader(strings.NewReader(log[:len(log)-4])).Next()
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	}
+}
@@ -4,52 +4,176 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"redis_like_in_memory_db/internal/latency"
+	"redis_like_in_memory_db/internal/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPath is the log file relative to the working directory
+const DefaultPath = "tx_logs/tx_log"
+
+// entries queued for the writer before Write blocks
+const queueSize = 4096
+
+// fsync policies of the log file
+const (
+	// the operating system decides when to flush
+	FsyncNo = "no"
+	// every entry is synced before the next one is written
+	FsyncAlways = "always"
+	// written entries are synced once a second
+	FsyncEverySec = "everysec"
 )
 
 type TXLogger struct {
 	LogPath string
 	LogChan chan string
+	// latency of writes to the log file
+	WriteLatency *metrics.Histogram
+	// slow writes are reported to it as tx-log-write events, may be nil
+	Latency *latency.Monitor
+	// entries sent to LogChan but not written yet
+	pending      sync.WaitGroup
+	pendingCount int64
+	mu           sync.Mutex
+	closed       bool
+	closeChan    chan chan error
+	fsync        atomic.Value
 }
 
 func NewTXLogger(path string) *TXLogger {
 	txLogger := new(TXLogger)
 	txLogger.LogPath = path
-	txLogger.LogChan = make(chan string)
+	txLogger.LogChan = make(chan string, queueSize)
+	txLogger.closeChan = make(chan chan error)
+	txLogger.WriteLatency = metrics.NewHistogram(metrics.LatencyBuckets)
+	txLogger.fsync.Store(FsyncNo)
 
 	checkLogFileExists(path)
 	return txLogger
 }
 
+// checkLogFileExists creates the log file and its directory
 func checkLogFileExists(path string) {
-	rootDir, _ := os.Getwd()
-	logPath := filepath.Join(rootDir, "tx_logs")
-	if _, err := os.Stat(logPath); os.IsNotExist(err) {
-		os.Mkdir(logPath, 0700)
+	logDir := filepath.Dir(path)
+	if _, err := os.Stat(logDir); os.IsNotExist(err) {
+		os.MkdirAll(logDir, 0700)
 	}
 
-	logFile := filepath.Join(logPath, path)
-	if _, err := os.Stat(logFile); os.IsNotExist(err) {
-		os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.ModePerm)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.ModePerm)
 	}
 }
 
-func (txl *TXLogger) ProcessLogWrite() {
-	projectDir, _ := os.Getwd()
-	file, err := os.OpenFile(filepath.Join(projectDir, "tx_logs", txl.LogPath), os.O_APPEND|os.O_WRONLY, os.ModePerm)
-	if err != nil {
-		fmt.Println("Can not write logs to logfile: ", err)
+// SetFsync sets the policy of syncing the log file to disk
+func (txl *TXLogger) SetFsync(policy string) error {
+	if err := CheckFsync(policy); err != nil {
+		return err
+	}
+	txl.fsync.Store(policy)
+	return nil
+}
+
+// CheckFsync returns an error when the fsync policy is unknown
+func CheckFsync(policy string) error {
+	switch policy {
+	case FsyncNo, FsyncAlways, FsyncEverySec:
+		return nil
+	}
+	return fmt.Errorf("unknown fsync policy %s, use %s, %s or %s", policy, FsyncNo, FsyncAlways, FsyncEverySec)
+}
+
+func (txl *TXLogger) Fsync() string {
+	return txl.fsync.Load().(string)
+}
+
+// Write queues the entry without waiting for it to be written, entries are
+// written in the order of Write calls. It blocks only while the queue is
+// full, entries written after Close are dropped
+func (txl *TXLogger) Write(logInfo string) {
+	txl.mu.Lock()
+	defer txl.mu.Unlock()
+
+	if txl.closed {
 		return
 	}
-	defer file.Close()
+	txl.pending.Add(1)
+	atomic.AddInt64(&txl.pendingCount, 1)
+	txl.LogChan <- logInfo
+}
+
+// Pending returns the number of entries waiting to be written
+func (txl *TXLogger) Pending() int64 {
+	return atomic.LoadInt64(&txl.pendingCount)
+}
+
+// Close waits for every pending entry to be written, then syncs the log to
+// disk and closes it
+func (txl *TXLogger) Close() error {
+	txl.mu.Lock()
+	txl.closed = true
+	txl.mu.Unlock()
+
+	txl.pending.Wait()
+	result := make(chan error)
+	txl.closeChan <- result
+	return <-result
+}
+
+func (txl *TXLogger) ProcessLogWrite() {
+	file, openErr := os.OpenFile(txl.LogPath, os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if openErr != nil {
+		// entries are still received and dropped, so that writers and Close do not block
+		fmt.Println("Can not write logs to logfile: ", openErr)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	// entries written after the last sync
+	unsynced := false
 
 	for {
 		select {
+		case <-ticker.C:
+			if unsynced && file != nil && txl.Fsync() == FsyncEverySec {
+				if err := file.Sync(); err != nil {
+					fmt.Println("error syncing transaction log: ", err)
+				}
+				unsynced = false
+			}
+
 		case logInfo := <-txl.LogChan:
-			fmt.Println(logInfo)
-			_, err := file.Write([]byte(logInfo))
-			if err != nil {
-				fmt.Println("error writing transaction log  to file:  ", err)
+			if file != nil {
+				start := time.Now()
+				_, err := file.Write([]byte(logInfo))
+				if err == nil && txl.Fsync() == FsyncAlways {
+					err = file.Sync()
+				}
+				unsynced = true
+				duration := time.Since(start)
+				txl.WriteLatency.Observe(duration)
+				txl.Latency.Record("tx-log-write", duration)
+				if err != nil {
+					fmt.Println("error writing transaction log  to file:  ", err)
+				}
+			}
+			atomic.AddInt64(&txl.pendingCount, -1)
+			txl.pending.Done()
+
+		case result := <-txl.closeChan:
+			if file == nil {
+				result <- openErr
+				return
+			}
+
+			err := file.Sync()
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
 			}
+			result <- err
+			return
 		}
 	}
 }